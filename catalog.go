@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kzs0/pill_manager/manager"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+const catalogUsage = "usage: catalog import <file.csv>"
+
+// Header names, lowercased, each catalog field is read from. The first
+// column found is used, so the usual names from RxNorm and openFDA style
+// exports work as they are.
+var catalogColumns = map[string][]string{
+	"name":     {"name", "generic_name", "nonproprietaryname", "str"},
+	"brand":    {"brand", "brand_name", "proprietaryname"},
+	"strength": {"strength", "active_numerator_strength"},
+	"unit":     {"strength_unit", "active_ingred_unit"},
+	"form":     {"form", "dosage_form", "dosageformname"},
+	"route":    {"route", "routename"},
+	"generic":  {"generic"},
+}
+
+// Words in the dosage forms of drug lists, lowercased, and the form they
+// are. Forms that aren't recognized are left empty.
+var catalogForms = map[string]models.DosageForm{
+	"tablet":     models.FormTablet,
+	"capsule":    models.FormCapsule,
+	"solution":   models.FormLiquid,
+	"suspension": models.FormLiquid,
+	"syrup":      models.FormLiquid,
+	"elixir":     models.FormLiquid,
+	"liquid":     models.FormLiquid,
+	"injection":  models.FormInjection,
+	"injectable": models.FormInjection,
+	"patch":      models.FormPatch,
+	"inhaler":    models.FormInhaler,
+	"aerosol":    models.FormInhaler,
+	"inhalant":   models.FormInhaler,
+}
+
+// Routes of drug lists, lowercased, and the route they are. Routes that
+// aren't recognized are left empty.
+var catalogRoutes = map[string]models.Route{
+	"oral":                     models.RouteOral,
+	"sublingual":               models.RouteSublingual,
+	"topical":                  models.RouteTopical,
+	"transdermal":              models.RouteTransdermal,
+	"inhaled":                  models.RouteInhaled,
+	"respiratory (inhalation)": models.RouteInhaled,
+	"nasal":                    models.RouteNasal,
+	"ophthalmic":               models.RouteOphthalmic,
+	"otic":                     models.RouteOtic,
+	"rectal":                   models.RouteRectal,
+	"vaginal":                  models.RouteVaginal,
+	"subcutaneous":             models.RouteSubcutaneous,
+	"intramuscular":            models.RouteIntramuscular,
+	"intravenous":              models.RouteIntravenous,
+}
+
+// runCatalog implements the `catalog` subcommand.
+func runCatalog(ctx context.Context, sqldb *sql.DB, args []string) error {
+	if len(args) != 2 || args[0] != "import" {
+		return errors.New(catalogUsage)
+	}
+
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	medications, err := readCatalog(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[1], err)
+	}
+
+	handler := &manager.Handler{
+		DB:      sqldb,
+		Queries: sqlc.New(sqldb),
+	}
+
+	added, err := handler.ImportMedications(ctx, medications)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("read %d medications, added %d to the catalog\n", len(medications), added)
+	return nil
+}
+
+// readCatalog reads medications from a CSV file with a header row. Rows
+// without a name are skipped. Without a generic column, medications without
+// a brand are taken to be generic. Strengths, forms and routes that can't
+// be made sense of are left out.
+func readCatalog(r io.Reader) ([]models.Medication, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for field, names := range catalogColumns {
+		for _, name := range names {
+			i := columnIndex(header, name)
+			if i >= 0 {
+				columns[field] = i
+				break
+			}
+		}
+	}
+
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New("no name column")
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	medications := make([]models.Medication, 0)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		medication := models.Medication{
+			Name:  field(record, "name"),
+			Brand: field(record, "brand"),
+			Form:  catalogForm(field(record, "form")),
+			Route: catalogRoutes[strings.ToLower(field(record, "route"))],
+		}
+		if medication.Name == "" {
+			continue
+		}
+
+		if strength := strings.TrimSpace(field(record, "strength") + " " + field(record, "unit")); strength != "" {
+			medication.Strength, _ = manager.ParseStrength(strength)
+		}
+
+		medication.Generic = medication.Brand == ""
+		if generic := field(record, "generic"); generic != "" {
+			medication.Generic, err = strconv.ParseBool(generic)
+			if err != nil {
+				line, _ := reader.FieldPos(0)
+				return nil, fmt.Errorf("line %d: invalid generic %q", line, generic)
+			}
+		}
+
+		medications = append(medications, medication)
+	}
+
+	return medications, nil
+}
+
+// catalogForm picks the form out of a drug list's dosage form, e.g.
+// "TABLET, FILM COATED" is a tablet.
+func catalogForm(s string) models.DosageForm {
+	for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		if form, ok := catalogForms[word]; ok {
+			return form
+		}
+	}
+
+	return ""
+}
+
+func columnIndex(header []string, name string) int {
+	for i, column := range header {
+		column = strings.TrimPrefix(column, "\ufeff")
+		if strings.EqualFold(strings.TrimSpace(column), name) {
+			return i
+		}
+	}
+
+	return -1
+}
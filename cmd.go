@@ -1,29 +1,71 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	_ "embed"
 	"log/slog"
 	"net/http"
+	"os"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/kzs0/kokoro"
 	"github.com/kzs0/pill_manager/manager"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db"
 	"github.com/kzs0/pill_manager/models/db/sqlc"
 	"github.com/kzs0/pill_manager/pkg/middleware"
+	"github.com/kzs0/pill_manager/pkg/notify"
 )
 
 type Config struct {
-	Koko  kokoro.Config
-	Auth0 middleware.Auth0Config
+	Koko   kokoro.Config
+	Auth   middleware.AuthConfig
+	Admin  middleware.AdminConfig
+	DB     DBConfig
+	Sweep  SweepConfig
+	Remind RemindConfig
 }
 
-// TODO remove/turn into a job
-//
-//go:embed models/db/schema.sql
-var ddl string
+type DBConfig struct {
+	Path string `env:"DB_PATH" envDefault:"manager.db"`
+	// Apply pending migrations before serving
+	AutoMigrate bool `env:"DB_AUTO_MIGRATE" envDefault:"false"`
+}
+
+type SweepConfig struct {
+	// How often overdue doses are marked missed. If 0, they never are.
+	Interval time.Duration `env:"MISSED_SWEEP_INTERVAL" envDefault:"5m"`
+	// How long a dose can go unlogged, for prescriptions that don't say
+	Grace time.Duration `env:"MISSED_GRACE" envDefault:"4h"`
+}
+
+type RemindConfig struct {
+	// How often doses are checked for reminders. If 0, none are sent.
+	Interval time.Duration `env:"REMINDER_INTERVAL" envDefault:"1m"`
+	// How long before a dose is due its reminder goes out
+	Lead time.Duration `env:"REMINDER_LEAD" envDefault:"0s"`
+	// Remind again if a dose is still pending this long after a reminder.
+	// If 0, each dose is reminded about once.
+	Renotify     time.Duration `env:"REMINDER_RENOTIFY" envDefault:"15m"`
+	MaxReminders int           `env:"REMINDER_MAX" envDefault:"3"`
+	MaxOverdue   time.Duration `env:"REMINDER_MAX_OVERDUE" envDefault:"1h"`
+
+	WebhookSecret string `env:"WEBHOOK_SECRET"`
+
+	// If empty, email reminders are disabled
+	SMTPAddr     string `env:"SMTP_ADDR"`
+	SMTPFrom     string `env:"SMTP_FROM" envDefault:"reminders@localhost"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+
+	// If empty, web push reminders are disabled
+	VAPIDPublicKey  string `env:"VAPID_PUBLIC_KEY"`
+	VAPIDPrivateKey string `env:"VAPID_PRIVATE_KEY"`
+	VAPIDSubject    string `env:"VAPID_SUBJECT" envDefault:"mailto:reminders@localhost"`
+}
 
 func main() {
 	config := Config{}
@@ -32,6 +74,19 @@ func main() {
 		panic(err)
 	}
 
+	sqldb, err := sql.Open("sqlite3", config.DB.Path)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), sqldb, os.Args[2:]); err != nil {
+			slog.Error("migrate failed", slog.Any("err", err))
+			os.Exit(1)
+		}
+		return
+	}
+
 	_, done, err := kokoro.Init(kokoro.WithConfig(config.Koko))
 	defer done()
 	if err != nil {
@@ -39,21 +94,56 @@ func main() {
 		panic(err)
 	}
 
-	db, err := sql.Open("sqlite3", "manager.db")
-	if err != nil {
-		panic(err)
+	if config.DB.AutoMigrate {
+		applied, err := db.Up(context.Background(), sqldb)
+		if err != nil {
+			slog.Error("failed to apply migrations", slog.Any("err", err))
+			panic(err)
+		}
+
+		for _, m := range applied {
+			slog.Info("applied migration", "version", m.Version, "name", m.Name)
+		}
 	}
 
-	// if _, err := db.ExecContext(context.Background(), ddl); err != nil {
-	// 	panic(err)
-	// }
+	// Handlers are instrumented, so this runs once kokoro is up
+	if len(os.Args) > 1 && os.Args[1] == "catalog" {
+		if err := runCatalog(context.Background(), sqldb, os.Args[2:]); err != nil {
+			slog.Error("catalog failed", slog.Any("err", err))
+			os.Exit(1)
+		}
+		return
+	}
 
-	queries := sqlc.New(db)
+	queries := sqlc.New(sqldb)
 
 	handler := manager.Handler{
+		DB:      sqldb,
 		Queries: queries,
 	}
 
+	if config.Sweep.Interval > 0 {
+		sweeper := &manager.MissedDoseSweeper{
+			Handler:      &handler,
+			Interval:     config.Sweep.Interval,
+			DefaultGrace: config.Sweep.Grace,
+		}
+		go sweeper.Run(context.Background())
+	}
+
+	if config.Remind.Interval > 0 {
+		reminders := &manager.ReminderScheduler{
+			Handler:      &handler,
+			Notifiers:    notifiers(config.Remind),
+			Interval:     config.Remind.Interval,
+			Lead:         config.Remind.Lead,
+			Renotify:     config.Remind.Renotify,
+			MaxReminders: config.Remind.MaxReminders,
+			MaxOverdue:   config.Remind.MaxOverdue,
+		}
+		go reminders.Run(context.Background())
+	}
+
 	controller := manager.Controller{
 		Queries: queries,
 		Handler: &handler,
@@ -66,23 +156,84 @@ func main() {
 	mux.HandleFunc("GET /rx/{id}", controller.GetPerscription)
 	mux.HandleFunc("GET /rx/till_empty/{id}", controller.DosesTillEmpty)
 	mux.HandleFunc("GET /rx/till_refill/{id}", controller.DosesTillRefill)
+	mux.HandleFunc("GET /rx/as_needed/{id}", controller.GetAsNeeded)
 	mux.HandleFunc("POST /rx/taken/{id}", controller.PostTaken)
 	mux.HandleFunc("POST /rx/skipped/{id}", controller.PostSkipped)
+	mux.HandleFunc("POST /rx/snoozed/{id}", controller.PostSnoozed)
+	mux.HandleFunc("POST /rx/undo/{id}", controller.PostUndo)
+	mux.HandleFunc("PATCH /rx/dose/{id}", controller.PatchDose)
+	mux.HandleFunc("GET /rx/events/{id}", controller.GetDoseEvents)
+	mux.HandleFunc("GET /rx/inventory/{id}", controller.GetInventory)
+	mux.HandleFunc("POST /rx/inventory/{id}", controller.PostInventory)
+	mux.HandleFunc("POST /rx/refill/{id}", controller.PostRefill)
+	mux.HandleFunc("GET /rx/forecast/{id}", controller.GetRefillForecast)
+	mux.HandleFunc("GET /adherence", controller.GetAdherence)
+	mux.HandleFunc("GET /medications", controller.GetMedications)
 	mux.HandleFunc("POST /rx", controller.PostPerscription)
-	mux.HandleFunc("POST /user", controller.PostUser)
+	mux.HandleFunc("PATCH /rx/{id}", controller.PatchPerscription)
+	mux.HandleFunc("DELETE /rx/{id}", controller.DeletePerscription)
+	mux.HandleFunc("POST /rx/discontinued/{id}", controller.PostDiscontinued)
+	mux.HandleFunc("POST /rx/paused/{id}", controller.PostPaused)
+	mux.HandleFunc("POST /rx/resumed/{id}", controller.PostResumed)
+	mux.HandleFunc("POST /rx/as_needed/{id}", controller.PostAsNeeded)
+	mux.HandleFunc("PUT /user/timezone", controller.PutTimeZone)
+	mux.HandleFunc("GET /user/notifiers", controller.GetNotificationTargets)
+	mux.HandleFunc("POST /user/notifiers", controller.PostNotificationTarget)
+	mux.HandleFunc("DELETE /user/notifiers/{id}", controller.DeleteNotificationTarget)
+	mux.HandleFunc("GET /user/preferences", controller.GetPreferences)
+	mux.HandleFunc("PUT /user/preferences", controller.PutPreferences)
+	mux.HandleFunc("DELETE /user/preferences", controller.DeletePreferences)
+	mux.HandleFunc("GET /user/invites", controller.GetInvites)
+	mux.HandleFunc("POST /user/invites", controller.PostInvite)
+	mux.HandleFunc("GET /user/keys", controller.GetAPIKeys)
+	mux.HandleFunc("POST /user/keys", controller.PostAPIKey)
+	mux.HandleFunc("DELETE /user/keys/{id}", controller.DeleteAPIKey)
+	mux.HandleFunc("GET /patients", controller.GetPatients)
+	mux.HandleFunc("POST /patients", controller.PostPatient)
+	mux.HandleFunc("PUT /patients/timezone/{id}", controller.PutPatientTimeZone)
+	mux.HandleFunc("GET /patients/caregivers/{id}", controller.GetCaregivers)
+	mux.HandleFunc("PUT /patients/caregivers/{id}", controller.PutCaregiver)
+	mux.HandleFunc("DELETE /patients/caregivers/{id}/{user}", controller.DeleteCaregiver)
 	mux.HandleFunc("OPTIONS /rx", controller.Options)
 
 	// wrappedMux := middleware.HttpOperation(ctx, mux)
 
 	opts := &middleware.CORSOptions{
 		Origin:  []string{"*"},
-		Methods: []string{"GET", "POST", "OPTIONS"},
+		Methods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		Headers: []string{"Content-Type", "Authorization"},
 	}
 
-	approvedMux := middleware.BlockUnapprovedUsers(mux, queries)
-	userMux := middleware.ObserveNewUsers(approvedMux, queries)
-	jwtMux := middleware.EnsureValidToken(userMux, config.Auth0)
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("GET /admin/users/pending", controller.GetPendingUsers)
+	adminMux.HandleFunc("POST /admin/users/approved/{id}", controller.PostApproved)
+	adminMux.HandleFunc("POST /admin/users/denied/{id}", controller.PostDenied)
+	adminMux.HandleFunc("POST /admin/users/revoked/{id}", controller.PostRevoked)
+	adminMux.HandleFunc("GET /admin/users/decisions/{id}", controller.GetUserDecisions)
+	adminMux.HandleFunc("GET /admin/invites", controller.GetInvites)
+	adminMux.HandleFunc("POST /admin/invites", controller.PostInvite)
+
+	// Admins don't have to be approved to use the admin API, and new users
+	// redeem invites to be approved
+	rootMux := http.NewServeMux()
+	rootMux.Handle("/admin/", middleware.RequireAdmin(adminMux, config.Admin))
+	rootMux.HandleFunc("POST /user/redeem", controller.PostRedeem)
+	rootMux.Handle("/", middleware.BlockUnapprovedUsers(mux, queries))
+
+	// API keys are for scripts logging and looking up doses, so they can't
+	// do anything else
+	keyMux := middleware.LimitAPIKeys(rootMux, "/rx")
+
+	// Users, and the patients they are, are created on their first request
+	userMux := middleware.ObserveNewUsers(keyMux, sqldb)
+	auth, err := middleware.NewAuthenticator(config.Auth)
+	if err != nil {
+		slog.Error("failed to set up authentication", slog.Any("err", err))
+		panic(err)
+	}
+
+	auth = middleware.WithAPIKeys(auth, &handler)
+	jwtMux := middleware.EnsureValidToken(userMux, auth)
 	corsMux := middleware.CORS(jwtMux, opts)
 
 	if err := http.ListenAndServe(":8080", corsMux); err != nil {
@@ -90,3 +241,33 @@ func main() {
 		panic(err)
 	}
 }
+
+// notifiers sets up a notifier for each reminder channel that is configured.
+func notifiers(cfg RemindConfig) map[models.Channel]notify.Notifier {
+	notifiers := map[models.Channel]notify.Notifier{
+		models.ChannelWebhook: &notify.Webhook{
+			Client: notify.PublicClient(10 * time.Second),
+			Secret: cfg.WebhookSecret,
+		},
+	}
+
+	if cfg.SMTPAddr != "" {
+		notifiers[models.ChannelEmail] = &notify.SMTP{
+			Addr:     cfg.SMTPAddr,
+			From:     cfg.SMTPFrom,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		}
+	}
+
+	if cfg.VAPIDPublicKey != "" && cfg.VAPIDPrivateKey != "" {
+		notifiers[models.ChannelWebPush] = &notify.WebPush{
+			Client:          notify.PublicClient(10 * time.Second),
+			VAPIDPublicKey:  cfg.VAPIDPublicKey,
+			VAPIDPrivateKey: cfg.VAPIDPrivateKey,
+			Subject:         cfg.VAPIDSubject,
+		}
+	}
+
+	return notifiers
+}
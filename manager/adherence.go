@@ -0,0 +1,214 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+const defaultOnTimeTolerance = time.Hour
+
+type doseOutcome int
+
+const (
+	outcomePending doseOutcome = iota
+	outcomeOnTime
+	outcomeEarly
+	outcomeLate
+	outcomeSkipped
+	outcomeMissed
+)
+
+// Adherence reports what became of the patient's doses due from from until
+// to, across every prescription or only rx if it isn't empty. As needed
+// doses are never due, so they aren't counted.
+func (h *Handler) Adherence(ctx context.Context, acc Access, from, to time.Time, rx string) (_ *models.Adherence, err error) {
+	ctx, done := koko.Operation(ctx, "handler_adherence")
+	defer done(&ctx, &err)
+
+	home, err := patientTimeZone(ctx, h.Queries, acc.Patient)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := scheduleLocation(models.Schedule{}, home, time.UTC)
+	if err != nil {
+		return nil, err
+	}
+
+	params := sqlc.GetDosesInRangeParams{
+		Patient: acc.Patient,
+		Since:   from.Unix(),
+		Until:   to.Unix(),
+	}
+	if rx != "" {
+		_, _, err = h.patientRegimen(ctx, h.Queries, rx, acc.Patient)
+		if err != nil {
+			return nil, err
+		}
+		params.PrescriptionID = rx
+	}
+
+	rows, err := h.Queries.GetDosesInRange(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return adherence(rows, from, to, loc)
+}
+
+// adherence tallies rows, ordered by time. Days are split in loc.
+func adherence(rows []sqlc.GetDosesInRangeRow, from, to time.Time, loc *time.Location) (*models.Adherence, error) {
+	report := &models.Adherence{
+		From:        from,
+		To:          to,
+		Medications: make([]models.MedicationAdherence, 0),
+		Days:        make([]models.DailyAdherence, 0),
+	}
+
+	asNeeded := make(map[string]bool)
+	byRx := make(map[string]int)
+	streaks := make(map[string]int)
+
+	for _, row := range rows {
+		prn, ok := asNeeded[row.PrescriptionID]
+		if !ok {
+			var schedule models.Schedule
+			err := json.Unmarshal(row.Schedule, &schedule)
+			if err != nil {
+				return nil, err
+			}
+
+			prn = schedule.Kind == models.ScheduleAsNeeded
+			asNeeded[row.PrescriptionID] = prn
+		}
+		if prn {
+			continue
+		}
+
+		outcome := classifyDose(row)
+
+		i, ok := byRx[row.PrescriptionID]
+		if !ok {
+			i = len(report.Medications)
+			byRx[row.PrescriptionID] = i
+			report.Medications = append(report.Medications, models.MedicationAdherence{
+				PrescriptionID: row.PrescriptionID,
+				Medication: models.Medication{
+					ID:       row.ID_2,
+					Name:     row.Name,
+					Generic:  row.Generic,
+					Brand:    row.Brand,
+					Strength: toStrength(row.StrengthValue, row.StrengthUnit),
+					Form:     models.DosageForm(row.Form),
+					Route:    models.Route(row.Route),
+				},
+			})
+		}
+
+		med := &report.Medications[i]
+		tally(&med.AdherenceCounts, outcome, row.Snoozes)
+
+		switch outcome {
+		case outcomeOnTime, outcomeEarly, outcomeLate:
+			streaks[row.PrescriptionID]++
+			med.LongestStreak = max(med.LongestStreak, streaks[row.PrescriptionID])
+		case outcomeSkipped, outcomeMissed:
+			streaks[row.PrescriptionID] = 0
+		}
+
+		// Rows are in time order, so each day's doses are together
+		date := time.Unix(row.Time, 0).In(loc).Format(time.DateOnly)
+		if len(report.Days) == 0 || report.Days[len(report.Days)-1].Date != date {
+			report.Days = append(report.Days, models.DailyAdherence{Date: date})
+		}
+		tally(&report.Days[len(report.Days)-1].AdherenceCounts, outcome, row.Snoozes)
+
+		tally(&report.AdherenceCounts, outcome, row.Snoozes)
+	}
+
+	streak := 0
+	for _, day := range report.Days {
+		if day.Due == 0 {
+			// Nothing was due, which doesn't break a streak
+			continue
+		}
+
+		if taken(day.AdherenceCounts) == day.Due {
+			streak++
+			report.LongestStreak = max(report.LongestStreak, streak)
+		} else {
+			streak = 0
+		}
+	}
+
+	return report, nil
+}
+
+// classifyDose decides what became of a dose. Doses stay pending until
+// they are logged or the sweeper marks them missed.
+func classifyDose(row sqlc.GetDosesInRangeRow) doseOutcome {
+	tolerance := defaultOnTimeTolerance
+	if row.OnTimeTolerance.Valid {
+		tolerance = time.Duration(row.OnTimeTolerance.Int64) * time.Second
+	}
+
+	due := time.Unix(row.Time, 0)
+
+	switch {
+	case row.Taken.Valid && !row.Taken.Bool:
+		return outcomeSkipped
+	case row.Taken.Valid:
+		if !row.TimeTaken.Valid {
+			return outcomeOnTime
+		}
+
+		off := time.Unix(row.TimeTaken.Int64, 0).Sub(due)
+		if off < -tolerance {
+			return outcomeEarly
+		}
+		if off > tolerance {
+			return outcomeLate
+		}
+		return outcomeOnTime
+	case row.MissedAt.Valid:
+		return outcomeMissed
+	default:
+		return outcomePending
+	}
+}
+
+func tally(counts *models.AdherenceCounts, outcome doseOutcome, snoozes int64) {
+	counts.Snoozes += int(snoozes)
+
+	switch outcome {
+	case outcomeOnTime:
+		counts.OnTime++
+	case outcomeEarly:
+		counts.Early++
+	case outcomeLate:
+		counts.Late++
+	case outcomeSkipped:
+		counts.Skipped++
+	case outcomeMissed:
+		counts.Missed++
+	case outcomePending:
+		counts.Pending++
+	}
+
+	counts.Due = taken(*counts) + counts.Skipped + counts.Missed
+	if counts.Due > 0 {
+		percent := float64(taken(*counts)) / float64(counts.Due) * 100
+		counts.Adherence = math.Round(percent*100) / 100
+	}
+}
+
+// taken is how many of the due doses were taken, whenever they were.
+func taken(counts models.AdherenceCounts) int {
+	return counts.OnTime + counts.Early + counts.Late
+}
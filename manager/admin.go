@@ -0,0 +1,161 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+// The statuses an admin's decision can move a user from
+var decisionsFrom = map[models.UserStatus][]models.UserStatus{
+	models.UserApproved: {models.UserPending, models.UserDenied, models.UserRevoked},
+	models.UserDenied:   {models.UserPending},
+	models.UserRevoked:  {models.UserApproved},
+}
+
+// PendingUsers returns the users waiting to be approved, oldest first.
+func (h *Handler) PendingUsers(ctx context.Context) (_ []models.User, err error) {
+	ctx, done := koko.Operation(ctx, "handler_pending_users")
+	defer done(&ctx, &err)
+
+	rows, err := h.Queries.GetUsersByStatus(ctx, string(models.UserPending))
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]models.User, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, *toUser(row))
+	}
+
+	return users, nil
+}
+
+// DecideUser records admin approving, denying or revoking the user id.
+// Pending users can be approved or denied, approved users revoked, and
+// denied or revoked users approved after all. Anything else is
+// ErrConflict.
+func (h *Handler) DecideUser(ctx context.Context, admin string, id string, decision models.UserStatus, reason string) (_ *models.User, err error) {
+	ctx, done := koko.Operation(ctx, "handler_decide_user")
+	defer done(&ctx, &err)
+
+	from, ok := decisionsFrom[decision]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown decision %q", ErrInvalid, decision)
+	}
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	user, err := q.GetUser(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(from, models.UserStatus(user.Status)) {
+		return nil, fmt.Errorf("%w: user is %s", ErrConflict, user.Status)
+	}
+
+	params := sqlc.SetUserStatusParams{
+		Status:  string(decision),
+		ID:      id,
+		Current: user.Status,
+	}
+	updated, err := q.SetUserStatus(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if updated == 0 {
+		return nil, fmt.Errorf("%w: user was changed by someone else", ErrConflict)
+	}
+
+	decisionParams := sqlc.CreateUserDecisionParams{
+		ID:       uuid.NewString(),
+		UserID:   id,
+		Decision: string(decision),
+		Reason:   reason,
+		Actor:    admin,
+		Time:     time.Now().Unix(),
+	}
+	_, err = q.CreateUserDecision(ctx, decisionParams)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("user decided", "uid", id, "decision", decision, "admin", admin)
+
+	user.Status = string(decision)
+	user.Approved = decision == models.UserApproved
+
+	return toUser(user), nil
+}
+
+// UserDecisions returns the decisions made about the user id, oldest first.
+func (h *Handler) UserDecisions(ctx context.Context, id string) (_ []models.UserDecision, err error) {
+	ctx, done := koko.Operation(ctx, "handler_user_decisions")
+	defer done(&ctx, &err)
+
+	_, err = h.Queries.GetUser(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := h.Queries.GetUserDecisions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := make([]models.UserDecision, 0, len(rows))
+	for _, row := range rows {
+		decisions = append(decisions, models.UserDecision{
+			ID:       row.ID,
+			User:     row.UserID,
+			Decision: models.UserStatus(row.Decision),
+			Reason:   row.Reason,
+			Actor:    row.Actor,
+			Time:     time.Unix(row.Time, 0),
+		})
+	}
+
+	return decisions, nil
+}
+
+func toUser(user sqlc.User) *models.User {
+	u := &models.User{
+		ID:       user.ID,
+		TimeZone: user.TimeZone,
+		Status:   models.UserStatus(user.Status),
+	}
+	if user.CreatedAt.Valid {
+		createdAt := time.Unix(user.CreatedAt.Int64, 0)
+		u.CreatedAt = &createdAt
+	}
+
+	return u
+}
@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+// Access is a user acting on a patient's records, who may be themselves.
+// Handlers trust it, so it only comes from Authorize.
+type Access struct {
+	// Recorded as the actor of whatever the user does
+	User    string
+	Patient string
+}
+
+var grantLevels = map[models.Grant]int{
+	models.GrantView:   1,
+	models.GrantLog:    2,
+	models.GrantManage: 3,
+}
+
+// Authorize checks that user can act on patient with grant and returns
+// their access. Users can do anything for themselves and the patients they
+// own, so an empty patient is the user. Patients the user has no grant for
+// are reported as ErrNotFound, and grants too weak for what's asked as
+// ErrForbidden.
+func (h *Handler) Authorize(ctx context.Context, user string, patient string, grant models.Grant) (_ Access, err error) {
+	ctx, done := koko.Operation(ctx, "handler_authorize")
+	defer done(&ctx, &err)
+
+	if patient == "" || patient == user {
+		return Access{User: user, Patient: user}, nil
+	}
+
+	row, err := h.Queries.GetPatient(ctx, patient)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Access{}, ErrNotFound
+	}
+	if err != nil {
+		return Access{}, err
+	}
+
+	if row.Owner == user {
+		return Access{User: user, Patient: patient}, nil
+	}
+
+	params := sqlc.GetCaregiverParams{
+		PatientID: patient,
+		UserID:    user,
+	}
+	caregiver, err := h.Queries.GetCaregiver(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Access{}, ErrNotFound
+	}
+	if err != nil {
+		return Access{}, err
+	}
+
+	if grantLevels[models.Grant(caregiver.GrantLevel)] < grantLevels[grant] {
+		return Access{}, fmt.Errorf("%w: %s access to the patient is needed", ErrForbidden, grant)
+	}
+
+	return Access{User: user, Patient: patient}, nil
+}
+
+// patientTimeZone is the zone the patient lives in, their own if they log
+// in, or empty if it isn't known.
+func patientTimeZone(ctx context.Context, q *sqlc.Queries, patient string) (string, error) {
+	row, err := q.GetPatient(ctx, patient)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return row.TimeZone, nil
+}
+
+// Lookups of a patient's prescriptions, regimens and doses by id go through
+// the helpers below. Each one joins back to the owning patient, so something
+// that belongs to another patient is reported as ErrNotFound, the same as
+// something that doesn't exist.
+
+// patientRegimen looks up the prescription id owned by patient and its
+// regimen.
+func (h *Handler) patientRegimen(ctx context.Context, q *sqlc.Queries, id string, patient string) (sqlc.Prescription, sqlc.Regimen, error) {
+	rxParams := sqlc.GetRxByPatientParams{
+		ID:      id,
+		Patient: patient,
+	}
+	prescription, err := q.GetRxByPatient(ctx, rxParams)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sqlc.Prescription{}, sqlc.Regimen{}, ErrNotFound
+	}
+	if err != nil {
+		return sqlc.Prescription{}, sqlc.Regimen{}, err
+	}
+
+	regimen, err := q.GetRegimenByRx(ctx, prescription.ID)
+	if err != nil {
+		return sqlc.Prescription{}, sqlc.Regimen{}, err
+	}
+
+	return prescription, regimen, nil
+}
+
+// patientRegimenByID looks up the regimen id owned by patient.
+func patientRegimenByID(ctx context.Context, q *sqlc.Queries, id string, patient string) (sqlc.Regimen, error) {
+	params := sqlc.GetRegimenByPatientParams{
+		ID:      id,
+		Patient: patient,
+	}
+	regimen, err := q.GetRegimenByPatient(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return regimen, ErrNotFound
+	}
+
+	return regimen, err
+}
+
+// patientDose looks up the dose id owned by patient along with its
+// prescription's schedule.
+func patientDose(ctx context.Context, q *sqlc.Queries, id string, patient string) (sqlc.GetDoseByPatientRow, error) {
+	params := sqlc.GetDoseByPatientParams{
+		ID:      id,
+		Patient: patient,
+	}
+	row, err := q.GetDoseByPatient(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return row, ErrNotFound
+	}
+
+	return row, err
+}
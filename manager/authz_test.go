@@ -0,0 +1,311 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+// newTestHandler returns a handler over a new database in a temp dir with
+// every migration applied.
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+
+	sqldb, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqldb.Close() })
+
+	_, err = db.Up(context.Background(), sqldb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Handler{
+		DB:      sqldb,
+		Queries: sqlc.New(sqldb),
+	}
+}
+
+// newTestUser creates the user uid and the patient they are, the way a
+// user's first request does.
+func newTestUser(t *testing.T, h *Handler, uid string) Access {
+	t.Helper()
+
+	ctx := context.Background()
+
+	_, err := h.Queries.CreateUser(ctx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := sqlc.CreateUserPatientParams{
+		ID:        uid,
+		CreatedAt: time.Now().Unix(),
+	}
+	err = h.Queries.CreateUserPatient(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Access{User: uid, Patient: uid}
+}
+
+// newTestRx prescribes a tablet every 8 hours to the patient from start and
+// returns it with its pending doses.
+func newTestRx(t *testing.T, h *Handler, acc Access, start time.Time) (*models.Prescription, []models.Dose) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	rx := &models.Prescription{
+		Medication: models.Medication{Name: "Ibuprofen"},
+		Schedule: models.Schedule{
+			Period: models.Duration{Duration: 8 * time.Hour},
+			Doses: []models.ScheduledDose{
+				{Amount: 1, Unit: "tablet"},
+			},
+		},
+		ScheduleStart: &start,
+		Doses:         10,
+	}
+	rx, err := h.NewPerscription(ctx, rx, acc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	regimens, err := h.GetScheduledDoses(ctx, acc, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, regimen := range regimens {
+		if len(regimen.Doses) > 0 {
+			return rx, regimen.Doses
+		}
+	}
+
+	t.Fatal("prescription has no scheduled doses")
+	return nil, nil
+}
+
+func TestCrossUserAccess(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t)
+
+	alice := newTestUser(t, h, "alice")
+	bob := newTestUser(t, h, "bob")
+
+	rx, doses := newTestRx(t, h, alice, time.Now().Add(time.Minute))
+
+	// A logged dose, so undoing it would work for alice
+	err := h.MarkDoseTaken(ctx, doses[0].ID, alice, true, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending := doses[1].ID
+	doses2 := 20
+	until := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"read", func() error {
+			_, err := h.GetPerscription(ctx, rx.ID, bob)
+			return err
+		}},
+		{"doses till empty", func() error {
+			_, err := h.DosesTillEmpty(ctx, rx.ID, bob)
+			return err
+		}},
+		{"patch", func() error {
+			_, err := h.UpdatePerscription(ctx, rx.ID, bob, &models.PrescriptionPatch{Doses: &doses2})
+			return err
+		}},
+		{"discontinue", func() error {
+			_, err := h.DiscontinuePerscription(ctx, rx.ID, bob, time.Now(), "")
+			return err
+		}},
+		{"pause", func() error {
+			return h.PauseRegimen(ctx, rx.ID, bob, time.Now())
+		}},
+		{"delete", func() error {
+			return h.DeletePerscription(ctx, rx.ID, bob)
+		}},
+		{"take", func() error {
+			return h.MarkDoseTaken(ctx, pending, bob, true, time.Now())
+		}},
+		{"skip", func() error {
+			return h.MarkDoseTaken(ctx, pending, bob, false, time.Now())
+		}},
+		{"snooze", func() error {
+			_, err := h.SnoozeDose(ctx, pending, bob, &until)
+			return err
+		}},
+		{"undo", func() error {
+			return h.UndoDose(ctx, doses[0].ID, bob)
+		}},
+		{"edit", func() error {
+			_, err := h.EditDose(ctx, doses[0].ID, bob, &models.DoseEdit{})
+			return err
+		}},
+		{"dose events", func() error {
+			_, err := h.DoseEvents(ctx, doses[0].ID, bob)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("got %v, want ErrNotFound", err)
+			}
+		})
+	}
+
+	// None of it should have touched alice's records
+	got, err := h.GetPerscription(ctx, rx.ID, alice)
+	if err != nil {
+		t.Fatalf("alice can't read her prescription: %v", err)
+	}
+	if got.Doses != rx.Doses || got.DiscontinuedAt != nil {
+		t.Errorf("prescription changed: %+v", got)
+	}
+
+	row, err := patientDose(ctx, h.Queries, pending, alice.Patient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Taken.Valid || row.SnoozedUntil.Valid {
+		t.Errorf("pending dose was logged or snoozed: %+v", row)
+	}
+
+	row, err = patientDose(ctx, h.Queries, doses[0].ID, alice.Patient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !row.Taken.Valid {
+		t.Error("logged dose was undone")
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t)
+
+	alice := newTestUser(t, h, "alice")
+	newTestUser(t, h, "bob")
+	newTestUser(t, h, "carol")
+
+	_, err := h.SetCaregiver(ctx, alice.User, alice.Patient, &models.Caregiver{User: "bob", Grant: models.GrantView})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		user  string
+		grant models.Grant
+		want  error
+	}{
+		{"owner manages", "alice", models.GrantManage, nil},
+		{"caregiver views", "bob", models.GrantView, nil},
+		{"caregiver can't log", "bob", models.GrantLog, ErrForbidden},
+		{"caregiver can't manage", "bob", models.GrantManage, ErrForbidden},
+		{"stranger can't view", "carol", models.GrantView, ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acc, err := h.Authorize(ctx, tt.user, alice.Patient, tt.grant)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("got %v, want access", err)
+				}
+				if acc.User != tt.user || acc.Patient != alice.Patient {
+					t.Errorf("got %+v", acc)
+				}
+				return
+			}
+
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("unknown patient", func(t *testing.T) {
+		_, err := h.Authorize(ctx, "alice", "nobody", models.GrantView)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+// The controllers report what Authorize and the handlers return as 404s and
+// 403s.
+func TestAccessStatus(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t)
+	c := &Controller{Queries: h.Queries, Handler: h}
+
+	alice := newTestUser(t, h, "alice")
+	newTestUser(t, h, "bob")
+	newTestUser(t, h, "carol")
+
+	_, err := h.SetCaregiver(ctx, alice.User, alice.Patient, &models.Caregiver{User: "bob", Grant: models.GrantView})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, doses := newTestRx(t, h, alice, time.Now().Add(time.Minute))
+	body := `{"time":"` + time.Now().Format(time.RFC3339) + `"}`
+
+	tests := []struct {
+		name  string
+		user  string
+		query string
+		want  int
+	}{
+		{"other user's dose", "carol", "", http.StatusNotFound},
+		{"other user's patient", "carol", "?patient=alice", http.StatusNotFound},
+		{"caregiver's grant is too weak", "bob", "?patient=alice", http.StatusForbidden},
+		{"owner", "alice", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/rx/taken/"+doses[0].ID+tt.query, strings.NewReader(body))
+			r.SetPathValue("id", doses[0].ID)
+			claims := &validator.ValidatedClaims{
+				RegisteredClaims: validator.RegisteredClaims{Subject: tt.user},
+			}
+			r = r.WithContext(context.WithValue(r.Context(), jwtmiddleware.ContextKey{}, claims))
+
+			w := httptest.NewRecorder()
+			c.PostTaken(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
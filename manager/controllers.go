@@ -1,7 +1,9 @@
 package manager
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -11,11 +13,11 @@ import (
 
 	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
 	"github.com/auth0/go-jwt-middleware/v2/validator"
-	"github.com/google/uuid"
 	"github.com/kzs0/kokoro/koko"
 	"github.com/kzs0/kokoro/telemetry/metrics"
 	"github.com/kzs0/pill_manager/models"
 	"github.com/kzs0/pill_manager/models/db/sqlc"
+	"github.com/kzs0/pill_manager/pkg/middleware"
 )
 
 type Controller struct {
@@ -37,7 +39,12 @@ func (c *Controller) GetRemainingDoses(w http.ResponseWriter, r *http.Request) {
 
 	uid := claims.RegisteredClaims.Subject
 
-	doses, err := c.Handler.GetScheduledDoses(ctx, uid, 1000)
+	acc, err := c.access(ctx, w, r, uid, models.GrantView)
+	if err != nil {
+		return
+	}
+
+	doses, err := c.Handler.GetScheduledDoses(ctx, acc, 1000)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -71,6 +78,11 @@ func (c *Controller) GetLimitedRemainingDoses(w http.ResponseWriter, r *http.Req
 
 	uid := claims.RegisteredClaims.Subject
 
+	acc, err := c.access(ctx, w, r, uid, models.GrantView)
+	if err != nil {
+		return
+	}
+
 	countS := r.PathValue("count")
 	if countS == "" {
 		w.WriteHeader(http.StatusBadRequest)
@@ -83,7 +95,7 @@ func (c *Controller) GetLimitedRemainingDoses(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	doses, err := c.Handler.GetScheduledDoses(ctx, uid, int(count))
+	doses, err := c.Handler.GetScheduledDoses(ctx, acc, int(count))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -108,52 +120,37 @@ func (c *Controller) GetPerscription(w http.ResponseWriter, r *http.Request) {
 	var err error
 	defer done(&ctx, &err)
 
-	id := r.PathValue("id")
-	if id == "" {
-		w.WriteHeader(http.StatusBadRequest)
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	rxdb, err := c.Queries.GetRx(ctx, id)
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantView)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	sch := models.Schedule{}
-	err = json.Unmarshal(rxdb.Schedule, &sch)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	var start *time.Time
-	if rxdb.ScheduledStart.Valid {
-		s := time.Unix(rxdb.ScheduledStart.Int64, 0)
-		start = &s
+	rx, err := c.Handler.GetPerscription(ctx, id, acc)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
-
-	medicationdb, err := c.Queries.GetMedication(ctx, rxdb.MedicationID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	rx := models.Prescription{
-		ID: rxdb.ID,
-		Medication: models.Medication{
-			ID:      medicationdb.ID,
-			Name:    medicationdb.Name,
-			Generic: medicationdb.Generic,
-			Brand:   medicationdb.Brand,
-		},
-		Schedule:      sch,
-		Doses:         int(rxdb.Doses),
-		Refills:       int(rxdb.Refills),
-		ScheduleStart: start,
-	}
-
-	payload, err := json.Marshal(&rx)
+	payload, err := json.Marshal(rx)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -181,6 +178,11 @@ func (c *Controller) PostPerscription(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	acc, err := c.access(ctx, w, r, uid, models.GrantManage)
+	if err != nil {
+		return
+	}
+
 	payload, err := io.ReadAll(r.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -196,13 +198,15 @@ func (c *Controller) PostPerscription(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// TODO defaults
-	if rx.Schedule.Period.Duration == 0 {
-		rx.Schedule.Period = models.Duration{Duration: time.Hour * 24} // 1 day
-	}
+	scheduleDefaults(&rx.Schedule)
 
-	rx, err = c.Handler.NewPerscription(ctx, rx, uid)
+	rx, err = c.Handler.NewPerscription(ctx, rx, acc)
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		slog.Error("err %+v", err)
+		slog.Error("failed to create rx", "err", err)
 
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -218,196 +222,2207 @@ func (c *Controller) PostPerscription(w http.ResponseWriter, r *http.Request) {
 	w.Write(payload)
 }
 
-func (c *Controller) DosesTillEmpty(w http.ResponseWriter, r *http.Request) {
-	ctx, done := koko.Operation(r.Context(), "doses_till_empty")
+func (c *Controller) PatchPerscription(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "patch_perscription")
 	var err error
 	defer done(&ctx, &err)
 
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+	if uid == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantManage)
+	if err != nil {
+		return
+	}
+
 	id := r.PathValue("id")
 	if id == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	doses, err := c.Queries.DosesTillEmpty(ctx, id)
+	payload, err := io.ReadAll(r.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	w.Write([]byte(fmt.Sprintf(`{"doses": %d}`, doses)))
-}
-
-func (c *Controller) DosesTillRefill(w http.ResponseWriter, r *http.Request) {
-	ctx, done := koko.Operation(r.Context(), "doses_till_refill")
-	var err error
-	defer done(&ctx, &err)
-
-	id := r.PathValue("id")
-	if id == "" {
+	patch := &models.PrescriptionPatch{}
+	err = json.Unmarshal(payload, patch)
+	if err != nil {
+		slog.Warn("failed to unmarshal rx patch", "err", err, "payload", string(payload))
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	arg := sqlc.DosesTillRefillParams{
-		RegimenID:   id,
-		RegimenID_2: id,
+	if patch.Schedule != nil {
+		scheduleDefaults(patch.Schedule)
+	}
+
+	rx, err := c.Handler.UpdatePerscription(ctx, id, acc, patch)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	doses, err := c.Queries.DosesTillRefill(ctx, arg)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		slog.Error("failed to update rx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	w.Write([]byte(fmt.Sprintf(`{"doses": %d}`, doses)))
+	payload, err = json.Marshal(rx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
 }
 
-func (c *Controller) PostUser(w http.ResponseWriter, r *http.Request) {
-	ctx, done := koko.Operation(r.Context(), "post_user")
+func (c *Controller) PostDiscontinued(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_discontinued")
 	var err error
 	defer done(&ctx, &err)
 
-	payload, err := io.ReadAll(r.Body)
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantManage)
 	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	user := &models.User{}
-	err = json.Unmarshal(payload, user)
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	userdb, err := c.Queries.CreateUser(ctx, uuid.NewString())
+	payload := make(map[string]string, 2)
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &payload)
+		if err != nil {
+			slog.Error("failed to unmarshal payload", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	end := time.Now()
+	if payload["time"] != "" {
+		end, err = time.Parse(time.RFC3339, payload["time"])
+		if err != nil {
+			slog.Warn("failed to parse time", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	rx, err := c.Handler.DiscontinuePerscription(ctx, id, acc, end, payload["reason"])
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	payload, err = json.Marshal(&userdb)
+	resp, err := json.Marshal(rx)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Add("Content-Type", "application/json")
-	w.Write(payload)
+	w.Write(resp)
 }
 
-func (c *Controller) PostTaken(w http.ResponseWriter, r *http.Request) {
-	ctx, done := koko.Operation(r.Context(), "post_taken")
+func (c *Controller) DeletePerscription(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "delete_perscription")
 	var err error
 	defer done(&ctx, &err)
 
-	id := r.PathValue("id")
-	if id == "" {
-		w.WriteHeader(http.StatusBadRequest)
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantManage)
 	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	payload := make(map[string]string, 1)
-	err = json.Unmarshal(body, &payload)
+	err = c.Handler.DeletePerscription(ctx, id, acc)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		slog.Error("failed to unmarshal payload", "err", err)
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if len(payload) == 0 || len(payload) > 1 {
-		slog.Warn("incorrect keys", "num_keys", len(payload))
-		w.WriteHeader(http.StatusBadRequest)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Controller) PostPaused(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_paused")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	t, err := time.Parse(time.RFC3339, payload["time"])
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantManage)
 	if err != nil {
-		slog.Warn("failed to parse time", "err", err)
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	err = c.Handler.MarkDoseTaken(ctx, id, true, t)
+	err = c.Handler.PauseRegimen(ctx, id, acc, time.Now())
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
-func (c *Controller) PostSkipped(w http.ResponseWriter, r *http.Request) {
-	ctx, done := koko.Operation(r.Context(), "post_skipped")
+func (c *Controller) PostResumed(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_resumed")
 	var err error
 	defer done(&ctx, &err)
 
-	id := r.PathValue("id")
-	if id == "" {
-		w.WriteHeader(http.StatusBadRequest)
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantManage)
 	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	payload := make(map[string]string, 1)
-	err = json.Unmarshal(body, &payload)
+	err = c.Handler.ResumeRegimen(ctx, id, acc, time.Now())
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
-		slog.Error("failed to unmarshal payload", "err", err)
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+}
 
-	if len(payload) == 0 || len(payload) > 1 {
-		slog.Warn("incorrect keys", "num_keys", len(payload))
-		w.WriteHeader(http.StatusBadRequest)
+func (c *Controller) DosesTillEmpty(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "doses_till_empty")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	t, err := time.Parse(time.RFC3339, payload["time"])
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantView)
 	if err != nil {
-		slog.Warn("failed to parse time", "err", err)
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	err = c.Handler.MarkDoseTaken(ctx, id, false, t)
+	doses, err := c.Handler.DosesTillEmpty(ctx, id, acc)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+
+	w.Write([]byte(fmt.Sprintf(`{"doses": %d}`, doses)))
 }
 
-func (c *Controller) GetRoot(w http.ResponseWriter, r *http.Request) {
-	ctx, done := koko.Operation(r.Context(), "get_root", metrics.WithLabelNames("test"))
+func (c *Controller) DosesTillRefill(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "doses_till_refill")
 	var err error
 	defer done(&ctx, &err)
 
-	w.WriteHeader(http.StatusOK)
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantView)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	doses, err := c.Handler.DosesTillRefill(ctx, id, acc)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Write([]byte(fmt.Sprintf(`{"doses": %d}`, doses)))
 }
 
-func (c *Controller) Options(w http.ResponseWriter, r *http.Request) {
-	ctx, done := koko.Operation(r.Context(), "cors_options")
+func (c *Controller) GetAsNeeded(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_as_needed")
 	var err error
 	defer done(&ctx, &err)
 
-	enableCORS(w, r)
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantView)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	status, err := c.Handler.AsNeededStatus(ctx, id, acc, time.Now())
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(status)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) PostAsNeeded(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_as_needed")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantLog)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	dose := models.AsNeededDose{}
+	err = json.Unmarshal(body, &dose)
+	if err != nil {
+		slog.Warn("failed to unmarshal dose", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if dose.Time.IsZero() {
+		dose.Time = time.Now()
+	}
+
+	status, err := c.Handler.LogAsNeededDose(ctx, id, acc, dose)
+	code := http.StatusOK
+	switch {
+	case errors.Is(err, ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case errors.Is(err, ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrConflict) && status == nil:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, ErrConflict):
+		// The status explains which limits the dose broke
+		code = http.StatusConflict
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(status)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(payload)
+}
+
+func (c *Controller) PutTimeZone(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "put_time_zone")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	user := &models.User{}
+	err = json.Unmarshal(body, user)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	user, moved, err := c.Handler.SetTimeZone(ctx, uid, user.TimeZone)
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := struct {
+		models.User
+		Reanchored int
+	}{
+		User:       *user,
+		Reanchored: moved,
+	}
+
+	payload, err := json.Marshal(&resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) PostTaken(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_taken")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantLog)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	payload := make(map[string]string, 1)
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		slog.Error("failed to unmarshal payload", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if len(payload) == 0 || len(payload) > 1 {
+		slog.Warn("incorrect keys", "num_keys", len(payload))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	t, err := time.Parse(time.RFC3339, payload["time"])
+	if err != nil {
+		slog.Warn("failed to parse time", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = c.Handler.MarkDoseTaken(ctx, id, acc, true, t)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *Controller) PostSkipped(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_skipped")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantLog)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	payload := make(map[string]string, 1)
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		slog.Error("failed to unmarshal payload", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if len(payload) == 0 || len(payload) > 1 {
+		slog.Warn("incorrect keys", "num_keys", len(payload))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	t, err := time.Parse(time.RFC3339, payload["time"])
+	if err != nil {
+		slog.Warn("failed to parse time", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = c.Handler.MarkDoseTaken(ctx, id, acc, false, t)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *Controller) PostSnoozed(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_snoozed")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantLog)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// An empty body snoozes for the user's default snooze
+	var until *time.Time
+	if len(body) > 0 {
+		payload := make(map[string]string, 1)
+		err = json.Unmarshal(body, &payload)
+		if err != nil {
+			slog.Error("failed to unmarshal payload", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if untilS, ok := payload["until"]; ok {
+			t, err := time.Parse(time.RFC3339, untilS)
+			if err != nil {
+				slog.Warn("failed to parse until", "err", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			until = &t
+		}
+	}
+
+	dose, err := c.Handler.SnoozeDose(ctx, id, acc, until)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(dose)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) PostUndo(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_undo")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantLog)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = c.Handler.UndoDose(ctx, id, acc)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *Controller) PatchDose(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "patch_dose")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantLog)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	edit := &models.DoseEdit{}
+	err = json.Unmarshal(body, edit)
+	if err != nil {
+		slog.Warn("failed to unmarshal dose edit", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	dose, err := c.Handler.EditDose(ctx, id, acc, edit)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(dose)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) GetDoseEvents(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_dose_events")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantView)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	events, err := c.Handler.DoseEvents(ctx, id, acc)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(&events)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+// GetInventory reports the medication on hand for a prescription and when
+// it runs out.
+func (c *Controller) GetInventory(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_inventory")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantView)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	inventory, err := c.Handler.GetInventory(ctx, id, acc)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(inventory)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+// PostInventory enters a fill or an adjustment, e.g. for lost pills.
+func (c *Controller) PostInventory(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_inventory")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantManage)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	change := &models.InventoryChange{}
+	err = json.Unmarshal(body, change)
+	if err != nil {
+		slog.Warn("failed to unmarshal inventory change", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	inventory, err := c.Handler.AddInventory(ctx, id, acc, change)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(inventory)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+// PostRefill records a pharmacy refill being picked up.
+func (c *Controller) PostRefill(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_refill")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantManage)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	refill := &models.Refill{}
+	if len(body) > 0 {
+		err = json.Unmarshal(body, refill)
+		if err != nil {
+			slog.Warn("failed to unmarshal refill", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	fill, err := c.Handler.RefillPerscription(ctx, id, acc, refill)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(fill)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+// GetRefillForecast reports when a prescription runs out and when to ask
+// for a refill.
+func (c *Controller) GetRefillForecast(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_refill_forecast")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantView)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	forecast, err := c.Handler.RefillForecast(ctx, id, acc)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(forecast)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+// GetAdherence reports adherence between the optional from and to query
+// parameters, RFC 3339 times that default to the 30 days up to now. rx
+// narrows it to one prescription.
+func (c *Controller) GetAdherence(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_adherence")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	acc, err := c.access(ctx, w, r, uid, models.GrantView)
+	if err != nil {
+		return
+	}
+
+	query := r.URL.Query()
+
+	to := time.Now()
+	if toS := query.Get("to"); toS != "" {
+		to, err = time.Parse(time.RFC3339, toS)
+		if err != nil {
+			slog.Warn("failed to parse to", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	from := to.AddDate(0, 0, -30)
+	if fromS := query.Get("from"); fromS != "" {
+		from, err = time.Parse(time.RFC3339, fromS)
+		if err != nil {
+			slog.Warn("failed to parse from", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	adherence, err := c.Handler.Adherence(ctx, acc, from, to, query.Get("rx"))
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(adherence)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+// GetMedications searches the medication catalog by the prefix in the
+// search query parameter. limit caps the number of results.
+func (c *Controller) GetMedications(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_medications")
+	var err error
+	defer done(&ctx, &err)
+
+	query := r.URL.Query()
+
+	limit := 0
+	if limitS := query.Get("limit"); limitS != "" {
+		limit, err = strconv.Atoi(limitS)
+		if err != nil || limit < 1 {
+			slog.Warn("failed to parse limit", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	medications, err := c.Handler.SearchMedications(ctx, query.Get("search"), limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(&medications)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) PostNotificationTarget(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_notification_target")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	target := &models.NotificationTarget{}
+	err = json.Unmarshal(body, target)
+	if err != nil {
+		slog.Warn("failed to unmarshal notification target", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	target, err = c.Handler.AddNotificationTarget(ctx, uid, target)
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(target)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(payload)
+}
+
+func (c *Controller) GetNotificationTargets(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_notification_targets")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	targets, err := c.Handler.GetNotificationTargets(ctx, uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(&targets)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) DeleteNotificationTarget(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "delete_notification_target")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = c.Handler.DeleteNotificationTarget(ctx, uid, id)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Controller) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_preferences")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	prefs, err := c.Handler.GetPreferences(ctx, uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(prefs)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) PutPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "put_preferences")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	prefs := &models.Preferences{}
+	err = json.Unmarshal(body, prefs)
+	if err != nil {
+		slog.Warn("failed to unmarshal preferences", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	prefs, err = c.Handler.SetPreferences(ctx, uid, prefs)
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(prefs)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) DeletePreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "delete_preferences")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	err = c.Handler.ResetPreferences(ctx, uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Controller) GetRoot(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_root", metrics.WithLabelNames("test"))
+	var err error
+	defer done(&ctx, &err)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *Controller) Options(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "cors_options")
+	var err error
+	defer done(&ctx, &err)
+
+	enableCORS(w, r)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func scheduleDefaults(sch *models.Schedule) {
+	periodic := sch.Kind == "" || sch.Kind == models.SchedulePeriodic
+	if periodic && sch.Period.Duration == 0 {
+		sch.Period = models.Duration{Duration: time.Hour * 24} // 1 day
+	}
+
+	for i := range sch.Phases {
+		scheduleDefaults(&sch.Phases[i].Schedule)
+	}
+}
+
+func enableCORS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")                                       // Allow all origins
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS") // Allowed HTTP methods
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")            // Allowed headers
+	w.Header().Set("Access-Control-Expose-Headers", "Content-Length")                        // Expose headers
+	w.Header().Set("Access-Control-Allow-Credentials", "true")                               // Allow credentials
+}
+
+func (c *Controller) GetPatients(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_patients")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	patients, err := c.Handler.Patients(ctx, uid)
+	if err != nil {
+		slog.Error("failed to get patients", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(&patients)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) PostPatient(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_patient")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	patient := &models.Patient{}
+	err = json.Unmarshal(payload, patient)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	patient, err = c.Handler.AddPatient(ctx, uid, patient)
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to add patient", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err = json.Marshal(patient)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) PutPatientTimeZone(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "put_patient_time_zone")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	patient := &models.Patient{}
+	err = json.Unmarshal(payload, patient)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	patient, moved, err := c.Handler.SetPatientTimeZone(ctx, uid, id, patient.TimeZone)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to set patient time zone", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := struct {
+		models.Patient
+		Reanchored int
+	}{
+		Patient:    *patient,
+		Reanchored: moved,
+	}
+
+	payload, err = json.Marshal(&resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) GetCaregivers(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_caregivers")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	caregivers, err := c.Handler.Caregivers(ctx, uid, id)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to get caregivers", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(&caregivers)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) PutCaregiver(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "put_caregiver")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	caregiver := &models.Caregiver{}
+	err = json.Unmarshal(payload, caregiver)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	caregiver, err = c.Handler.SetCaregiver(ctx, uid, id, caregiver)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to set caregiver", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err = json.Marshal(caregiver)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) DeleteCaregiver(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "delete_caregiver")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	id := r.PathValue("id")
+	user := r.PathValue("user")
+	if id == "" || user == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = c.Handler.RemoveCaregiver(ctx, uid, id, user)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to remove caregiver", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Controller) GetPendingUsers(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_pending_users")
+	var err error
+	defer done(&ctx, &err)
+
+	users, err := c.Handler.PendingUsers(ctx)
+	if err != nil {
+		slog.Error("failed to get pending users", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(&users)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) PostApproved(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_approved")
+	var err error
+	defer done(&ctx, &err)
+
+	err = c.decideUser(ctx, w, r, models.UserApproved)
+}
+
+func (c *Controller) PostDenied(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_denied")
+	var err error
+	defer done(&ctx, &err)
+
+	err = c.decideUser(ctx, w, r, models.UserDenied)
+}
+
+func (c *Controller) PostRevoked(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_revoked")
+	var err error
+	defer done(&ctx, &err)
+
+	err = c.decideUser(ctx, w, r, models.UserRevoked)
+}
+
+// decideUser records the admin's decision about the user in the path, with
+// the optional reason in the body, and writes the response.
+func (c *Controller) decideUser(ctx context.Context, w http.ResponseWriter, r *http.Request, decision models.UserStatus) error {
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+
+	admin := claims.RegisteredClaims.Subject
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return err
+	}
+
+	payload := make(map[string]string, 1)
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &payload)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return err
+		}
+	}
+
+	user, err := c.Handler.DecideUser(ctx, admin, id, decision, payload["reason"])
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return err
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return err
+	}
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return err
+	}
+	if err != nil {
+		slog.Error("failed to decide user", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+
+	resp, err := json.Marshal(user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(resp)
+	return nil
 }
 
-func enableCORS(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")                                // Allow all origins
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS") // Allowed HTTP methods
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")     // Allowed headers
-	w.Header().Set("Access-Control-Expose-Headers", "Content-Length")                 // Expose headers
-	w.Header().Set("Access-Control-Allow-Credentials", "true")                        // Allow credentials
+func (c *Controller) GetUserDecisions(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_user_decisions")
+	var err error
+	defer done(&ctx, &err)
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	decisions, err := c.Handler.UserDecisions(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to get user decisions", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(&decisions)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) PostInvite(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_invite")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	req := &models.InviteRequest{}
+	if len(body) > 0 {
+		err = json.Unmarshal(body, req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	invite, err := c.Handler.CreateInvite(ctx, uid, req)
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to create invite", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(invite)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) GetInvites(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_invites")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	invites, err := c.Handler.Invites(ctx, uid)
+	if err != nil {
+		slog.Error("failed to get invites", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(&invites)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) PostRedeem(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_redeem")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	payload := make(map[string]string, 1)
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload["code"] == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := c.Handler.RedeemInvite(ctx, uid, payload["code"])
+	if errors.Is(err, ErrRateLimited) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(inviteFailureWindow.Seconds())))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to redeem invite", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (c *Controller) PostAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "post_api_key")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	req := &models.APIKeyRequest{}
+	err = json.Unmarshal(body, req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	key, err := c.Handler.CreateAPIKey(ctx, uid, req)
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to create api key", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(payload)
+}
+
+func (c *Controller) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "get_api_keys")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	keys, err := c.Handler.APIKeys(ctx, uid)
+	if err != nil {
+		slog.Error("failed to get api keys", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(&keys)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (c *Controller) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx, done := koko.Operation(r.Context(), "delete_api_key")
+	var err error
+	defer done(&ctx, &err)
+
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		slog.Error("missing jwt claims in context")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uid := claims.RegisteredClaims.Subject
+
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = c.Handler.RevokeAPIKey(ctx, uid, id)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to revoke api key", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// access authorizes the request's user for the patient picked by the patient
+// query parameter, themselves if there isn't one, to do what needs grant.
+// Requests made with an API key are also limited to what its scopes allow.
+// If they can't, the response is written and the error returned.
+func (c *Controller) access(ctx context.Context, w http.ResponseWriter, r *http.Request, uid string, grant models.Grant) (Access, error) {
+	claims, _ := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if claims != nil {
+		custom, ok := claims.CustomClaims.(*middleware.CustomClaims)
+		if ok && custom.APIKey != "" && !keyAllows(custom.Scopes, grant) {
+			err := fmt.Errorf("%w: the api key's scopes don't allow %s access", ErrForbidden, grant)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return Access{}, err
+		}
+	}
+
+	acc, err := c.Handler.Authorize(ctx, uid, r.URL.Query().Get("patient"), grant)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return acc, err
+	}
+	if errors.Is(err, ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return acc, err
+	}
+	if err != nil {
+		slog.Error("failed to authorize", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return acc, err
+	}
+
+	return acc, nil
 }
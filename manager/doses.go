@@ -0,0 +1,297 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+// UndoDose resets a logged dose of the patient's back to pending. Doses of
+// as needed prescriptions only exist because they were logged, so they are
+// removed instead.
+func (h *Handler) UndoDose(ctx context.Context, id string, acc Access) (err error) {
+	ctx, done := koko.Operation(ctx, "handler_undo_dose")
+	defer done(&ctx, &err)
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	row, err := patientDose(ctx, q, id, acc.Patient)
+	if err != nil {
+		return err
+	}
+
+	if !row.Taken.Valid {
+		return fmt.Errorf("%w: dose hasn't been logged", ErrConflict)
+	}
+
+	var schedule models.Schedule
+	err = json.Unmarshal(row.Schedule, &schedule)
+	if err != nil {
+		return err
+	}
+
+	var dose sqlc.Dose
+	if schedule.Kind == models.ScheduleAsNeeded {
+		err = q.DeleteDose(ctx, id)
+		dose = sqlc.Dose{ID: id}
+	} else {
+		params := sqlc.UpdateDoseLogParams{
+			ID: id,
+		}
+		dose, err = q.UpdateDoseLog(ctx, params)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = recordDoseEvent(ctx, q, dose, models.DoseUndone, acc.User)
+	if err != nil {
+		return err
+	}
+
+	err = syncDoseInventory(ctx, q, row.PrescriptionID, dose, acc.User)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// EditDose corrects when a logged dose of the patient's was taken or how
+// much of it was taken.
+func (h *Handler) EditDose(ctx context.Context, id string, acc Access, edit *models.DoseEdit) (_ *models.Dose, err error) {
+	ctx, done := koko.Operation(ctx, "handler_edit_dose")
+	defer done(&ctx, &err)
+
+	if edit.AmountTaken != nil && *edit.AmountTaken < 0 {
+		return nil, fmt.Errorf("%w: amount taken can't be negative", ErrInvalid)
+	}
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	row, err := patientDose(ctx, q, id, acc.Patient)
+	if err != nil {
+		return nil, err
+	}
+
+	if !row.Taken.Valid {
+		return nil, fmt.Errorf("%w: dose hasn't been logged", ErrConflict)
+	}
+
+	params := sqlc.UpdateDoseLogParams{
+		Taken:       row.Taken,
+		TimeTaken:   row.TimeTaken,
+		AmountTaken: row.AmountTaken,
+		ID:          id,
+	}
+	if edit.TimeTaken != nil {
+		params.TimeTaken = sql.NullInt64{Int64: edit.TimeTaken.Unix(), Valid: true}
+	}
+	if edit.AmountTaken != nil {
+		params.AmountTaken = sql.NullFloat64{Float64: *edit.AmountTaken, Valid: true}
+	}
+
+	dose, err := q.UpdateDoseLog(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordDoseEvent(ctx, q, dose, models.DoseEdited, acc.User)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syncDoseInventory(ctx, q, row.PrescriptionID, dose, acc.User)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return toDose(dose), nil
+}
+
+// SnoozeDose puts off a pending dose of the patient's until until, or by
+// the patient's snooze preference if until is nil. The dose stays pending
+// and is reminded about again when the snooze is up.
+func (h *Handler) SnoozeDose(ctx context.Context, id string, acc Access, until *time.Time) (_ *models.Dose, err error) {
+	ctx, done := koko.Operation(ctx, "handler_snooze_dose")
+	defer done(&ctx, &err)
+
+	now := time.Now()
+	if until == nil {
+		prefs, err := h.GetPreferences(ctx, acc.User)
+		if err != nil {
+			return nil, err
+		}
+
+		snooze := defaultSnooze
+		if prefs.Snooze != nil {
+			snooze = prefs.Snooze.Duration
+		}
+
+		t := now.Add(snooze)
+		until = &t
+	}
+
+	if !until.After(now) {
+		return nil, fmt.Errorf("%w: snooze must end in the future", ErrInvalid)
+	}
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	_, err = patientDose(ctx, q, id, acc.Patient)
+	if err != nil {
+		return nil, err
+	}
+
+	params := sqlc.SnoozeDoseParams{
+		SnoozedUntil: sql.NullInt64{Int64: until.Unix(), Valid: true},
+		ID:           id,
+	}
+	dose, err := q.SnoozeDose(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: only pending doses can be snoozed", ErrConflict)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = q.DeleteReminder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordDoseEvent(ctx, q, dose, models.DoseSnoozed, acc.User)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return toDose(dose), nil
+}
+
+// DoseEvents returns the audit trail of one of the patient's doses, oldest
+// first.
+func (h *Handler) DoseEvents(ctx context.Context, id string, acc Access) (_ []models.DoseEvent, err error) {
+	ctx, done := koko.Operation(ctx, "handler_dose_events")
+	defer done(&ctx, &err)
+
+	_, err = patientDose(ctx, h.Queries, id, acc.Patient)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := h.Queries.GetDoseEvents(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]models.DoseEvent, 0, len(rows))
+	for _, row := range rows {
+		event := models.DoseEvent{
+			ID:     row.ID,
+			DoseID: row.DoseID,
+			Event:  models.DoseEventKind(row.Event),
+			Actor:  row.Actor,
+			Time:   time.Unix(row.Time, 0),
+		}
+		if row.Taken.Valid {
+			event.Taken = &row.Taken.Bool
+		}
+		if row.TimeTaken.Valid {
+			t := time.Unix(row.TimeTaken.Int64, 0)
+			event.TimeTaken = &t
+		}
+		if row.AmountTaken.Valid {
+			event.AmountTaken = &row.AmountTaken.Float64
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// recordDoseEvent appends event to the dose's audit trail with the dose's
+// state after the event.
+func recordDoseEvent(ctx context.Context, q *sqlc.Queries, dose sqlc.Dose, event models.DoseEventKind, actor string) error {
+	params := sqlc.CreateDoseEventParams{
+		ID:          uuid.NewString(),
+		DoseID:      dose.ID,
+		Event:       string(event),
+		Actor:       actor,
+		Time:        time.Now().Unix(),
+		Taken:       dose.Taken,
+		TimeTaken:   dose.TimeTaken,
+		AmountTaken: dose.AmountTaken,
+	}
+	_, err := q.CreateDoseEvent(ctx, params)
+
+	return err
+}
+
+func toDose(dose sqlc.Dose) *models.Dose {
+	d := &models.Dose{
+		ID:      dose.ID,
+		Time:    time.Unix(dose.Time, 0),
+		Amount:  dose.Amount,
+		Unit:    dose.Unit,
+		Refill:  int(dose.Refill),
+		Phase:   int(dose.Phase),
+		Snoozes: int(dose.Snoozes),
+	}
+	if dose.Taken.Valid {
+		d.Taken = &dose.Taken.Bool
+	}
+	if dose.TimeTaken.Valid {
+		t := time.Unix(dose.TimeTaken.Int64, 0)
+		d.TimeTaken = &t
+	}
+	if dose.AmountTaken.Valid {
+		d.AmountTaken = &dose.AmountTaken.Float64
+	}
+	if dose.MissedAt.Valid {
+		t := time.Unix(dose.MissedAt.Int64, 0)
+		d.MissedAt = &t
+	}
+	if dose.SnoozedUntil.Valid {
+		t := time.Unix(dose.SnoozedUntil.Int64, 0)
+		d.SnoozedUntil = &t
+	}
+
+	return d
+}
@@ -4,29 +4,122 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/kzs0/kokoro/koko"
 	"github.com/kzs0/pill_manager/models"
 	"github.com/kzs0/pill_manager/models/db/sqlc"
+	"github.com/kzs0/pill_manager/pkg/cron"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid request")
+	ErrConflict = errors.New("conflict")
+	// The user can see the patient but can't do what they asked
+	ErrForbidden = errors.New("forbidden")
+	// Too many attempts were made recently; try again later
+	ErrRateLimited = errors.New("rate limited")
 )
 
 type Handler struct {
+	DB      *sql.DB
 	Queries *sqlc.Queries
 }
 
-func (h *Handler) NewPerscription(ctx context.Context, rx *models.Prescription, uid string) (_ *models.Prescription, err error) {
+func (h *Handler) NewPerscription(ctx context.Context, rx *models.Prescription, acc Access) (_ *models.Prescription, err error) {
 	ctx, done := koko.Operation(ctx, "handler_new_rx")
 	defer done(&ctx, &err)
 
-	medicationParams := sqlc.CreateMedicationParams{
-		ID:      uuid.NewString(),
-		Name:    rx.Medication.Name,
-		Generic: rx.Medication.Generic,
-		Brand:   rx.Medication.Brand,
+	if rx.ScheduleStart == nil {
+		now := time.Now()
+		rx.ScheduleStart = &now
+	}
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	form, err := medicationForm(ctx, q, rx.Medication)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkDoseUnits(form, &rx.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	if rx.Doses > maxDoses {
+		return nil, fmt.Errorf("%w: a fill can have at most %d doses", ErrInvalid, maxDoses)
+	}
+
+	var planned []plannedDose
+	if rx.Schedule.Kind == models.ScheduleAsNeeded {
+		// Doses are logged as they're taken
+		err = validateAsNeeded(rx.Schedule.AsNeeded)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		home, err := patientTimeZone(ctx, q, acc.Patient)
+		if err != nil {
+			return nil, err
+		}
+
+		loc, err := scheduleLocation(rx.Schedule, home, time.UTC)
+		if err != nil {
+			return nil, err
+		}
+
+		if rx.Schedule.Kind == models.ScheduleTapered && rx.Doses == 0 {
+			// Default to the whole taper
+			rx.Doses, err = countDoses(rx.Schedule, loc, *rx.ScheduleStart)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// Only the original fill is scheduled, refills add their doses
+		// when they are picked up
+		planned, err = planDoses(rx.Schedule, loc, *rx.ScheduleStart, *rx.ScheduleStart, rx.Doses)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(planned) == 0 && rx.Doses > 0 {
+			return nil, fmt.Errorf("%w: schedule never produces a dose", ErrInvalid)
+		}
+	}
+
+	if rx.Doses <= 0 || rx.Refills < 0 {
+		return nil, fmt.Errorf("%w: doses must be positive and refills non-negative", ErrInvalid)
+	}
+
+	if rx.Schedule.Kind == models.ScheduleTapered && rx.Refills > 0 {
+		return nil, fmt.Errorf("%w: tapered schedules can't have refills", ErrInvalid)
 	}
-	medication, err := h.Queries.CreateMedication(ctx, medicationParams)
+
+	if rx.OnTimeTolerance != nil && rx.OnTimeTolerance.Duration < 0 {
+		return nil, fmt.Errorf("%w: on time tolerance can't be negative", ErrInvalid)
+	}
+
+	if rx.MissedGrace != nil && rx.MissedGrace.Duration < 0 {
+		return nil, fmt.Errorf("%w: missed grace can't be negative", ErrInvalid)
+	}
+
+	if rx.LowSupply != nil && *rx.LowSupply < 0 {
+		return nil, fmt.Errorf("%w: low supply threshold can't be negative", ErrInvalid)
+	}
+
+	medication, _, err := catalogMedication(ctx, q, rx.Medication)
 	if err != nil {
 		return nil, err
 	}
@@ -37,15 +130,19 @@ func (h *Handler) NewPerscription(ctx context.Context, rx *models.Prescription,
 	}
 
 	params := sqlc.CreateRxParams{
-		ID:             uuid.NewString(),
-		MedicationID:   medication.ID,
-		ScheduledStart: sql.NullInt64{Int64: rx.ScheduleStart.Unix()},
-		Refills:        int64(rx.Refills),
-		Doses:          int64(rx.Doses),
-		Schedule:       sch,
-		Patient:        uid,
+		ID:              uuid.NewString(),
+		MedicationID:    medication.ID,
+		ScheduledStart:  sql.NullInt64{Int64: rx.ScheduleStart.Unix(), Valid: true},
+		Refills:         int64(rx.Refills),
+		Doses:           int64(rx.Doses),
+		Schedule:        sch,
+		Patient:         acc.Patient,
+		OnTimeTolerance: nullDuration(rx.OnTimeTolerance),
+		MissedGrace:     nullDuration(rx.MissedGrace),
+		Critical:        rx.Critical,
+		LowSupply:       nullFloat(rx.LowSupply),
 	}
-	prescription, err := h.Queries.CreateRx(ctx, params)
+	prescription, err := q.CreateRx(ctx, params)
 	if err != nil {
 		return nil, err
 	}
@@ -53,97 +150,177 @@ func (h *Handler) NewPerscription(ctx context.Context, rx *models.Prescription,
 	regimenParams := sqlc.CreateRegimenParams{
 		ID:             uuid.NewString(),
 		MedicationID:   medication.ID,
-		Patient:        uid,
+		Patient:        acc.Patient,
 		PrescriptionID: prescription.ID,
 	}
-	regimen, err := h.Queries.CreateRegimen(ctx, regimenParams)
+	regimen, err := q.CreateRegimen(ctx, regimenParams)
 	if err != nil {
 		return nil, err
 	}
 
-	t := rx.ScheduleStart
-	for i := 0; i <= rx.Refills; i++ {
-		for j := 0; j < rx.Doses; {
-			for _, dose := range rx.Schedule.Doses {
-				if j >= rx.Doses {
-					break
-				}
+	for _, dose := range planned {
+		dosesParams := sqlc.CreateDoseParams{
+			ID:        uuid.NewString(),
+			RegimenID: regimen.ID,
+			Refill:    0,
+			Time:      dose.Time.Unix(),
+			Amount:    dose.Amount,
+			Unit:      dose.Unit,
+			Phase:     int64(dose.Phase),
+		}
+		_, err = q.CreateDose(ctx, dosesParams)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-				doseTime := t.Add(dose.DurationIntoPeriod.Duration)
-				dosesParams := sqlc.CreateDoseParams{
-					ID:        uuid.NewString(),
-					RegimenID: regimen.ID,
-					Refill:    int64(i),
-					Time:      doseTime.Unix(),
-					Amount:    dose.Amount,
-					Unit:      dose.Unit,
-				}
-				_, err = h.Queries.CreateDose(ctx, dosesParams)
-				if err != nil {
-					return nil, err
-				}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
 
-				j++
-			}
+	return toPrescription(prescription, medication)
+}
 
-			ttemp := t.Add(rx.Schedule.Period.Duration)
-			t = &ttemp
-		}
+// MarkDoseTaken logs a pending dose of the patient's as taken or skipped at
+// t. Doses that were already logged are left alone and ErrConflict is
+// returned; use UndoDose or EditDose to correct them.
+func (h *Handler) MarkDoseTaken(ctx context.Context, id string, acc Access, taken bool, t time.Time) (err error) {
+	ctx, done := koko.Operation(ctx, "handler_mark_dose_taken")
+	defer done(&ctx, &err)
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	var schedule models.Schedule
-	err = json.Unmarshal(prescription.Schedule, &schedule)
+	q := h.Queries.WithTx(tx)
+
+	row, err := patientDose(ctx, q, id, acc.Patient)
+	if err != nil {
+		return err
+	}
+
+	params := sqlc.MarkDoseTakenParams{
+		Taken:     sql.NullBool{Bool: taken, Valid: true},
+		TimeTaken: sql.NullInt64{Int64: t.Unix(), Valid: true},
+		ID:        id,
+	}
+
+	updated, err := q.MarkDoseTaken(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return fmt.Errorf("%w: dose was already logged", ErrConflict)
+	}
+
+	dose, err := q.GetDose(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	event := models.DoseSkipped
+	if taken {
+		event = models.DoseTaken
+	}
+
+	err = recordDoseEvent(ctx, q, dose, event, acc.User)
+	if err != nil {
+		return err
+	}
+
+	err = syncDoseInventory(ctx, q, row.PrescriptionID, dose, acc.User)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetPerscription returns the patient's prescription id. Tapered
+// prescriptions also report the phase of their next pending dose.
+func (h *Handler) GetPerscription(ctx context.Context, id string, acc Access) (_ *models.Prescription, err error) {
+	ctx, done := koko.Operation(ctx, "handler_get_rx")
+	defer done(&ctx, &err)
+
+	prescription, regimen, err := h.patientRegimen(ctx, h.Queries, id, acc.Patient)
 	if err != nil {
 		return nil, err
 	}
 
-	var start *time.Time
-	if prescription.ScheduledStart.Valid {
-		starttemp := time.Unix(prescription.ScheduledStart.Int64, 0)
-		start = &starttemp
+	medication, err := h.Queries.GetMedication(ctx, prescription.MedicationID)
+	if err != nil {
+		return nil, err
 	}
 
-	rx = &models.Prescription{
-		ID: prescription.ID,
-		Medication: models.Medication{
-			ID:      medication.ID,
-			Name:    medication.Name,
-			Generic: medication.Generic,
-			Brand:   medication.Brand,
-		},
-		Doses:         int(prescription.Doses),
-		Refills:       int(prescription.Refills),
-		Schedule:      schedule,
-		ScheduleStart: start,
+	rx, err := toPrescription(prescription, medication)
+	if err != nil {
+		return nil, err
+	}
+
+	if rx.Schedule.Kind == models.ScheduleTapered {
+		next, err := h.Queries.GetNextPendingDose(ctx, regimen.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		if err == nil {
+			phase := int(next.Phase)
+			rx.CurrentPhase = &phase
+		}
 	}
 
 	return rx, nil
 }
 
-func (h *Handler) MarkDoseTaken(ctx context.Context, id string, taken bool, t time.Time) (err error) {
-	ctx, done := koko.Operation(ctx, "handler_mark_dose_taken")
+// DosesTillEmpty counts the doses left in the patient's regimen id: those
+// pending from the fills picked up so far and those the remaining refills
+// will add.
+func (h *Handler) DosesTillEmpty(ctx context.Context, id string, acc Access) (_ int64, err error) {
+	ctx, done := koko.Operation(ctx, "handler_doses_till_empty")
 	defer done(&ctx, &err)
 
-	params := sqlc.MarkDoseTakenParams{
-		Taken:     sql.NullBool{Bool: taken, Valid: true},
-		TimeTaken: sql.NullInt64{Int64: t.Unix(), Valid: true},
-		ID:        id,
+	regimen, err := patientRegimenByID(ctx, h.Queries, id, acc.Patient)
+	if err != nil {
+		return 0, err
 	}
 
-	err = h.Queries.MarkDoseTaken(ctx, params)
+	prescription, err := h.Queries.GetRx(ctx, regimen.PrescriptionID)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	pending, err := h.Queries.CountPendingDoses(ctx, regimen.ID)
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	return pending + (prescription.Refills-prescription.RefillsUsed)*prescription.Doses, nil
 }
 
-func (h *Handler) GetScheduledDoses(ctx context.Context, uid string, limit int) (_ []models.Regimen, err error) {
+// DosesTillRefill counts the pending doses left from the fills of the
+// patient's regimen id that were picked up so far.
+func (h *Handler) DosesTillRefill(ctx context.Context, id string, acc Access) (_ int64, err error) {
+	ctx, done := koko.Operation(ctx, "handler_doses_till_refill")
+	defer done(&ctx, &err)
+
+	regimen, err := patientRegimenByID(ctx, h.Queries, id, acc.Patient)
+	if err != nil {
+		return 0, err
+	}
+
+	return h.Queries.CountPendingDoses(ctx, regimen.ID)
+}
+
+func (h *Handler) GetScheduledDoses(ctx context.Context, acc Access, limit int) (_ []models.Regimen, err error) {
 	ctx, done := koko.Operation(ctx, "handler_get_doses")
 	defer done(&ctx, &err)
 
 	args := sqlc.GetDosesByPatientLimitByParams{
-		Patient: uid,
+		Patient: acc.Patient,
 		Limit:   int64(limit),
 	}
 
@@ -157,15 +334,18 @@ func (h *Handler) GetScheduledDoses(ctx context.Context, uid string, limit int)
 		regimen, ok := regimenMap[row.ID_3]
 		if !ok {
 			med := models.Medication{
-				ID:      row.ID_2,
-				Name:    row.Name,
-				Generic: row.Generic,
-				Brand:   row.Brand,
+				ID:       row.ID_2,
+				Name:     row.Name,
+				Generic:  row.Generic,
+				Brand:    row.Brand,
+				Strength: toStrength(row.StrengthValue, row.StrengthUnit),
+				Form:     models.DosageForm(row.Form),
+				Route:    models.Route(row.Route),
 			}
 
 			regimen = &models.Regimen{
 				ID:         row.ID_3,
-				PatientID:  uid,
+				PatientID:  acc.Patient,
 				Medication: med,
 				Doses:      make([]models.Dose, 0, 0),
 			}
@@ -178,11 +358,17 @@ func (h *Handler) GetScheduledDoses(ctx context.Context, uid string, limit int)
 		}
 
 		dose := models.Dose{
-			ID:     row.ID,
-			Time:   time.Unix(row.Time, 0),
-			Amount: row.Amount,
-			Unit:   row.Unit,
-			Refill: int(row.Refill),
+			ID:      row.ID,
+			Time:    time.Unix(row.Time, 0),
+			Amount:  row.Amount,
+			Unit:    row.Unit,
+			Refill:  int(row.Refill),
+			Phase:   int(row.Phase),
+			Snoozes: int(row.Snoozes),
+		}
+		if row.SnoozedUntil.Valid {
+			t := time.Unix(row.SnoozedUntil.Int64, 0)
+			dose.SnoozedUntil = &t
 		}
 
 		regimen.Doses = append(regimen.Doses, dose)
@@ -195,3 +381,597 @@ func (h *Handler) GetScheduledDoses(ctx context.Context, uid string, limit int)
 
 	return regimens, nil
 }
+
+// UpdatePerscription applies patch to the patient's prescription and rebuilds
+// every dose that has not been logged yet. Taken and skipped doses are kept
+// as history and count against the new dose total.
+func (h *Handler) UpdatePerscription(ctx context.Context, id string, acc Access, patch *models.PrescriptionPatch) (_ *models.Prescription, err error) {
+	ctx, done := koko.Operation(ctx, "handler_update_rx")
+	defer done(&ctx, &err)
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	rxParams := sqlc.GetRxByPatientParams{
+		ID:      id,
+		Patient: acc.Patient,
+	}
+	prescription, err := q.GetRxByPatient(ctx, rxParams)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	medication, err := q.GetMedication(ctx, prescription.MedicationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if prescription.DiscontinuedAt.Valid {
+		return nil, fmt.Errorf("%w: prescription is discontinued", ErrConflict)
+	}
+
+	rx, err := toPrescription(prescription, medication)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.Schedule != nil {
+		err = checkDoseUnits(rx.Medication.Form, patch.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		rx.Schedule = *patch.Schedule
+	}
+	if patch.ScheduleStart != nil {
+		rx.ScheduleStart = patch.ScheduleStart
+	}
+	if patch.Doses != nil {
+		if *patch.Doses > maxDoses {
+			return nil, fmt.Errorf("%w: a fill can have at most %d doses", ErrInvalid, maxDoses)
+		}
+		rx.Doses = *patch.Doses
+	}
+	if patch.Refills != nil {
+		rx.Refills = *patch.Refills
+	}
+	if patch.OnTimeTolerance != nil {
+		if patch.OnTimeTolerance.Duration < 0 {
+			return nil, fmt.Errorf("%w: on time tolerance can't be negative", ErrInvalid)
+		}
+		rx.OnTimeTolerance = patch.OnTimeTolerance
+	}
+	if patch.MissedGrace != nil {
+		if patch.MissedGrace.Duration < 0 {
+			return nil, fmt.Errorf("%w: missed grace can't be negative", ErrInvalid)
+		}
+		rx.MissedGrace = patch.MissedGrace
+	}
+	if patch.Critical != nil {
+		rx.Critical = *patch.Critical
+	}
+	if patch.LowSupply != nil {
+		if *patch.LowSupply < 0 {
+			return nil, fmt.Errorf("%w: low supply threshold can't be negative", ErrInvalid)
+		}
+		rx.LowSupply = patch.LowSupply
+	}
+
+	// A new taper without a dose count covers the whole taper
+	recount := patch.Schedule != nil && patch.Schedule.Kind == models.ScheduleTapered && patch.Doses == nil
+	if recount {
+		rx.Doses = 0
+	}
+
+	now := time.Now()
+	if rx.ScheduleStart == nil {
+		rx.ScheduleStart = &now
+	}
+
+	home, err := patientTimeZone(ctx, q, acc.Patient)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := scheduleLocation(rx.Schedule, home, time.UTC)
+	if err != nil {
+		return nil, err
+	}
+
+	if recount {
+		rx.Doses, err = countDoses(rx.Schedule, loc, *rx.ScheduleStart)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rx.Doses <= 0 || rx.Refills < 0 {
+		return nil, fmt.Errorf("%w: doses must be positive and refills non-negative", ErrInvalid)
+	}
+
+	if rx.Schedule.Kind == models.ScheduleTapered && rx.Refills > 0 {
+		return nil, fmt.Errorf("%w: tapered schedules can't have refills", ErrInvalid)
+	}
+
+	if int64(rx.Refills) < prescription.RefillsUsed {
+		return nil, fmt.Errorf("%w: %d refills were already filled", ErrInvalid, prescription.RefillsUsed)
+	}
+
+	sch, err := json.Marshal(&rx.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	updateParams := sqlc.UpdateRxParams{
+		ID:              prescription.ID,
+		Schedule:        sch,
+		ScheduledStart:  sql.NullInt64{Int64: rx.ScheduleStart.Unix(), Valid: true},
+		Refills:         int64(rx.Refills),
+		Doses:           int64(rx.Doses),
+		OnTimeTolerance: nullDuration(rx.OnTimeTolerance),
+		MissedGrace:     nullDuration(rx.MissedGrace),
+		Critical:        rx.Critical,
+		LowSupply:       nullFloat(rx.LowSupply),
+	}
+	prescription, err = q.UpdateRx(ctx, updateParams)
+	if err != nil {
+		return nil, err
+	}
+
+	// A new threshold may be below what is on hand
+	err = q.RearmLowSupply(ctx, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	regimen, err := q.GetRegimenByRx(ctx, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	logged, err := q.CountLoggedDoses(ctx, regimen.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = q.DeletePendingReminders(ctx, regimen.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = q.DeletePendingDoses(ctx, regimen.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	from := now
+	if rx.ScheduleStart.After(from) {
+		from = *rx.ScheduleStart
+	}
+
+	if rx.Schedule.Kind == models.ScheduleAsNeeded {
+		err = validateAsNeeded(rx.Schedule.AsNeeded)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only the fills picked up so far are scheduled
+	remaining := int(prescription.RefillsUsed+1)*rx.Doses - int(logged)
+	if rx.Schedule.Kind != models.ScheduleAsNeeded && remaining > 0 {
+		planned, err := planDoses(rx.Schedule, loc, *rx.ScheduleStart, from, remaining)
+		if err != nil {
+			return nil, err
+		}
+
+		// Doses that are left over are fine when only other fields
+		// changed, e.g. a taper that ended with some doses never logged
+		rescheduled := patch.Schedule != nil || patch.ScheduleStart != nil
+		if len(planned) == 0 && rescheduled {
+			return nil, fmt.Errorf("%w: schedule never produces a dose", ErrInvalid)
+		}
+
+		for i, dose := range planned {
+			dosesParams := sqlc.CreateDoseParams{
+				ID:        uuid.NewString(),
+				RegimenID: regimen.ID,
+				Refill:    int64((int(logged) + i) / rx.Doses),
+				Time:      dose.Time.Unix(),
+				Amount:    dose.Amount,
+				Unit:      dose.Unit,
+				Phase:     int64(dose.Phase),
+			}
+			_, err = q.CreateDose(ctx, dosesParams)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return toPrescription(prescription, medication)
+}
+
+// DiscontinuePerscription ends the patient's prescription at end. Doses
+// scheduled after end that were never logged are removed; everything before
+// it is kept as history.
+func (h *Handler) DiscontinuePerscription(ctx context.Context, id string, acc Access, end time.Time, reason string) (_ *models.Prescription, err error) {
+	ctx, done := koko.Operation(ctx, "handler_discontinue_rx")
+	defer done(&ctx, &err)
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	rxParams := sqlc.GetRxByPatientParams{
+		ID:      id,
+		Patient: acc.Patient,
+	}
+	prescription, err := q.GetRxByPatient(ctx, rxParams)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if prescription.DiscontinuedAt.Valid {
+		return nil, fmt.Errorf("%w: prescription is already discontinued", ErrConflict)
+	}
+
+	discontinueParams := sqlc.DiscontinueRxParams{
+		DiscontinuedAt:     sql.NullInt64{Int64: end.Unix(), Valid: true},
+		DiscontinuedReason: sql.NullString{String: reason, Valid: reason != ""},
+		ID:                 prescription.ID,
+	}
+	prescription, err = q.DiscontinueRx(ctx, discontinueParams)
+	if err != nil {
+		return nil, err
+	}
+
+	regimen, err := q.GetRegimenByRx(ctx, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	remindersParams := sqlc.DeletePendingRemindersAfterParams{
+		RegimenID: regimen.ID,
+		Time:      end.Unix(),
+	}
+	err = q.DeletePendingRemindersAfter(ctx, remindersParams)
+	if err != nil {
+		return nil, err
+	}
+
+	pendingParams := sqlc.DeletePendingDosesAfterParams{
+		RegimenID: regimen.ID,
+		Time:      end.Unix(),
+	}
+	err = q.DeletePendingDosesAfter(ctx, pendingParams)
+	if err != nil {
+		return nil, err
+	}
+
+	medication, err := q.GetMedication(ctx, prescription.MedicationID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return toPrescription(prescription, medication)
+}
+
+// DeletePerscription removes the patient's prescription along with its
+// regimen and every dose, logged or not, and their reminders. It is meant
+// for prescriptions that were entered by mistake; use
+// DiscontinuePerscription to keep history.
+func (h *Handler) DeletePerscription(ctx context.Context, id string, acc Access) (err error) {
+	ctx, done := koko.Operation(ctx, "handler_delete_rx")
+	defer done(&ctx, &err)
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	rxParams := sqlc.GetRxByPatientParams{
+		ID:      id,
+		Patient: acc.Patient,
+	}
+	prescription, err := q.GetRxByPatient(ctx, rxParams)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	err = q.DeleteRemindersByRx(ctx, prescription.ID)
+	if err != nil {
+		return err
+	}
+
+	err = q.DeleteDosesByRx(ctx, prescription.ID)
+	if err != nil {
+		return err
+	}
+
+	err = q.DeleteRegimensByRx(ctx, prescription.ID)
+	if err != nil {
+		return err
+	}
+
+	err = q.DeleteInventoryByRx(ctx, prescription.ID)
+	if err != nil {
+		return err
+	}
+
+	err = q.DeleteFillsByRx(ctx, prescription.ID)
+	if err != nil {
+		return err
+	}
+
+	err = q.DeleteRx(ctx, prescription.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PauseRegimen holds the prescription's regimen from at until it is resumed.
+// Paused regimens are left out of the scheduled doses.
+func (h *Handler) PauseRegimen(ctx context.Context, id string, acc Access, at time.Time) (err error) {
+	ctx, done := koko.Operation(ctx, "handler_pause_regimen")
+	defer done(&ctx, &err)
+
+	prescription, regimen, err := h.patientRegimen(ctx, h.Queries, id, acc.Patient)
+	if err != nil {
+		return err
+	}
+
+	if prescription.DiscontinuedAt.Valid {
+		return fmt.Errorf("%w: prescription is discontinued", ErrConflict)
+	}
+
+	if regimen.PausedAt.Valid {
+		return fmt.Errorf("%w: regimen is already paused", ErrConflict)
+	}
+
+	params := sqlc.PauseRegimenParams{
+		PausedAt: sql.NullInt64{Int64: at.Unix(), Valid: true},
+		ID:       regimen.ID,
+	}
+
+	return h.Queries.PauseRegimen(ctx, params)
+}
+
+// ResumeRegimen ends the pause on the prescription's regimen at at. Pending
+// doses that were due during or after the pause are pushed back by the time
+// spent paused so none of the remaining supply is lost.
+func (h *Handler) ResumeRegimen(ctx context.Context, id string, acc Access, at time.Time) (err error) {
+	ctx, done := koko.Operation(ctx, "handler_resume_regimen")
+	defer done(&ctx, &err)
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	_, regimen, err := h.patientRegimen(ctx, q, id, acc.Patient)
+	if err != nil {
+		return err
+	}
+
+	if !regimen.PausedAt.Valid {
+		return fmt.Errorf("%w: regimen is not paused", ErrConflict)
+	}
+
+	shift := at.Unix() - regimen.PausedAt.Int64
+	if shift > 0 {
+		shiftParams := sqlc.ShiftPendingDosesParams{
+			Shift:     shift,
+			RegimenID: regimen.ID,
+			Since:     regimen.PausedAt.Int64,
+		}
+		err = q.ShiftPendingDoses(ctx, shiftParams)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = q.ResumeRegimen(ctx, regimen.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetTimeZone changes the user's home zone. Pending doses of schedules that
+// follow the home zone are moved so they keep their wall clock time in the
+// new zone, e.g. 08:00 in New York becomes 08:00 in London. Doses planned
+// before the user had a home zone were planned in UTC, so they are moved
+// from UTC. It returns the number of doses moved.
+func (h *Handler) SetTimeZone(ctx context.Context, uid string, name string) (_ *models.User, moved int, err error) {
+	ctx, done := koko.Operation(ctx, "handler_set_time_zone")
+	defer done(&ctx, &err)
+
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "" {
+		return nil, 0, fmt.Errorf("%w: unknown time zone %q", ErrInvalid, name)
+	}
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	user, err := q.GetUser(ctx, uid)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if user.TimeZone != name {
+		moved, err = reanchorDoses(ctx, q, uid, user.TimeZone, loc)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	params := sqlc.SetUserTimeZoneParams{
+		TimeZone: name,
+		ID:       uid,
+	}
+	user, err = q.SetUserTimeZone(ctx, params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &models.User{ID: user.ID, TimeZone: user.TimeZone}, moved, nil
+}
+
+// reanchorDoses moves the patient's pending doses that follow their home
+// zone from the wall clock times they have in the zone named old, or UTC if
+// it is empty, to the same wall clock times in loc. Snoozes move with their
+// doses. It returns the number of doses moved.
+func reanchorDoses(ctx context.Context, q *sqlc.Queries, patient string, old string, loc *time.Location) (int, error) {
+	from := time.UTC
+	if old != "" {
+		var err error
+		from, err = time.LoadLocation(old)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	rows, err := q.GetPendingDosesByPatient(ctx, patient)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, row := range rows {
+		var schedule models.Schedule
+		err = json.Unmarshal(row.Schedule, &schedule)
+		if err != nil {
+			return 0, err
+		}
+
+		if schedule.TimeZone != "" {
+			continue // pinned to its own zone
+		}
+
+		reanchored := cron.WallClock(time.Unix(row.Time, 0).In(from), loc)
+
+		params := sqlc.UpdateDoseTimeParams{
+			Time: reanchored.Unix(),
+			ID:   row.ID,
+		}
+		err = q.UpdateDoseTime(ctx, params)
+		if err != nil {
+			return 0, err
+		}
+
+		moved++
+	}
+
+	return moved, nil
+}
+
+func toPrescription(prescription sqlc.Prescription, medication sqlc.Medication) (*models.Prescription, error) {
+	var schedule models.Schedule
+	err := json.Unmarshal(prescription.Schedule, &schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	var start *time.Time
+	if prescription.ScheduledStart.Valid {
+		starttemp := time.Unix(prescription.ScheduledStart.Int64, 0)
+		start = &starttemp
+	}
+
+	var discontinued *time.Time
+	if prescription.DiscontinuedAt.Valid {
+		discontinuedtemp := time.Unix(prescription.DiscontinuedAt.Int64, 0)
+		discontinued = &discontinuedtemp
+	}
+
+	rx := &models.Prescription{
+		ID:                 prescription.ID,
+		Medication:         toMedication(medication),
+		Doses:              int(prescription.Doses),
+		Refills:            int(prescription.Refills),
+		RefillsRemaining:   int(prescription.Refills - prescription.RefillsUsed),
+		Schedule:           schedule,
+		ScheduleStart:      start,
+		DiscontinuedAt:     discontinued,
+		DiscontinuedReason: prescription.DiscontinuedReason.String,
+		Critical:           prescription.Critical,
+	}
+
+	if prescription.OnTimeTolerance.Valid {
+		rx.OnTimeTolerance = &models.Duration{Duration: time.Duration(prescription.OnTimeTolerance.Int64) * time.Second}
+	}
+
+	if prescription.MissedGrace.Valid {
+		rx.MissedGrace = &models.Duration{Duration: time.Duration(prescription.MissedGrace.Int64) * time.Second}
+	}
+
+	if prescription.LowSupply.Valid {
+		rx.LowSupply = &prescription.LowSupply.Float64
+	}
+
+	return rx, nil
+}
+
+func nullFloat(f *float64) sql.NullFloat64 {
+	if f == nil {
+		return sql.NullFloat64{}
+	}
+
+	return sql.NullFloat64{Float64: *f, Valid: true}
+}
+
+// nullDuration stores d in whole seconds.
+func nullDuration(d *models.Duration) sql.NullInt64 {
+	if d == nil {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: int64(d.Duration / time.Second), Valid: true}
+}
@@ -0,0 +1,234 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kzs0/pill_manager/models"
+)
+
+func TestNewPerscriptionBounds(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t)
+
+	alice := newTestUser(t, h, "alice")
+
+	tests := map[string]*models.Prescription{
+		"too many doses": {
+			Schedule: models.Schedule{Period: hours(8), Doses: tablets(1, 0)},
+			Doses:    2000000000,
+		},
+		"period too short": {
+			Schedule: models.Schedule{Period: models.Duration{Duration: time.Nanosecond}, Doses: tablets(1, 0)},
+			Doses:    10,
+		},
+		"taper too long": {
+			Schedule: models.Schedule{Kind: models.ScheduleTapered, Phases: []models.Phase{
+				{Schedule: models.Schedule{Period: models.Duration{Duration: time.Second}, Doses: tablets(1, 0)}, Duration: hours(30 * 365 * 24)},
+			}},
+		},
+		"long taper with a minute period": {
+			Schedule: models.Schedule{Kind: models.ScheduleTapered, Phases: []models.Phase{
+				{Schedule: models.Schedule{Period: models.Duration{Duration: minPeriod}, Doses: tablets(1, 0)}, Duration: hours(30 * 365 * 24)},
+			}},
+		},
+	}
+
+	for name, rx := range tests {
+		t.Run(name, func(t *testing.T) {
+			rx.Medication = models.Medication{Name: "Ibuprofen"}
+
+			_, err := h.NewPerscription(ctx, rx, alice)
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("got %v, want ErrInvalid", err)
+			}
+		})
+	}
+
+	rx, _ := newTestRx(t, h, alice, time.Now())
+
+	doses := maxDoses + 1
+	_, err := h.UpdatePerscription(ctx, rx.ID, alice, &models.PrescriptionPatch{Doses: &doses})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("patching in too many doses got %v, want ErrInvalid", err)
+	}
+}
+
+// newDailyRx prescribes a tablet at 08:00 every day from the day after
+// today, in the patient's home zone.
+func newDailyRx(t *testing.T, h *Handler, acc Access) (*models.Prescription, []models.Dose) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	tomorrow := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	rx := &models.Prescription{
+		Medication:    models.Medication{Name: "Ibuprofen"},
+		Schedule:      models.Schedule{Period: hours(24), Doses: tablets(1, 8)},
+		ScheduleStart: &tomorrow,
+		Doses:         5,
+	}
+	rx, err := h.NewPerscription(ctx, rx, acc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	regimens, err := h.GetScheduledDoses(ctx, acc, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regimens) != 1 || len(regimens[0].Doses) != 5 {
+		t.Fatalf("got %+v, want one regimen with 5 doses", regimens)
+	}
+
+	return rx, regimens[0].Doses
+}
+
+// wantAtEight checks that the patient's pending doses are all at 08:00 in
+// loc.
+func wantAtEight(t *testing.T, h *Handler, acc Access, loc *time.Location) []models.Dose {
+	t.Helper()
+
+	regimens, err := h.GetScheduledDoses(context.Background(), acc, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doses := regimens[0].Doses
+	for _, dose := range doses {
+		at := dose.Time.In(loc)
+		if at.Hour() != 8 || at.Minute() != 0 {
+			t.Errorf("dose %s is at %s, want 08:00 in %s", dose.ID, at, loc)
+		}
+	}
+
+	return doses
+}
+
+func TestSetTimeZoneFromNone(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t)
+
+	alice := newTestUser(t, h, "alice")
+	_, doses := newDailyRx(t, h, alice)
+
+	// Without a home zone, doses are planned in UTC
+	wantAtEight(t, h, alice, time.UTC)
+
+	until := doses[0].Time.Add(30 * time.Minute)
+	_, err := h.SnoozeDose(ctx, doses[0].ID, alice, &until)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, moved, err := h.SetTimeZone(ctx, alice.User, "America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != len(doses) {
+		t.Errorf("moved %d doses, want %d", moved, len(doses))
+	}
+
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := wantAtEight(t, h, alice, ny)
+
+	// The snooze keeps its distance from the dose
+	var snoozedUntil int64
+	err = h.DB.QueryRowContext(ctx, `SELECT snoozed_until FROM doses WHERE id = ?`, doses[0].ID).Scan(&snoozedUntil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := after[0].Time.Add(30 * time.Minute).Unix(); snoozedUntil != want {
+		t.Errorf("snoozed until %s, want %s", time.Unix(snoozedUntil, 0), time.Unix(want, 0))
+	}
+}
+
+func TestSetPatientTimeZone(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t)
+
+	alice := newTestUser(t, h, "alice")
+	bob := newTestUser(t, h, "bob")
+
+	kid, err := h.AddPatient(ctx, alice.User, &models.Patient{Name: "Kid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acc := Access{User: alice.User, Patient: kid.ID}
+	_, doses := newDailyRx(t, h, acc)
+
+	patient, moved, err := h.SetPatientTimeZone(ctx, alice.User, kid.ID, "Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != len(doses) || patient.TimeZone != "Europe/London" {
+		t.Errorf("got %+v and %d doses moved", patient, moved)
+	}
+
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantAtEight(t, h, acc, london)
+
+	// From one zone to another
+	_, _, err = h.SetPatientTimeZone(ctx, alice.User, kid.ID, "Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantAtEight(t, h, acc, tokyo)
+
+	_, _, err = h.SetPatientTimeZone(ctx, bob.User, kid.ID, "Europe/London")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("a stranger got %v, want ErrNotFound", err)
+	}
+
+	_, _, err = h.SetPatientTimeZone(ctx, alice.User, alice.Patient, "Europe/London")
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("setting a user's own patient got %v, want ErrInvalid", err)
+	}
+
+	_, _, err = h.SetPatientTimeZone(ctx, alice.User, kid.ID, "Mars/Olympus_Mons")
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("unknown zone got %v, want ErrInvalid", err)
+	}
+}
+
+func TestNewPerscriptionRollsBack(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t)
+
+	// As needed prescriptions don't look the patient up, so the missing
+	// patient is only caught once the medication is in the catalog
+	rx := &models.Prescription{
+		Medication: models.Medication{Name: "Naproxen"},
+		Schedule: models.Schedule{
+			Kind:     models.ScheduleAsNeeded,
+			AsNeeded: &models.AsNeeded{Amount: 1, Unit: "tablet"},
+		},
+		Doses: 10,
+	}
+	_, err := h.NewPerscription(ctx, rx, Access{User: "nobody", Patient: "nobody"})
+	if err == nil {
+		t.Fatal("got nil, want an error")
+	}
+
+	medications, err := h.SearchMedications(ctx, "Naproxen", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(medications) > 0 {
+		t.Errorf("got %+v in the catalog, want the failed prescription's medication rolled back", medications)
+	}
+}
@@ -0,0 +1,243 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+// Quantities are fractional, e.g. half tablets, so sums are compared with
+// some slack
+const inventoryEpsilon = 1e-9
+
+// GetInventory returns the medication on hand for the patient's prescription
+// id, its ledger, and when it is projected to run out.
+//
+// Inventory is tracked from a prescription's first fill or adjustment.
+// Before that nothing is known about what is on hand, so taken doses aren't
+// entered either.
+func (h *Handler) GetInventory(ctx context.Context, id string, acc Access) (_ *models.Inventory, err error) {
+	ctx, done := koko.Operation(ctx, "handler_get_inventory")
+	defer done(&ctx, &err)
+
+	prescription, regimen, err := h.patientRegimen(ctx, h.Queries, id, acc.Patient)
+	if err != nil {
+		return nil, err
+	}
+
+	return inventory(ctx, h.Queries, prescription, regimen)
+}
+
+// AddInventory enters a fill or a manual adjustment for the patient's
+// prescription id.
+func (h *Handler) AddInventory(ctx context.Context, id string, acc Access, change *models.InventoryChange) (_ *models.Inventory, err error) {
+	ctx, done := koko.Operation(ctx, "handler_add_inventory")
+	defer done(&ctx, &err)
+
+	err = validateInventoryChange(change)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	prescription, regimen, err := h.patientRegimen(ctx, q, id, acc.Patient)
+	if err != nil {
+		return nil, err
+	}
+
+	t := time.Now()
+	if change.Time != nil {
+		t = *change.Time
+	}
+
+	quantity := change.Quantity
+	if change.Count != nil {
+		onHand, err := q.GetOnHand(ctx, prescription.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		quantity = *change.Count - onHand.OnHand
+	}
+
+	params := sqlc.CreateInventoryEntryParams{
+		ID:             uuid.NewString(),
+		PrescriptionID: prescription.ID,
+		Kind:           string(change.Kind),
+		Quantity:       quantity,
+		Note:           change.Note,
+		Actor:          acc.User,
+		Time:           t.Unix(),
+	}
+	_, err = q.CreateInventoryEntry(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err = q.RearmLowSupply(ctx, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := inventory(ctx, q, prescription, regimen)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+func validateInventoryChange(change *models.InventoryChange) error {
+	switch change.Kind {
+	case models.InventoryFill:
+		if change.Count != nil {
+			return fmt.Errorf("%w: fills can't be counts", ErrInvalid)
+		}
+
+		if change.Quantity <= 0 {
+			return fmt.Errorf("%w: fill quantity must be positive", ErrInvalid)
+		}
+	case models.InventoryAdjustment:
+		if change.Count != nil && *change.Count < 0 {
+			return fmt.Errorf("%w: count can't be negative", ErrInvalid)
+		}
+
+		if change.Count == nil && change.Quantity == 0 {
+			return fmt.Errorf("%w: adjustment needs a quantity or a count", ErrInvalid)
+		}
+	default:
+		return fmt.Errorf("%w: inventory kind must be %q or %q", ErrInvalid, models.InventoryFill, models.InventoryAdjustment)
+	}
+
+	return nil
+}
+
+// inventory reads the prescription's ledger and projects it over the
+// regimen's pending doses.
+func inventory(ctx context.Context, q *sqlc.Queries, prescription sqlc.Prescription, regimen sqlc.Regimen) (*models.Inventory, error) {
+	entries, err := q.GetInventory(ctx, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &models.Inventory{
+		PrescriptionID: prescription.ID,
+		Entries:        make([]models.InventoryEntry, 0, len(entries)),
+	}
+
+	for _, entry := range entries {
+		inv.OnHand += entry.Quantity
+		inv.Entries = append(inv.Entries, toInventoryEntry(entry))
+	}
+
+	if prescription.LowSupply.Valid {
+		inv.LowSupply = &prescription.LowSupply.Float64
+		inv.Low = len(entries) > 0 && inv.OnHand <= prescription.LowSupply.Float64
+	}
+
+	if len(entries) == 0 {
+		return inv, nil
+	}
+
+	doses, err := q.GetUpcomingDoses(ctx, regimen.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	left := inv.OnHand
+	for _, dose := range doses {
+		if dose.Amount-left > inventoryEpsilon {
+			at := time.Unix(dose.Time, 0)
+			if dose.SnoozedUntil.Valid {
+				at = time.Unix(dose.SnoozedUntil.Int64, 0)
+			}
+			inv.RunsOut = &at
+			break
+		}
+
+		left -= dose.Amount
+	}
+
+	return inv, nil
+}
+
+// syncDoseInventory brings the ledger in line with dose, which was just
+// logged, undone or edited: a taken dose uses up what was taken, anything
+// else uses up nothing.
+func syncDoseInventory(ctx context.Context, q *sqlc.Queries, prescriptionID string, dose sqlc.Dose, actor string) error {
+	onHand, err := q.GetOnHand(ctx, prescriptionID)
+	if err != nil {
+		return err
+	}
+
+	if onHand.Entries == 0 {
+		return nil
+	}
+
+	want := 0.0
+	if dose.Taken.Valid && dose.Taken.Bool {
+		want = -dose.Amount
+		if dose.AmountTaken.Valid {
+			want = -dose.AmountTaken.Float64
+		}
+	}
+
+	doseID := sql.NullString{String: dose.ID, Valid: true}
+	used, err := q.GetDoseInventoryUse(ctx, doseID)
+	if err != nil {
+		return err
+	}
+
+	if math.Abs(want-used) < inventoryEpsilon {
+		return nil
+	}
+
+	params := sqlc.CreateInventoryEntryParams{
+		ID:             uuid.NewString(),
+		PrescriptionID: prescriptionID,
+		Kind:           string(models.InventoryDose),
+		Quantity:       want - used,
+		DoseID:         doseID,
+		Note:           "",
+		Actor:          actor,
+		Time:           time.Now().Unix(),
+	}
+	_, err = q.CreateInventoryEntry(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	// Undoing a dose puts it back, which can lift the supply out of low
+	return q.RearmLowSupply(ctx, prescriptionID)
+}
+
+func toInventoryEntry(entry sqlc.Inventory) models.InventoryEntry {
+	return models.InventoryEntry{
+		ID:       entry.ID,
+		Kind:     models.InventoryKind(entry.Kind),
+		Quantity: entry.Quantity,
+		DoseID:   entry.DoseID.String,
+		Note:     entry.Note,
+		Actor:    entry.Actor,
+		Time:     time.Unix(entry.Time, 0),
+	}
+}
@@ -0,0 +1,269 @@
+package manager
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+const (
+	defaultInviteExpiry = 7 * 24 * time.Hour
+	maxInviteExpiry     = 30 * 24 * time.Hour
+	maxInviteUses       = 100
+
+	// Users get this many wrong codes per window
+	maxInviteFailures   = 5
+	inviteFailureWindow = 15 * time.Minute
+)
+
+// Codes are read out and typed, so letters and digits that look alike are
+// left out
+const inviteAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const inviteCodeLength = 10
+
+// CreateInvite creates an invite code for the user. The code is only ever
+// returned here; it is stored hashed.
+func (h *Handler) CreateInvite(ctx context.Context, uid string, req *models.InviteRequest) (_ *models.Invite, err error) {
+	ctx, done := koko.Operation(ctx, "handler_create_invite")
+	defer done(&ctx, &err)
+
+	uses := req.MaxUses
+	if uses == 0 {
+		uses = 1
+	}
+	if uses < 0 || uses > maxInviteUses {
+		return nil, fmt.Errorf("%w: invites can be used 1 to %d times", ErrInvalid, maxInviteUses)
+	}
+
+	expiry := defaultInviteExpiry
+	if req.ExpiresIn != nil {
+		expiry = req.ExpiresIn.Duration
+	}
+	if expiry <= 0 || expiry > maxInviteExpiry {
+		return nil, fmt.Errorf("%w: invites must expire within %s", ErrInvalid, maxInviteExpiry)
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	params := sqlc.CreateInviteParams{
+		ID:        uuid.NewString(),
+		CodeHash:  hashInviteCode(code),
+		CreatedBy: uid,
+		MaxUses:   int64(uses),
+		ExpiresAt: now.Add(expiry).Unix(),
+		CreatedAt: now.Unix(),
+	}
+	created, err := h.Queries.CreateInvite(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	invite := toInvite(created)
+	invite.Code = code
+
+	return invite, nil
+}
+
+// Invites returns the invites the user created, newest first.
+func (h *Handler) Invites(ctx context.Context, uid string) (_ []models.Invite, err error) {
+	ctx, done := koko.Operation(ctx, "handler_get_invites")
+	defer done(&ctx, &err)
+
+	rows, err := h.Queries.GetInvitesByCreator(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	invites := make([]models.Invite, 0, len(rows))
+	for _, row := range rows {
+		invites = append(invites, *toInvite(row))
+	}
+
+	return invites, nil
+}
+
+// RedeemInvite approves the pending user with an invite code. The approval
+// is recorded as a decision by whoever created the invite. Codes that
+// don't work count against the user, and once they have had too many
+// recently they get ErrRateLimited without the code being looked at.
+func (h *Handler) RedeemInvite(ctx context.Context, uid string, code string) (_ *models.User, err error) {
+	ctx, done := koko.Operation(ctx, "handler_redeem_invite")
+	defer done(&ctx, &err)
+
+	now := time.Now()
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	failuresParams := sqlc.CountInviteFailuresParams{
+		UserID: uid,
+		Since:  now.Add(-inviteFailureWindow).Unix(),
+	}
+	failures, err := q.CountInviteFailures(ctx, failuresParams)
+	if err != nil {
+		return nil, err
+	}
+
+	if failures >= maxInviteFailures {
+		return nil, fmt.Errorf("%w: too many invalid codes, try again later", ErrRateLimited)
+	}
+
+	user, err := q.GetUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if models.UserStatus(user.Status) != models.UserPending {
+		return nil, fmt.Errorf("%w: user is %s", ErrConflict, user.Status)
+	}
+
+	invite, err := q.GetInviteByCode(ctx, hashInviteCode(code))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	used := int64(0)
+	if err == nil {
+		params := sqlc.UseInviteParams{
+			ID:  invite.ID,
+			Now: now.Unix(),
+		}
+		used, err = q.UseInvite(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if used == 0 {
+		params := sqlc.CreateInviteFailureParams{
+			ID:     uuid.NewString(),
+			UserID: uid,
+			Time:   now.Unix(),
+		}
+		err = q.CreateInviteFailure(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%w: invite code is invalid, used up or expired", ErrInvalid)
+	}
+
+	redemptionParams := sqlc.CreateInviteRedemptionParams{
+		InviteID: invite.ID,
+		UserID:   uid,
+		Time:     now.Unix(),
+	}
+	err = q.CreateInviteRedemption(ctx, redemptionParams)
+	if err != nil {
+		return nil, err
+	}
+
+	statusParams := sqlc.SetUserStatusParams{
+		Status:  string(models.UserApproved),
+		ID:      uid,
+		Current: user.Status,
+	}
+	updated, err := q.SetUserStatus(ctx, statusParams)
+	if err != nil {
+		return nil, err
+	}
+
+	if updated == 0 {
+		return nil, fmt.Errorf("%w: user was changed by someone else", ErrConflict)
+	}
+
+	decisionParams := sqlc.CreateUserDecisionParams{
+		ID:       uuid.NewString(),
+		UserID:   uid,
+		Decision: string(models.UserApproved),
+		Reason:   fmt.Sprintf("redeemed invite %s", invite.ID),
+		Actor:    invite.CreatedBy,
+		Time:     now.Unix(),
+	}
+	_, err = q.CreateUserDecision(ctx, decisionParams)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	user.Status = string(models.UserApproved)
+	user.Approved = true
+
+	return toUser(user), nil
+}
+
+// newInviteCode makes a random code, grouped in fives like ABCDE-FGHJK.
+func newInviteCode() (string, error) {
+	b := make([]byte, inviteCodeLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	var code strings.Builder
+	for i, c := range b {
+		if i > 0 && i%5 == 0 {
+			code.WriteByte('-')
+		}
+		// 256 is a multiple of the alphabet's 32 letters, so this isn't
+		// biased
+		code.WriteByte(inviteAlphabet[int(c)%len(inviteAlphabet)])
+	}
+
+	return code.String(), nil
+}
+
+// hashInviteCode hashes code ignoring case, spaces and dashes, so however
+// it was typed in it matches.
+func hashInviteCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func toInvite(invite sqlc.Invite) *models.Invite {
+	return &models.Invite{
+		ID:        invite.ID,
+		CreatedBy: invite.CreatedBy,
+		MaxUses:   int(invite.MaxUses),
+		Uses:      int(invite.Uses),
+		ExpiresAt: time.Unix(invite.ExpiresAt, 0),
+		CreatedAt: time.Unix(invite.CreatedAt, 0),
+	}
+}
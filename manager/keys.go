@@ -0,0 +1,203 @@
+package manager
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+const maxAPIKeyName = 100
+
+// The random part of a key, before it is hex encoded
+const apiKeyBytes = 32
+
+// keyScopeGrants is the grant each scope allows, which is checked the same
+// way as a caregiver's.
+var keyScopeGrants = map[models.KeyScope]models.Grant{
+	models.KeyScopeRead:     models.GrantView,
+	models.KeyScopeLogDoses: models.GrantLog,
+}
+
+// CreateAPIKey creates an API key for the user. The key is only ever
+// returned here; it is stored hashed.
+func (h *Handler) CreateAPIKey(ctx context.Context, uid string, req *models.APIKeyRequest) (_ *models.APIKey, err error) {
+	ctx, done := koko.Operation(ctx, "handler_create_api_key")
+	defer done(&ctx, &err)
+
+	name := strings.Join(strings.Fields(req.Name), " ")
+	if name == "" || len(name) > maxAPIKeyName {
+		return nil, fmt.Errorf("%w: keys need a name of up to %d characters", ErrInvalid, maxAPIKeyName)
+	}
+
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: keys need at least one scope", ErrInvalid)
+	}
+
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if _, ok := keyScopeGrants[scope]; !ok {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalid, scope)
+		}
+		if !slices.Contains(scopes, string(scope)) {
+			scopes = append(scopes, string(scope))
+		}
+	}
+
+	key, err := newAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	params := sqlc.CreateAPIKeyParams{
+		ID:        uuid.NewString(),
+		UserID:    uid,
+		Name:      name,
+		KeyHash:   hashAPIKey(key),
+		Scopes:    strings.Join(scopes, " "),
+		CreatedAt: time.Now().Unix(),
+	}
+	created, err := h.Queries.CreateAPIKey(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey := toAPIKey(created)
+	apiKey.Key = key
+
+	return apiKey, nil
+}
+
+// APIKeys returns the user's API keys, revoked ones included, newest first.
+func (h *Handler) APIKeys(ctx context.Context, uid string) (_ []models.APIKey, err error) {
+	ctx, done := koko.Operation(ctx, "handler_get_api_keys")
+	defer done(&ctx, &err)
+
+	rows, err := h.Queries.GetAPIKeysByUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]models.APIKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, *toAPIKey(row))
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey stops the user's API key id from working. Keys that are
+// already revoked are ErrNotFound.
+func (h *Handler) RevokeAPIKey(ctx context.Context, uid string, id string) (err error) {
+	ctx, done := koko.Operation(ctx, "handler_revoke_api_key")
+	defer done(&ctx, &err)
+
+	params := sqlc.RevokeAPIKeyParams{
+		Now:    sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
+		ID:     id,
+		UserID: uid,
+	}
+	revoked, err := h.Queries.RevokeAPIKey(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	if revoked == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey looks up the API key that hasn't been revoked and
+// records that it was used. Keys that don't exist are ErrNotFound.
+func (h *Handler) AuthenticateAPIKey(ctx context.Context, key string) (_ *models.APIKey, err error) {
+	ctx, done := koko.Operation(ctx, "handler_authenticate_api_key")
+	defer done(&ctx, &err)
+
+	row, err := h.Queries.GetAPIKeyByHash(ctx, hashAPIKey(key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	params := sqlc.UseAPIKeyParams{
+		Now: sql.NullInt64{Int64: now.Unix(), Valid: true},
+		ID:  row.ID,
+	}
+	err = h.Queries.UseAPIKey(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey := toAPIKey(row)
+	apiKey.LastUsedAt = &now
+
+	return apiKey, nil
+}
+
+// keyAllows reports whether a key with scopes can do what needs grant.
+func keyAllows(scopes []models.KeyScope, grant models.Grant) bool {
+	for _, scope := range scopes {
+		if grantLevels[keyScopeGrants[scope]] >= grantLevels[grant] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newAPIKey makes a random key, like pm_ followed by 64 hex digits.
+func newAPIKey() (string, error) {
+	b := make([]byte, apiKeyBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return models.APIKeyPrefix + hex.EncodeToString(b), nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func toAPIKey(key sqlc.ApiKey) *models.APIKey {
+	apiKey := &models.APIKey{
+		ID:        key.ID,
+		User:      key.UserID,
+		Name:      key.Name,
+		CreatedAt: time.Unix(key.CreatedAt, 0),
+	}
+
+	for _, scope := range strings.Fields(key.Scopes) {
+		apiKey.Scopes = append(apiKey.Scopes, models.KeyScope(scope))
+	}
+
+	if key.LastUsedAt.Valid {
+		lastUsed := time.Unix(key.LastUsedAt.Int64, 0)
+		apiKey.LastUsedAt = &lastUsed
+	}
+
+	if key.RevokedAt.Valid {
+		revoked := time.Unix(key.RevokedAt.Int64, 0)
+		apiKey.RevokedAt = &revoked
+	}
+
+	return apiKey
+}
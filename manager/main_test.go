@@ -0,0 +1,20 @@
+package manager
+
+import (
+	"os"
+	"testing"
+
+	"github.com/kzs0/kokoro"
+)
+
+// Handlers are instrumented, so kokoro has to be up before they run
+func TestMain(m *testing.M) {
+	_, done, err := kokoro.Init()
+	if err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	done()
+	os.Exit(code)
+}
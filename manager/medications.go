@@ -0,0 +1,214 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+const (
+	defaultSearchResults = 20
+	maxSearchResults     = 100
+)
+
+// SearchMedications returns catalog medications whose name or brand starts
+// with search, up to limit of them. An empty search lists the catalog.
+func (h *Handler) SearchMedications(ctx context.Context, search string, limit int) (_ []models.Medication, err error) {
+	ctx, done := koko.Operation(ctx, "handler_search_medications")
+	defer done(&ctx, &err)
+
+	if limit <= 0 {
+		limit = defaultSearchResults
+	}
+	limit = min(limit, maxSearchResults)
+
+	params := sqlc.SearchMedicationsParams{
+		Pattern:    globPrefix(normalizeKey(search)),
+		MaxResults: int64(limit),
+	}
+	rows, err := h.Queries.SearchMedications(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	medications := make([]models.Medication, 0, len(rows))
+	for _, row := range rows {
+		medications = append(medications, toMedication(row))
+	}
+
+	return medications, nil
+}
+
+// ImportMedications adds the medications that aren't in the catalog yet
+// and returns how many were added.
+func (h *Handler) ImportMedications(ctx context.Context, medications []models.Medication) (_ int, err error) {
+	ctx, done := koko.Operation(ctx, "handler_import_medications")
+	defer done(&ctx, &err)
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	added := 0
+	for i, medication := range medications {
+		medication.ID = ""
+
+		_, created, err := catalogMedication(ctx, q, medication)
+		if err != nil {
+			return 0, fmt.Errorf("medication %d: %w", i+1, err)
+		}
+
+		if created {
+			added++
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return added, nil
+}
+
+// catalogMedication looks medication up in the catalog, by ID if it has
+// one and by name, brand, strength and form otherwise, adding it if it
+// isn't there. It reports whether it was added.
+//
+// Medications are a catalog shared by every patient. A medication is
+// identified by its name, brand, strength and form, compared case
+// insensitively and ignoring extra spaces, so "Ibuprofen  200 mg" and
+// "ibuprofen 200 MG" tablets are the same drug.
+func catalogMedication(ctx context.Context, q *sqlc.Queries, medication models.Medication) (sqlc.Medication, bool, error) {
+	if medication.ID != "" {
+		row, err := q.GetMedication(ctx, medication.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return row, false, fmt.Errorf("%w: unknown medication %q", ErrInvalid, medication.ID)
+		}
+
+		return row, false, err
+	}
+
+	name := strings.Join(strings.Fields(medication.Name), " ")
+	if name == "" {
+		return sqlc.Medication{}, false, fmt.Errorf("%w: medication needs a name", ErrInvalid)
+	}
+
+	err := validateMedicationKind(medication)
+	if err != nil {
+		return sqlc.Medication{}, false, err
+	}
+
+	brand := strings.Join(strings.Fields(medication.Brand), " ")
+	strength := formatStrength(medication.Strength)
+
+	keyParams := sqlc.GetMedicationByKeyParams{
+		NameKey:     normalizeKey(name),
+		BrandKey:    normalizeKey(brand),
+		StrengthKey: normalizeKey(strength),
+		Form:        string(medication.Form),
+	}
+	row, err := q.GetMedicationByKey(ctx, keyParams)
+	if err == nil {
+		return row, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return row, false, err
+	}
+
+	params := sqlc.CreateMedicationParams{
+		ID:          uuid.NewString(),
+		Name:        name,
+		Generic:     medication.Generic,
+		Brand:       brand,
+		Strength:    strength,
+		NameKey:     keyParams.NameKey,
+		BrandKey:    keyParams.BrandKey,
+		StrengthKey: keyParams.StrengthKey,
+		Form:        keyParams.Form,
+		Route:       string(medication.Route),
+	}
+	if medication.Strength != nil {
+		params.StrengthValue = sql.NullFloat64{Float64: medication.Strength.Value, Valid: true}
+		params.StrengthUnit = strings.Join(strings.Fields(medication.Strength.Unit), " ")
+	}
+	row, err = q.CreateMedication(ctx, params)
+	if err != nil {
+		return row, false, err
+	}
+
+	return row, true, nil
+}
+
+// normalizeKey builds catalog keys, the same way migrations rebuild them.
+func normalizeKey(s string) string {
+	return db.NormalizeKey(s)
+}
+
+// globPrefix builds a GLOB pattern matching strings that start with prefix.
+func globPrefix(prefix string) string {
+	var b strings.Builder
+	for _, r := range prefix {
+		switch r {
+		case '*', '?', '[':
+			b.WriteByte('[')
+			b.WriteRune(r)
+			b.WriteByte(']')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('*')
+
+	return b.String()
+}
+
+// medicationForm is the form of the medication a prescription is being
+// written for, which may only be in the catalog.
+func medicationForm(ctx context.Context, q *sqlc.Queries, medication models.Medication) (models.DosageForm, error) {
+	if medication.ID == "" {
+		return medication.Form, validateMedicationKind(medication)
+	}
+
+	row, err := q.GetMedication(ctx, medication.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: unknown medication %q", ErrInvalid, medication.ID)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return models.DosageForm(row.Form), nil
+}
+
+func toMedication(medication sqlc.Medication) models.Medication {
+	return models.Medication{
+		ID:       medication.ID,
+		Name:     medication.Name,
+		Generic:  medication.Generic,
+		Brand:    medication.Brand,
+		Strength: toStrength(medication.StrengthValue, medication.StrengthUnit),
+		Form:     models.DosageForm(medication.Form),
+		Route:    models.Route(medication.Route),
+	}
+}
+
+func toStrength(value sql.NullFloat64, unit string) *models.Strength {
+	if !value.Valid {
+		return nil
+	}
+
+	return &models.Strength{Value: value.Float64, Unit: unit}
+}
@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+	"github.com/kzs0/pill_manager/pkg/notify"
+)
+
+// AddNotificationTarget starts delivering the user's reminders to target.
+func (h *Handler) AddNotificationTarget(ctx context.Context, uid string, target *models.NotificationTarget) (_ *models.NotificationTarget, err error) {
+	ctx, done := koko.Operation(ctx, "handler_add_notification_target")
+	defer done(&ctx, &err)
+
+	err = validateTarget(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	params := sqlc.CreateNotificationTargetParams{
+		ID:        uuid.NewString(),
+		UserID:    uid,
+		Channel:   string(target.Channel),
+		Address:   target.Address,
+		CreatedAt: time.Now().Unix(),
+	}
+	created, err := h.Queries.CreateNotificationTarget(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return toNotificationTarget(created), nil
+}
+
+func (h *Handler) GetNotificationTargets(ctx context.Context, uid string) (_ []models.NotificationTarget, err error) {
+	ctx, done := koko.Operation(ctx, "handler_get_notification_targets")
+	defer done(&ctx, &err)
+
+	rows, err := h.Queries.GetNotificationTargets(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]models.NotificationTarget, 0, len(rows))
+	for _, row := range rows {
+		targets = append(targets, *toNotificationTarget(row))
+	}
+
+	return targets, nil
+}
+
+func (h *Handler) DeleteNotificationTarget(ctx context.Context, uid string, id string) (err error) {
+	ctx, done := koko.Operation(ctx, "handler_delete_notification_target")
+	defer done(&ctx, &err)
+
+	params := sqlc.DeleteNotificationTargetParams{
+		ID:     id,
+		UserID: uid,
+	}
+	deleted, err := h.Queries.DeleteNotificationTarget(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// validateTarget checks the target's address. Webhooks and push endpoints
+// have to be public https URLs, so users can't point the server at itself
+// or its network.
+func validateTarget(ctx context.Context, target *models.NotificationTarget) error {
+	switch target.Channel {
+	case models.ChannelWebhook:
+		err := notify.CheckPublicURL(ctx, target.Address)
+		if err != nil {
+			return fmt.Errorf("%w: webhook address must be a public https URL: %w", ErrInvalid, err)
+		}
+	case models.ChannelEmail:
+		_, err := mail.ParseAddress(target.Address)
+		if err != nil {
+			return fmt.Errorf("%w: invalid email address: %w", ErrInvalid, err)
+		}
+	case models.ChannelWebPush:
+		sub, err := notify.ParseSubscription(target.Address)
+		if err != nil {
+			return fmt.Errorf("%w: invalid push subscription: %w", ErrInvalid, err)
+		}
+
+		err = notify.CheckPublicURL(ctx, sub.Endpoint)
+		if err != nil {
+			return fmt.Errorf("%w: push endpoint must be a public https URL: %w", ErrInvalid, err)
+		}
+	default:
+		return fmt.Errorf("%w: unknown channel %q", ErrInvalid, target.Channel)
+	}
+
+	return nil
+}
+
+func toNotificationTarget(target sqlc.NotificationTarget) *models.NotificationTarget {
+	return &models.NotificationTarget{
+		ID:        target.ID,
+		Channel:   models.Channel(target.Channel),
+		Address:   target.Address,
+		CreatedAt: time.Unix(target.CreatedAt, 0),
+	}
+}
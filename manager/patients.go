@@ -0,0 +1,274 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+// Patients returns the patients the user can act on: themselves, their
+// dependents and the patients they are a caregiver for.
+func (h *Handler) Patients(ctx context.Context, uid string) (_ []models.Patient, err error) {
+	ctx, done := koko.Operation(ctx, "handler_get_patients")
+	defer done(&ctx, &err)
+
+	rows, err := h.Queries.GetUserPatients(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	patients := make([]models.Patient, 0, len(rows))
+	for _, row := range rows {
+		patients = append(patients, models.Patient{
+			ID:       row.ID,
+			Name:     row.Name,
+			User:     row.UserID.String,
+			Owner:    row.Owner,
+			TimeZone: row.TimeZone,
+			Grant:    models.Grant(row.GrantLevel),
+		})
+	}
+
+	return patients, nil
+}
+
+// AddPatient adds a dependent owned by the user. Dependents don't log in,
+// so their time zone is their own.
+func (h *Handler) AddPatient(ctx context.Context, uid string, patient *models.Patient) (_ *models.Patient, err error) {
+	ctx, done := koko.Operation(ctx, "handler_add_patient")
+	defer done(&ctx, &err)
+
+	name := strings.TrimSpace(patient.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: patient needs a name", ErrInvalid)
+	}
+
+	if patient.TimeZone != "" {
+		_, err = time.LoadLocation(patient.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalid, patient.TimeZone)
+		}
+	}
+
+	params := sqlc.CreatePatientParams{
+		ID:        uuid.NewString(),
+		Name:      name,
+		Owner:     uid,
+		TimeZone:  patient.TimeZone,
+		CreatedAt: time.Now().Unix(),
+	}
+	created, err := h.Queries.CreatePatient(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Patient{
+		ID:       created.ID,
+		Name:     created.Name,
+		Owner:    created.Owner,
+		TimeZone: created.TimeZone,
+		Grant:    models.GrantManage,
+	}, nil
+}
+
+// SetPatientTimeZone changes the home zone of a dependent the user owns,
+// moving their pending doses like SetTimeZone does. Patients that log in
+// follow their own user's zone instead. It returns the number of doses
+// moved.
+func (h *Handler) SetPatientTimeZone(ctx context.Context, uid string, patient string, name string) (_ *models.Patient, moved int, err error) {
+	ctx, done := koko.Operation(ctx, "handler_set_patient_time_zone")
+	defer done(&ctx, &err)
+
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "" {
+		return nil, 0, fmt.Errorf("%w: unknown time zone %q", ErrInvalid, name)
+	}
+
+	acc, err := h.ownPatient(ctx, uid, patient)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	row, err := q.GetPatient(ctx, acc.Patient)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if row.UserID.Valid {
+		return nil, 0, fmt.Errorf("%w: patients that log in set their own time zone", ErrInvalid)
+	}
+
+	if row.TimeZone != name {
+		moved, err = reanchorDoses(ctx, q, acc.Patient, row.TimeZone, loc)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	params := sqlc.SetPatientTimeZoneParams{
+		TimeZone: name,
+		ID:       acc.Patient,
+	}
+	err = q.SetPatientTimeZone(ctx, params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &models.Patient{
+		ID:       row.ID,
+		Name:     row.Name,
+		Owner:    row.Owner,
+		TimeZone: name,
+		Grant:    models.GrantManage,
+	}, moved, nil
+}
+
+// Caregivers returns who the user's patient has given access to. Only the
+// patient's owner can see them.
+func (h *Handler) Caregivers(ctx context.Context, uid string, patient string) (_ []models.Caregiver, err error) {
+	ctx, done := koko.Operation(ctx, "handler_get_caregivers")
+	defer done(&ctx, &err)
+
+	acc, err := h.ownPatient(ctx, uid, patient)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := h.Queries.GetCaregivers(ctx, acc.Patient)
+	if err != nil {
+		return nil, err
+	}
+
+	caregivers := make([]models.Caregiver, 0, len(rows))
+	for _, row := range rows {
+		caregivers = append(caregivers, toCaregiver(row))
+	}
+
+	return caregivers, nil
+}
+
+// SetCaregiver gives a user access to the user's patient, or changes the
+// access they already have.
+func (h *Handler) SetCaregiver(ctx context.Context, uid string, patient string, caregiver *models.Caregiver) (_ *models.Caregiver, err error) {
+	ctx, done := koko.Operation(ctx, "handler_set_caregiver")
+	defer done(&ctx, &err)
+
+	if _, ok := grantLevels[caregiver.Grant]; !ok {
+		return nil, fmt.Errorf("%w: unknown grant %q", ErrInvalid, caregiver.Grant)
+	}
+
+	acc, err := h.ownPatient(ctx, uid, patient)
+	if err != nil {
+		return nil, err
+	}
+
+	if caregiver.User == uid || caregiver.User == acc.Patient {
+		return nil, fmt.Errorf("%w: the patient and their owner already have access", ErrInvalid)
+	}
+
+	_, err = h.Queries.GetUser(ctx, caregiver.User)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: unknown user %q", ErrInvalid, caregiver.User)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	params := sqlc.SetCaregiverParams{
+		PatientID:  acc.Patient,
+		UserID:     caregiver.User,
+		GrantLevel: string(caregiver.Grant),
+		GrantedBy:  uid,
+		GrantedAt:  time.Now().Unix(),
+	}
+	row, err := h.Queries.SetCaregiver(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	created := toCaregiver(row)
+	return &created, nil
+}
+
+// RemoveCaregiver takes away a caregiver's access to a patient. The
+// patient's owner can remove anyone, and caregivers can remove themselves.
+func (h *Handler) RemoveCaregiver(ctx context.Context, uid string, patient string, user string) (err error) {
+	ctx, done := koko.Operation(ctx, "handler_remove_caregiver")
+	defer done(&ctx, &err)
+
+	if user != uid {
+		acc, err := h.ownPatient(ctx, uid, patient)
+		if err != nil {
+			return err
+		}
+		patient = acc.Patient
+	}
+
+	params := sqlc.DeleteCaregiverParams{
+		PatientID: patient,
+		UserID:    user,
+	}
+	deleted, err := h.Queries.DeleteCaregiver(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ownPatient checks that uid owns patient. Patients they can't see at all
+// are ErrNotFound, and ones they are only a caregiver for ErrForbidden.
+func (h *Handler) ownPatient(ctx context.Context, uid string, patient string) (Access, error) {
+	acc, err := h.Authorize(ctx, uid, patient, models.GrantView)
+	if err != nil {
+		return acc, err
+	}
+
+	row, err := h.Queries.GetPatient(ctx, acc.Patient)
+	if errors.Is(err, sql.ErrNoRows) {
+		return acc, ErrNotFound
+	}
+	if err != nil {
+		return acc, err
+	}
+
+	if row.Owner != uid {
+		return acc, fmt.Errorf("%w: only the patient's owner can manage the patient", ErrForbidden)
+	}
+
+	return acc, nil
+}
+
+func toCaregiver(row sqlc.Caregiver) models.Caregiver {
+	return models.Caregiver{
+		User:      row.UserID,
+		Grant:     models.Grant(row.GrantLevel),
+		GrantedBy: row.GrantedBy,
+		GrantedAt: time.Unix(row.GrantedAt, 0),
+	}
+}
@@ -0,0 +1,50 @@
+package manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kzs0/pill_manager/models"
+)
+
+func TestDependentPrescriptions(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t)
+
+	alice := newTestUser(t, h, "alice")
+
+	kid, err := h.AddPatient(ctx, alice.User, &models.Patient{Name: "Kid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acc, err := h.Authorize(ctx, alice.User, kid.ID, models.GrantManage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Dependents aren't users, so this only works once prescriptions and
+	// regimens are keyed by patients
+	rx, doses := newTestRx(t, h, acc, time.Now().Add(time.Hour))
+
+	got, err := h.GetPerscription(ctx, rx.ID, acc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != rx.ID {
+		t.Errorf("got %q, want %q", got.ID, rx.ID)
+	}
+
+	own, err := h.GetScheduledDoses(ctx, alice, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, regimen := range own {
+		for _, dose := range regimen.Doses {
+			if dose.ID == doses[0].ID {
+				t.Errorf("dependent's dose %s is in alice's schedule", dose.ID)
+			}
+		}
+	}
+}
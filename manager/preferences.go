@@ -0,0 +1,187 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+const (
+	defaultSnooze         = 15 * time.Minute
+	maxLeadTime           = 24 * time.Hour
+	defaultRefillLeadDays = 3
+	maxRefillLeadDays     = 30
+)
+
+// GetPreferences returns the user's reminder preferences. Users that never
+// set any get the zero Preferences, which uses every default.
+func (h *Handler) GetPreferences(ctx context.Context, uid string) (_ *models.Preferences, err error) {
+	ctx, done := koko.Operation(ctx, "handler_get_preferences")
+	defer done(&ctx, &err)
+
+	row, err := h.Queries.GetUserPreferences(ctx, uid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.Preferences{Channels: []models.Channel{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return toPreferences(row), nil
+}
+
+// SetPreferences replaces the user's reminder preferences.
+func (h *Handler) SetPreferences(ctx context.Context, uid string, prefs *models.Preferences) (_ *models.Preferences, err error) {
+	ctx, done := koko.Operation(ctx, "handler_set_preferences")
+	defer done(&ctx, &err)
+
+	err = validatePreferences(prefs)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make([]string, 0, len(prefs.Channels))
+	for _, channel := range prefs.Channels {
+		channels = append(channels, string(channel))
+	}
+
+	params := sqlc.SetUserPreferencesParams{
+		UserID:   uid,
+		Channels: strings.Join(channels, ","),
+		LeadTime: nullDuration(prefs.LeadTime),
+		Snooze:   nullDuration(prefs.Snooze),
+	}
+	if prefs.QuietHours != nil {
+		params.QuietStart = nullDuration(&prefs.QuietHours.Start)
+		params.QuietEnd = nullDuration(&prefs.QuietHours.End)
+	}
+	if prefs.RefillLeadDays != nil {
+		params.RefillLeadDays = sql.NullInt64{Int64: int64(*prefs.RefillLeadDays), Valid: true}
+	}
+
+	row, err := h.Queries.SetUserPreferences(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return toPreferences(row), nil
+}
+
+// ResetPreferences puts the user back on the defaults.
+func (h *Handler) ResetPreferences(ctx context.Context, uid string) (err error) {
+	ctx, done := koko.Operation(ctx, "handler_reset_preferences")
+	defer done(&ctx, &err)
+
+	return h.Queries.DeleteUserPreferences(ctx, uid)
+}
+
+func validatePreferences(prefs *models.Preferences) error {
+	seen := make(map[models.Channel]bool, len(prefs.Channels))
+	for _, channel := range prefs.Channels {
+		switch channel {
+		case models.ChannelWebhook, models.ChannelEmail, models.ChannelWebPush:
+		default:
+			return fmt.Errorf("%w: unknown channel %q", ErrInvalid, channel)
+		}
+
+		if seen[channel] {
+			return fmt.Errorf("%w: channel %q is listed twice", ErrInvalid, channel)
+		}
+		seen[channel] = true
+	}
+
+	if prefs.LeadTime != nil && (prefs.LeadTime.Duration < 0 || prefs.LeadTime.Duration > maxLeadTime) {
+		return fmt.Errorf("%w: lead time must be between 0 and %s", ErrInvalid, maxLeadTime)
+	}
+
+	if prefs.Snooze != nil && (prefs.Snooze.Duration < time.Minute || prefs.Snooze.Duration > 24*time.Hour) {
+		return fmt.Errorf("%w: snooze must be between 1m and 24h", ErrInvalid)
+	}
+
+	if days := prefs.RefillLeadDays; days != nil && (*days < 0 || *days > maxRefillLeadDays) {
+		return fmt.Errorf("%w: refill lead days must be between 0 and %d", ErrInvalid, maxRefillLeadDays)
+	}
+
+	if quiet := prefs.QuietHours; quiet != nil {
+		for _, d := range []time.Duration{quiet.Start.Duration, quiet.End.Duration} {
+			if d < 0 || d >= 24*time.Hour || d%time.Second != 0 {
+				return fmt.Errorf("%w: quiet hours must be whole seconds into the day", ErrInvalid)
+			}
+		}
+
+		if quiet.Start == quiet.End {
+			return fmt.Errorf("%w: quiet hours can't start and end at the same time", ErrInvalid)
+		}
+	}
+
+	return nil
+}
+
+func toPreferences(row sqlc.UserPreference) *models.Preferences {
+	prefs := &models.Preferences{
+		Channels: []models.Channel{},
+	}
+
+	if row.Channels != "" {
+		for _, channel := range strings.Split(row.Channels, ",") {
+			prefs.Channels = append(prefs.Channels, models.Channel(channel))
+		}
+	}
+
+	if row.LeadTime.Valid {
+		prefs.LeadTime = &models.Duration{Duration: time.Duration(row.LeadTime.Int64) * time.Second}
+	}
+
+	if row.Snooze.Valid {
+		prefs.Snooze = &models.Duration{Duration: time.Duration(row.Snooze.Int64) * time.Second}
+	}
+
+	if row.QuietStart.Valid && row.QuietEnd.Valid {
+		prefs.QuietHours = &models.QuietHours{
+			Start: models.Duration{Duration: time.Duration(row.QuietStart.Int64) * time.Second},
+			End:   models.Duration{Duration: time.Duration(row.QuietEnd.Int64) * time.Second},
+		}
+	}
+
+	if row.RefillLeadDays.Valid {
+		days := int(row.RefillLeadDays.Int64)
+		prefs.RefillLeadDays = &days
+	}
+
+	return prefs
+}
+
+// quietUntil returns when the quiet hours t falls in end, or false if t
+// isn't in quiet hours.
+func quietUntil(quiet *models.QuietHours, t time.Time, loc *time.Location) (time.Time, bool) {
+	if quiet == nil {
+		return time.Time{}, false
+	}
+
+	t = t.In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	start := addWallClock(midnight, quiet.Start.Duration)
+	end := addWallClock(midnight, quiet.End.Duration)
+
+	if quiet.Start.Duration < quiet.End.Duration {
+		return end, !t.Before(start) && t.Before(end)
+	}
+
+	// Spans midnight: the end of last night's quiet hours, or the start of
+	// tonight's
+	if t.Before(end) {
+		return end, true
+	}
+	if !t.Before(start) {
+		return addWallClock(midnight.AddDate(0, 0, 1), quiet.End.Duration), true
+	}
+
+	return time.Time{}, false
+}
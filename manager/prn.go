@@ -0,0 +1,230 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+// LogAsNeededDose records a dose of the patient's PRN prescription. A dose
+// that breaks the prescription's spacing or maximum is rejected with
+// ErrConflict when the limits are enforced and logged with warnings when they
+// aren't. Either way the returned status says when the next dose is allowed.
+func (h *Handler) LogAsNeededDose(ctx context.Context, id string, acc Access, dose models.AsNeededDose) (_ *models.AsNeededStatus, err error) {
+	ctx, done := koko.Operation(ctx, "handler_log_as_needed_dose")
+	defer done(&ctx, &err)
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	prescription, regimen, err := h.patientRegimen(ctx, q, id, acc.Patient)
+	if err != nil {
+		return nil, err
+	}
+
+	if prescription.DiscontinuedAt.Valid {
+		return nil, fmt.Errorf("%w: prescription is discontinued", ErrConflict)
+	}
+
+	prn, err := asNeededSchedule(prescription)
+	if err != nil {
+		return nil, err
+	}
+
+	taken, err := takenAsNeeded(ctx, q, regimen.ID, *prn, dose.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	status := asNeededStatus(*prn, taken, dose.Time)
+	if len(status.Warnings) > 0 && prn.Enforce {
+		return status, fmt.Errorf("%w: dose is outside the as needed limits", ErrConflict)
+	}
+
+	amount := dose.Amount
+	if amount == 0 {
+		amount = prn.Amount
+	}
+
+	params := sqlc.CreateTakenDoseParams{
+		ID:        uuid.NewString(),
+		RegimenID: regimen.ID,
+		Refill:    0,
+		Time:      dose.Time.Unix(),
+		Amount:    amount,
+		Unit:      prn.Unit,
+		TimeTaken: sql.NullInt64{Int64: dose.Time.Unix(), Valid: true},
+	}
+	created, err := q.CreateTakenDose(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordDoseEvent(ctx, q, created, models.DoseTaken, acc.User)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syncDoseInventory(ctx, q, prescription.ID, created, acc.User)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	after := asNeededStatus(*prn, append(taken, dose.Time), dose.Time)
+	after.Warnings = status.Warnings
+
+	return after, nil
+}
+
+// AsNeededStatus reports the patient's PRN doses against the prescription's
+// limits as of at.
+func (h *Handler) AsNeededStatus(ctx context.Context, id string, acc Access, at time.Time) (_ *models.AsNeededStatus, err error) {
+	ctx, done := koko.Operation(ctx, "handler_as_needed_status")
+	defer done(&ctx, &err)
+
+	prescription, regimen, err := h.patientRegimen(ctx, h.Queries, id, acc.Patient)
+	if err != nil {
+		return nil, err
+	}
+
+	prn, err := asNeededSchedule(prescription)
+	if err != nil {
+		return nil, err
+	}
+
+	taken, err := takenAsNeeded(ctx, h.Queries, regimen.ID, *prn, at)
+	if err != nil {
+		return nil, err
+	}
+
+	status := asNeededStatus(*prn, taken, at)
+	status.Warnings = nil
+
+	return status, nil
+}
+
+func asNeededSchedule(prescription sqlc.Prescription) (*models.AsNeeded, error) {
+	var schedule models.Schedule
+	err := json.Unmarshal(prescription.Schedule, &schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	if schedule.Kind != models.ScheduleAsNeeded || schedule.AsNeeded == nil {
+		return nil, fmt.Errorf("%w: prescription is not taken as needed", ErrInvalid)
+	}
+
+	return schedule.AsNeeded, nil
+}
+
+func validateAsNeeded(prn *models.AsNeeded) error {
+	if prn == nil {
+		return fmt.Errorf("%w: as needed schedule is missing its limits", ErrInvalid)
+	}
+
+	if prn.Amount <= 0 {
+		return fmt.Errorf("%w: as needed amount must be positive", ErrInvalid)
+	}
+
+	if prn.MinInterval.Duration < 0 || prn.MaxDoses < 0 {
+		return fmt.Errorf("%w: as needed limits can't be negative", ErrInvalid)
+	}
+
+	if prn.MaxDoses > 0 && prn.Window.Duration <= 0 {
+		return fmt.Errorf("%w: as needed maximum needs a window", ErrInvalid)
+	}
+
+	return nil
+}
+
+// takenAsNeeded returns the times of doses taken up to at that can still
+// count against the limits, oldest first.
+func takenAsNeeded(ctx context.Context, q *sqlc.Queries, regimenID string, prn models.AsNeeded, at time.Time) ([]time.Time, error) {
+	lookback := max(prn.MinInterval.Duration, prn.Window.Duration, 24*time.Hour)
+
+	params := sqlc.GetTakenDosesSinceParams{
+		RegimenID: regimenID,
+		TimeTaken: sql.NullInt64{Int64: at.Add(-lookback).Unix(), Valid: true},
+	}
+	doses, err := q.GetTakenDosesSince(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	taken := make([]time.Time, 0, len(doses))
+	for _, dose := range doses {
+		t := time.Unix(dose.TimeTaken.Int64, 0)
+		if t.After(at) {
+			break
+		}
+		taken = append(taken, t)
+	}
+
+	return taken, nil
+}
+
+// asNeededStatus checks a dose at at against the doses already taken,
+// oldest first, and works out when the next one is allowed.
+func asNeededStatus(prn models.AsNeeded, taken []time.Time, at time.Time) *models.AsNeededStatus {
+	status := &models.AsNeededStatus{
+		NextAllowed: at,
+	}
+
+	if len(taken) > 0 {
+		last := taken[len(taken)-1]
+		status.LastTaken = &last
+
+		if since := at.Sub(last); since < prn.MinInterval.Duration {
+			status.Warnings = append(status.Warnings, fmt.Sprintf(
+				"only %s since the last dose, the minimum is %s", since, prn.MinInterval.Duration))
+		}
+
+		if next := last.Add(prn.MinInterval.Duration); next.After(status.NextAllowed) {
+			status.NextAllowed = next
+		}
+	}
+
+	if prn.MaxDoses == 0 {
+		return status
+	}
+
+	windowStart := at.Add(-prn.Window.Duration)
+	inWindow := make([]time.Time, 0, len(taken))
+	for _, t := range taken {
+		if t.After(windowStart) {
+			inWindow = append(inWindow, t)
+		}
+	}
+
+	status.TakenInWindow = len(inWindow)
+
+	if len(inWindow) >= prn.MaxDoses {
+		status.Warnings = append(status.Warnings, fmt.Sprintf(
+			"%d doses in the last %s, the maximum is %d", len(inWindow), prn.Window.Duration, prn.MaxDoses))
+
+		// Once enough of the doses age out of the window
+		oldest := inWindow[len(inWindow)-prn.MaxDoses]
+		if next := oldest.Add(prn.Window.Duration); next.After(status.NextAllowed) {
+			status.NextAllowed = next
+		}
+	}
+
+	return status
+}
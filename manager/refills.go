@@ -0,0 +1,314 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+// RefillPerscription records a refill of the patient's prescription id
+// being picked up. It uses up one of the prescription's refills, schedules
+// another fill's worth of doses and enters the fill in the inventory.
+//
+// The new doses follow on from the last scheduled dose, or start at the fill
+// if it was picked up after the last dose, so a late refill doesn't leave
+// doses in the past.
+func (h *Handler) RefillPerscription(ctx context.Context, id string, acc Access, refill *models.Refill) (_ *models.Fill, err error) {
+	ctx, done := koko.Operation(ctx, "handler_refill_rx")
+	defer done(&ctx, &err)
+
+	if refill.Quantity < 0 {
+		return nil, fmt.Errorf("%w: quantity can't be negative", ErrInvalid)
+	}
+
+	at := time.Now()
+	if refill.Time != nil {
+		at = *refill.Time
+	}
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := h.Queries.WithTx(tx)
+
+	prescription, regimen, err := h.patientRegimen(ctx, q, id, acc.Patient)
+	if err != nil {
+		return nil, err
+	}
+
+	if prescription.DiscontinuedAt.Valid {
+		return nil, fmt.Errorf("%w: prescription is discontinued", ErrConflict)
+	}
+
+	used, err := q.UseRefill(ctx, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if used == 0 {
+		return nil, fmt.Errorf("%w: no refills remaining", ErrConflict)
+	}
+
+	var schedule models.Schedule
+	err = json.Unmarshal(prescription.Schedule, &schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	var planned []plannedDose
+	if schedule.Kind != models.ScheduleAsNeeded {
+		home, err := patientTimeZone(ctx, q, acc.Patient)
+		if err != nil {
+			return nil, err
+		}
+
+		loc, err := scheduleLocation(schedule, home, time.UTC)
+		if err != nil {
+			return nil, err
+		}
+
+		last, err := q.GetLastDoseTime(ctx, regimen.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		from := at
+		if next := time.Unix(last+1, 0); next.After(from) {
+			from = next
+		}
+
+		start := from
+		if prescription.ScheduledStart.Valid {
+			start = time.Unix(prescription.ScheduledStart.Int64, 0)
+		}
+
+		planned, err = planDoses(schedule, loc, start, from, int(prescription.Doses))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The ledger starts with this fill if it wasn't tracked before, so
+	// what is left of the earlier fills is estimated from their pending
+	// doses
+	onHand, err := q.GetOnHand(ctx, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if onHand.Entries == 0 {
+		pending, err := q.GetUpcomingDoses(ctx, regimen.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		left := 0.0
+		for _, dose := range pending {
+			left += dose.Amount
+		}
+
+		if left > 0 {
+			params := sqlc.CreateInventoryEntryParams{
+				ID:             uuid.NewString(),
+				PrescriptionID: prescription.ID,
+				Kind:           string(models.InventoryAdjustment),
+				Quantity:       left,
+				Note:           "left before refill, estimated from the schedule",
+				Actor:          acc.User,
+				Time:           at.Unix(),
+			}
+			_, err = q.CreateInventoryEntry(ctx, params)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	number := prescription.RefillsUsed + 1
+
+	quantity := refill.Quantity
+	if quantity == 0 {
+		for _, dose := range planned {
+			quantity += dose.Amount
+		}
+	}
+
+	for _, dose := range planned {
+		dosesParams := sqlc.CreateDoseParams{
+			ID:        uuid.NewString(),
+			RegimenID: regimen.ID,
+			Refill:    number,
+			Time:      dose.Time.Unix(),
+			Amount:    dose.Amount,
+			Unit:      dose.Unit,
+			Phase:     int64(dose.Phase),
+		}
+		_, err = q.CreateDose(ctx, dosesParams)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fillParams := sqlc.CreateFillParams{
+		ID:             uuid.NewString(),
+		PrescriptionID: prescription.ID,
+		Refill:         number,
+		Time:           at.Unix(),
+		Quantity:       quantity,
+		Pharmacy:       refill.Pharmacy,
+		Actor:          acc.User,
+	}
+	fill, err := q.CreateFill(ctx, fillParams)
+	if err != nil {
+		return nil, err
+	}
+
+	if quantity > 0 {
+		note := fmt.Sprintf("refill %d", number)
+		if refill.Pharmacy != "" {
+			note = fmt.Sprintf("refill %d from %s", number, refill.Pharmacy)
+		}
+
+		inventoryParams := sqlc.CreateInventoryEntryParams{
+			ID:             uuid.NewString(),
+			PrescriptionID: prescription.ID,
+			Kind:           string(models.InventoryFill),
+			Quantity:       quantity,
+			Note:           note,
+			Actor:          acc.User,
+			Time:           at.Unix(),
+		}
+		_, err = q.CreateInventoryEntry(ctx, inventoryParams)
+		if err != nil {
+			return nil, err
+		}
+
+		err = q.RearmLowSupply(ctx, prescription.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return toFill(fill, len(planned)), nil
+}
+
+func toFill(fill sqlc.Fill, doses int) *models.Fill {
+	return &models.Fill{
+		ID:       fill.ID,
+		Refill:   int(fill.Refill),
+		Time:     time.Unix(fill.Time, 0),
+		Quantity: fill.Quantity,
+		Pharmacy: fill.Pharmacy,
+		Doses:    doses,
+	}
+}
+
+// RefillForecast works out when the fills of the patient's prescription id
+// picked up so far run out and when the patient should ask the pharmacy for
+// the next one, the patient's refill lead days before. Both the schedule
+// and, once it is tracked, the inventory on hand are taken into account;
+// whichever runs out first wins.
+func (h *Handler) RefillForecast(ctx context.Context, id string, acc Access) (_ *models.RefillForecast, err error) {
+	ctx, done := koko.Operation(ctx, "handler_refill_forecast")
+	defer done(&ctx, &err)
+
+	prescription, regimen, err := h.patientRegimen(ctx, h.Queries, id, acc.Patient)
+	if err != nil {
+		return nil, err
+	}
+
+	if prescription.DiscontinuedAt.Valid {
+		return nil, fmt.Errorf("%w: prescription is discontinued", ErrConflict)
+	}
+
+	prefs, err := h.GetPreferences(ctx, acc.User)
+	if err != nil {
+		return nil, err
+	}
+
+	lead := defaultRefillLeadDays
+	if prefs.RefillLeadDays != nil {
+		lead = *prefs.RefillLeadDays
+	}
+
+	var schedule models.Schedule
+	err = json.Unmarshal(prescription.Schedule, &schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	home, err := patientTimeZone(ctx, h.Queries, acc.Patient)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := scheduleLocation(schedule, home, time.UTC)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := h.Queries.GetUpcomingDoses(ctx, regimen.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	forecast := &models.RefillForecast{
+		PrescriptionID:    prescription.ID,
+		DosesRemaining:    len(pending),
+		RefillsRemaining:  int(prescription.Refills - prescription.RefillsUsed),
+		LeadDays:          lead,
+		NeedsPrescription: prescription.RefillsUsed >= prescription.Refills,
+	}
+
+	if schedule.Kind != models.ScheduleAsNeeded {
+		last, err := h.Queries.GetLastDoseTime(ctx, regimen.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Unix(last, 0)
+		if prescription.ScheduledStart.Valid {
+			start = time.Unix(prescription.ScheduledStart.Int64, 0)
+		}
+
+		// The first dose after the last one that was scheduled
+		next, err := planDoses(schedule, loc, start, time.Unix(last+1, 0), 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(next) > 0 {
+			forecast.RunsOut = &next[0].Time
+		}
+	}
+
+	inv, err := inventory(ctx, h.Queries, prescription, regimen)
+	if err != nil {
+		return nil, err
+	}
+
+	if inv.RunsOut != nil && (forecast.RunsOut == nil || inv.RunsOut.Before(*forecast.RunsOut)) {
+		forecast.RunsOut = inv.RunsOut
+	}
+
+	if forecast.RunsOut != nil {
+		requestBy := forecast.RunsOut.In(loc).AddDate(0, 0, -lead)
+		forecast.RequestBy = &requestBy
+	}
+
+	return forecast, nil
+}
@@ -0,0 +1,345 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+	"github.com/kzs0/pill_manager/pkg/notify"
+)
+
+// ReminderScheduler periodically looks for doses coming due and reminds
+// their patients through each of the patient's notification targets. A
+// dose that is still pending Renotify after a reminder is reminded about
+// again, up to MaxReminders times, until it is logged or missed.
+//
+// Patients' preferences pick the channels and lead time, and reminders that
+// fall in their quiet hours are held until the quiet hours end unless the
+// prescription is critical. Reminders for dependents, who don't log in,
+// go to the caregiver that owns them.
+//
+// Patients are also alerted, once, when a prescription's inventory falls to
+// its low supply threshold. The alert is sent again after the inventory is
+// back above the threshold and falls to it again.
+type ReminderScheduler struct {
+	Handler *Handler
+	// Channels without a notifier are skipped
+	Notifiers map[models.Channel]notify.Notifier
+	Interval  time.Duration
+	// How long before a dose is due the first reminder goes out, for
+	// patients that haven't chosen
+	Lead time.Duration
+	// If 0, each dose is only reminded about once
+	Renotify     time.Duration
+	MaxReminders int
+	// Reminders that should have gone out longer ago than this, e.g.
+	// because the server was down, are dropped
+	MaxOverdue time.Duration
+}
+
+// Run sends reminders every Interval until ctx is done.
+func (s *ReminderScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		sent, err := s.Send(ctx, time.Now())
+		if err != nil {
+			slog.Error("failed to send reminders", "err", err)
+		} else if sent > 0 {
+			slog.Info("sent reminders", "count", sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Send reminds patients of the doses that need a reminder as of now, alerts
+// them of prescriptions running low, and returns how many reminders and
+// alerts went out.
+func (s *ReminderScheduler) Send(ctx context.Context, now time.Time) (_ int, err error) {
+	ctx, done := koko.Operation(ctx, "send_reminders")
+	defer done(&ctx, &err)
+
+	maxCount := max(s.MaxReminders, 1)
+	if s.Renotify <= 0 {
+		maxCount = 1
+	}
+
+	// Wide enough for any patient's lead time and for reminders held
+	// through a day of quiet hours. Rows are narrowed down below.
+	params := sqlc.GetDueRemindersParams{
+		Since:          sql.NullInt64{Int64: now.Add(-s.MaxOverdue - 24*time.Hour).Unix(), Valid: true},
+		Until:          sql.NullInt64{Int64: now.Add(max(s.Lead, maxLeadTime)).Unix(), Valid: true},
+		RenotifyBefore: now.Add(-s.Renotify).Unix(),
+		MaxCount:       int64(maxCount),
+	}
+	rows, err := s.Handler.Queries.GetDueReminders(ctx, params)
+	if err != nil {
+		return 0, err
+	}
+
+	patients := make(map[string]*reminderPatient)
+
+	sent := 0
+	for _, row := range rows {
+		patient, ok := patients[row.Patient]
+		if !ok {
+			patient, err = s.loadPatient(ctx, row.Patient)
+			if err != nil {
+				return sent, err
+			}
+			patients[row.Patient] = patient
+		}
+
+		if !s.shouldRemind(row, patient, now) {
+			continue
+		}
+
+		msg := reminderMessage(row, patient.loc, now)
+
+		delivered := false
+		for _, target := range patient.targets {
+			if s.deliver(ctx, target, msg) {
+				delivered = true
+			}
+		}
+
+		if !delivered {
+			continue
+		}
+
+		params := sqlc.RecordReminderParams{
+			DoseID: row.ID,
+			SentAt: now.Unix(),
+		}
+		err = s.Handler.Queries.RecordReminder(ctx, params)
+		if err != nil {
+			return sent, err
+		}
+
+		sent++
+	}
+
+	alerted, err := s.alertLowSupply(ctx, patients, now)
+	sent += alerted
+	if err != nil {
+		return sent, err
+	}
+
+	return sent, nil
+}
+
+// alertLowSupply alerts patients of their prescriptions that are at or
+// below their low supply threshold. Alerts are held through quiet hours.
+func (s *ReminderScheduler) alertLowSupply(ctx context.Context, patients map[string]*reminderPatient, now time.Time) (int, error) {
+	rows, err := s.Handler.Queries.GetLowSupplyAlerts(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, row := range rows {
+		patient, ok := patients[row.Patient]
+		if !ok {
+			patient, err = s.loadPatient(ctx, row.Patient)
+			if err != nil {
+				return sent, err
+			}
+			patients[row.Patient] = patient
+		}
+
+		if _, held := quietUntil(patient.prefs.QuietHours, now, patient.loc); held {
+			continue
+		}
+
+		msg := notify.Message{
+			Kind:           notify.KindLowSupply,
+			Subject:        fmt.Sprintf("Running low on %s", row.Name),
+			Body:           fmt.Sprintf("%g of %s left, time to refill.", row.OnHand, row.Name),
+			PrescriptionID: row.ID,
+			Medication:     row.Name,
+			Time:           now,
+			Amount:         row.OnHand,
+		}
+
+		delivered := false
+		for _, target := range patient.targets {
+			if s.deliver(ctx, target, msg) {
+				delivered = true
+			}
+		}
+
+		if !delivered {
+			continue
+		}
+
+		params := sqlc.SetLowSupplyAlertedParams{
+			LowSupplyAlertedAt: sql.NullInt64{Int64: now.Unix(), Valid: true},
+			ID:                 row.ID,
+		}
+		err = s.Handler.Queries.SetLowSupplyAlerted(ctx, params)
+		if err != nil {
+			return sent, err
+		}
+
+		sent++
+	}
+
+	return sent, nil
+}
+
+// shouldRemind decides whether the dose in row needs a reminder now. Rows
+// that need a repeat reminder were already narrowed down by the query.
+func (s *ReminderScheduler) shouldRemind(row sqlc.GetDueRemindersRow, patient *reminderPatient, now time.Time) bool {
+	quiet := patient.prefs.QuietHours
+	if row.Critical {
+		quiet = nil
+	}
+
+	if _, held := quietUntil(quiet, now, patient.loc); held {
+		return false
+	}
+
+	if row.SentAt.Valid {
+		return true
+	}
+
+	lead := s.Lead
+	if patient.prefs.LeadTime != nil {
+		lead = patient.prefs.LeadTime.Duration
+	}
+
+	remindAt := time.Unix(row.Time, 0).Add(-lead)
+	if row.SnoozedUntil.Valid {
+		// The patient already chose when to hear about it again
+		remindAt = time.Unix(row.SnoozedUntil.Int64, 0)
+	}
+	if end, held := quietUntil(quiet, remindAt, patient.loc); held {
+		remindAt = end
+	}
+
+	return !now.Before(remindAt) && now.Sub(remindAt) <= s.MaxOverdue
+}
+
+type reminderPatient struct {
+	loc     *time.Location
+	prefs   *models.Preferences
+	targets []sqlc.NotificationTarget
+}
+
+// loadPatient loads who a patient's reminders go to and how: the patient
+// if they log in, or otherwise the caregiver that owns them.
+func (s *ReminderScheduler) loadPatient(ctx context.Context, id string) (*reminderPatient, error) {
+	patient, err := s.Handler.Queries.GetPatient(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	uid := patient.Owner
+	if patient.UserID.Valid {
+		uid = patient.UserID.String
+	}
+
+	loc, err := scheduleLocation(models.Schedule{}, patient.TimeZone, time.UTC)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	prefs := &models.Preferences{}
+	row, err := s.Handler.Queries.GetUserPreferences(ctx, uid)
+	if err == nil {
+		prefs = toPreferences(row)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	targets, err := s.Handler.Queries.GetNotificationTargets(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(prefs.Channels) > 0 {
+		wanted := make([]sqlc.NotificationTarget, 0, len(targets))
+		for _, target := range targets {
+			if slices.Contains(prefs.Channels, models.Channel(target.Channel)) {
+				wanted = append(wanted, target)
+			}
+		}
+		targets = wanted
+	}
+
+	return &reminderPatient{loc: loc, prefs: prefs, targets: targets}, nil
+}
+
+// deliver sends msg to target and reports whether it got there. Targets
+// that are gone for good are removed.
+func (s *ReminderScheduler) deliver(ctx context.Context, target sqlc.NotificationTarget, msg notify.Message) bool {
+	notifier, ok := s.Notifiers[models.Channel(target.Channel)]
+	if !ok {
+		return false
+	}
+
+	err := notifier.Notify(ctx, target.Address, msg)
+	if errors.Is(err, notify.ErrGone) {
+		slog.Info("removing notification target that is gone", "target", target.ID, "channel", target.Channel)
+
+		params := sqlc.DeleteNotificationTargetParams{
+			ID:     target.ID,
+			UserID: target.UserID,
+		}
+		_, err = s.Handler.Queries.DeleteNotificationTarget(ctx, params)
+		if err != nil {
+			slog.Error("failed to remove notification target", "target", target.ID, "err", err)
+		}
+		return false
+	}
+	if err != nil {
+		slog.Warn("failed to deliver reminder", "target", target.ID, "channel", target.Channel, "err", err)
+		return false
+	}
+
+	return true
+}
+
+func reminderMessage(row sqlc.GetDueRemindersRow, loc *time.Location, now time.Time) notify.Message {
+	due := time.Unix(row.Time, 0).In(loc)
+	if row.SnoozedUntil.Valid {
+		due = time.Unix(row.SnoozedUntil.Int64, 0).In(loc)
+	}
+	attempt := int(row.Count.Int64) + 1
+
+	subject := fmt.Sprintf("Time to take %s", row.Name)
+	if attempt > 1 {
+		subject = fmt.Sprintf("Reminder: %s hasn't been logged", row.Name)
+	}
+
+	verb := "is"
+	if due.Before(now) {
+		verb = "was"
+	}
+
+	return notify.Message{
+		Kind:           notify.KindDose,
+		Subject:        subject,
+		Body:           fmt.Sprintf("%g %s of %s %s due at %s.", row.Amount, row.Unit, row.Name, verb, due.Format("3:04 PM MST")),
+		PrescriptionID: row.PrescriptionID,
+		DoseID:         row.ID,
+		Medication:     row.Name,
+		Time:           due,
+		Amount:         row.Amount,
+		Unit:           row.Unit,
+		Attempt:        attempt,
+	}
+}
@@ -0,0 +1,234 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+	"github.com/kzs0/pill_manager/pkg/notify"
+	"github.com/kzs0/pill_manager/pkg/notify/notifytest"
+)
+
+func TestSendReminders(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t)
+
+	alice := newTestUser(t, h, "alice")
+
+	var mu sync.Mutex
+	var hooks []notify.Message
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		var msg notify.Message
+		err := json.Unmarshal(body, &msg)
+		if err != nil {
+			t.Errorf("webhook got %q: %v", body, err)
+		}
+
+		mu.Lock()
+		hooks = append(hooks, msg)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	received := func() []notify.Message {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]notify.Message(nil), hooks...)
+	}
+
+	smtp := notifytest.NewSMTPServer(t)
+
+	// Inserted directly, since loopback addresses aren't accepted from users
+	targets := map[models.Channel]string{
+		models.ChannelWebhook: webhook.URL,
+		models.ChannelEmail:   "alice@example.com",
+	}
+	for channel, address := range targets {
+		params := sqlc.CreateNotificationTargetParams{
+			ID:        string(channel),
+			UserID:    alice.User,
+			Channel:   string(channel),
+			Address:   address,
+			CreatedAt: time.Now().Unix(),
+		}
+		_, err := h.Queries.CreateNotificationTarget(ctx, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now().Truncate(time.Second)
+	rx, doses := newTestRx(t, h, alice, now.Add(-time.Minute))
+
+	s := &ReminderScheduler{
+		Handler: h,
+		Notifiers: map[models.Channel]notify.Notifier{
+			models.ChannelWebhook: &notify.Webhook{Client: webhook.Client()},
+			models.ChannelEmail:   &notify.SMTP{Addr: smtp.Addr, From: "reminders@localhost"},
+		},
+		Renotify:     15 * time.Minute,
+		MaxReminders: 2,
+		MaxOverdue:   time.Hour,
+	}
+
+	sent, err := s.Send(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 1 {
+		t.Fatalf("sent %d reminders, want 1", sent)
+	}
+
+	msgs := received()
+	if len(msgs) != 1 {
+		t.Fatalf("webhook got %d messages, want 1", len(msgs))
+	}
+	got := msgs[0]
+	if got.Kind != notify.KindDose || got.DoseID != doses[0].ID || got.PrescriptionID != rx.ID {
+		t.Errorf("got %+v, want a reminder for dose %s", got, doses[0].ID)
+	}
+	if got.Medication != "Ibuprofen" || got.Amount != 1 || got.Unit != "tablet" || got.Attempt != 1 {
+		t.Errorf("got %+v", got)
+	}
+	if !got.Time.Equal(doses[0].Time) {
+		t.Errorf("got time %s, want %s", got.Time, doses[0].Time)
+	}
+
+	mail := smtp.Mail()
+	if len(mail) != 1 {
+		t.Fatalf("smtp got %d messages, want 1", len(mail))
+	}
+	if mail[0].To[0] != "alice@example.com" || !strings.Contains(mail[0].Data, "Subject: Time to take Ibuprofen") {
+		t.Errorf("got %+v", mail[0])
+	}
+
+	// Until Renotify passes, the reminder recorded for the dose keeps it
+	// from being sent again
+	for _, at := range []time.Time{now, now.Add(time.Minute), now.Add(14 * time.Minute)} {
+		sent, err = s.Send(ctx, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sent != 0 {
+			t.Errorf("at %s sent %d reminders again", at.Sub(now), sent)
+		}
+	}
+
+	reminder := func() (sentAt, count int64) {
+		t.Helper()
+
+		row := h.DB.QueryRowContext(ctx, `SELECT sent_at, count FROM reminders WHERE dose_id = ?`, doses[0].ID)
+		err := row.Scan(&sentAt, &count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sentAt, count
+	}
+
+	sentAt, count := reminder()
+	if sentAt != now.Unix() || count != 1 {
+		t.Errorf("got reminder sent at %d, %d times", sentAt, count)
+	}
+
+	// Once it has, one more goes out, and then no more than MaxReminders
+	later := now.Add(16 * time.Minute)
+	sent, err = s.Send(ctx, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 1 {
+		t.Fatalf("sent %d repeat reminders, want 1", sent)
+	}
+	msgs = received()
+	if len(msgs) != 2 || msgs[1].Attempt != 2 || msgs[1].DoseID != doses[0].ID {
+		t.Errorf("got %+v, want a second reminder", msgs)
+	}
+
+	sent, err = s.Send(ctx, later.Add(16*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 0 {
+		t.Errorf("sent %d reminders past MaxReminders", sent)
+	}
+
+	sentAt, count = reminder()
+	if sentAt != later.Unix() || count != 2 {
+		t.Errorf("got reminder sent at %d, %d times", sentAt, count)
+	}
+
+	if len(smtp.Mail()) != 2 {
+		t.Errorf("smtp got %d messages, want 2", len(smtp.Mail()))
+	}
+}
+
+func TestRemindersRemovedWithDoses(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t)
+
+	alice := newTestUser(t, h, "alice")
+
+	now := time.Now().Truncate(time.Second)
+	rx, doses := newTestRx(t, h, alice, now.Add(-time.Minute))
+
+	remind := func() {
+		t.Helper()
+
+		params := sqlc.RecordReminderParams{
+			DoseID: doses[0].ID,
+			SentAt: now.Unix(),
+		}
+		err := h.Queries.RecordReminder(ctx, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reminders := func() int {
+		t.Helper()
+
+		var count int
+		err := h.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM reminders`).Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	// Patching rebuilds the pending doses, so their reminders go with them
+	remind()
+	doses2 := 20
+	_, err := h.UpdatePerscription(ctx, rx.ID, alice, &models.PrescriptionPatch{Doses: &doses2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := reminders(); n != 0 {
+		t.Errorf("patch left %d reminders", n)
+	}
+
+	regimens, err := h.GetScheduledDoses(ctx, alice, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doses = regimens[0].Doses
+
+	remind()
+	err = h.DeletePerscription(ctx, rx.ID, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := reminders(); n != 0 {
+		t.Errorf("delete left %d reminders", n)
+	}
+}
@@ -0,0 +1,298 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kzs0/pill_manager/models"
+	"github.com/kzs0/pill_manager/pkg/cron"
+)
+
+// maxDoses is the most doses a fill can have. Counts come from clients and
+// schedules are walked a dose at a time, so this bounds the work.
+const maxDoses = 5000
+
+// minPeriod is the shortest period a schedule can repeat at.
+const minPeriod = time.Minute
+
+type plannedDose struct {
+	Time   time.Time
+	Amount float64
+	Unit   string
+	Phase  int
+}
+
+// planDoses walks the schedule from start and returns the first count doses
+// that fall at or after from. Fewer are returned only if the schedule stops
+// producing times, e.g. a taper's last phase ends or a cron expression only
+// matches Feb 30th.
+//
+// Days and times of day are wall clock times in loc, so a dose due at 08:00
+// stays at 08:00 across daylight saving changes.
+func planDoses(sch models.Schedule, loc *time.Location, start, from time.Time, count int) ([]plannedDose, error) {
+	planned := make([]plannedDose, 0)
+	if count <= 0 {
+		return planned, nil
+	}
+
+	err := walkDoses(sch, loc, start, time.Time{}, func(dose plannedDose) bool {
+		if !dose.Time.Before(from) {
+			planned = append(planned, dose)
+		}
+		return len(planned) < count
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return planned, nil
+}
+
+// countDoses returns the number of doses in a tapered schedule, which can't
+// be more than maxDoses.
+func countDoses(sch models.Schedule, loc *time.Location, start time.Time) (int, error) {
+	if sch.Kind != models.ScheduleTapered {
+		return 0, fmt.Errorf("%w: only tapered schedules have a fixed number of doses", ErrInvalid)
+	}
+
+	count := 0
+	err := walkDoses(sch, loc, start, time.Time{}, func(plannedDose) bool {
+		count++
+		return count <= maxDoses
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if count > maxDoses {
+		return 0, fmt.Errorf("%w: taper has more than %d doses", ErrInvalid, maxDoses)
+	}
+
+	return count, nil
+}
+
+// walkDoses calls yield with each dose of the schedule from start until
+// yield returns false, the schedule runs out, or end if it isn't zero.
+func walkDoses(sch models.Schedule, loc *time.Location, start, end time.Time, yield func(plannedDose) bool) error {
+	if sch.Kind == models.ScheduleTapered {
+		return walkPhases(sch, loc, start, yield)
+	}
+
+	if len(sch.Doses) == 0 {
+		return fmt.Errorf("%w: schedule has no doses", ErrInvalid)
+	}
+
+	start = start.In(loc)
+
+	next, err := scheduleAnchors(sch, start)
+	if err != nil {
+		return err
+	}
+
+	// Offsets into a period measured in days are times of day. Shorter
+	// periods, like every 8 hours, are about elapsed time instead.
+	wallClock := sch.Kind == models.ScheduleWeekly || sch.Kind == models.ScheduleMonthly ||
+		isPeriodic(sch) && wholeDays(sch.Period.Duration) > 0
+
+	for {
+		anchor, ok := next()
+		if !ok || !end.IsZero() && !anchor.Before(end) {
+			return nil
+		}
+
+		for _, dose := range sch.Doses {
+			doseTime := anchor.Add(dose.DurationIntoPeriod.Duration)
+			if wallClock {
+				doseTime = addWallClock(anchor, dose.DurationIntoPeriod.Duration)
+			}
+
+			if doseTime.Before(start) || !end.IsZero() && !doseTime.Before(end) {
+				continue
+			}
+
+			planned := plannedDose{
+				Time:   doseTime,
+				Amount: dose.Amount,
+				Unit:   dose.Unit,
+			}
+			if !yield(planned) {
+				return nil
+			}
+		}
+	}
+}
+
+// walkPhases runs each phase's schedule for the phase's duration, one after
+// the other. Durations in whole days end at the same wall clock time.
+func walkPhases(sch models.Schedule, loc *time.Location, start time.Time, yield func(plannedDose) bool) error {
+	if len(sch.Phases) == 0 {
+		return fmt.Errorf("%w: tapered schedule has no phases", ErrInvalid)
+	}
+
+	phaseStart := start.In(loc)
+	for i, phase := range sch.Phases {
+		if phase.Duration.Duration <= 0 {
+			return fmt.Errorf("%w: phase %d: duration must be positive", ErrInvalid, i)
+		}
+
+		if phase.Schedule.Kind == models.ScheduleTapered || phase.Schedule.Kind == models.ScheduleAsNeeded {
+			return fmt.Errorf("%w: phase %d: %s schedules can't be a phase", ErrInvalid, i, phase.Schedule.Kind)
+		}
+
+		phaseEnd := phaseStart.Add(phase.Duration.Duration)
+		if days := wholeDays(phase.Duration.Duration); days > 0 {
+			phaseEnd = phaseStart.AddDate(0, 0, days)
+		}
+
+		stopped := false
+		err := walkDoses(phase.Schedule, loc, phaseStart, phaseEnd, func(dose plannedDose) bool {
+			dose.Phase = i
+			stopped = !yield(dose)
+			return !stopped
+		})
+		if err != nil {
+			return fmt.Errorf("phase %d: %w", i, err)
+		}
+
+		if stopped {
+			return nil
+		}
+
+		phaseStart = phaseEnd
+	}
+
+	return nil
+}
+
+// scheduleAnchors returns an iterator over the times each round of the
+// schedule's doses are offset from, beginning with the first one on or
+// after the day of start.
+func scheduleAnchors(sch models.Schedule, start time.Time) (func() (time.Time, bool), error) {
+	switch sch.Kind {
+	case "", models.SchedulePeriodic:
+		if sch.Period.Duration < minPeriod {
+			return nil, fmt.Errorf("%w: schedule period must be at least %s", ErrInvalid, minPeriod)
+		}
+
+		days := wholeDays(sch.Period.Duration)
+
+		t := start
+		return func() (time.Time, bool) {
+			anchor := t
+			if days > 0 {
+				t = t.AddDate(0, 0, days)
+			} else {
+				t = t.Add(sch.Period.Duration)
+			}
+			return anchor, true
+		}, nil
+	case models.ScheduleWeekly:
+		if len(sch.Weekdays) == 0 {
+			return nil, fmt.Errorf("%w: weekly schedule has no weekdays", ErrInvalid)
+		}
+
+		var days [7]bool
+		for _, wd := range sch.Weekdays {
+			days[wd.Weekday] = true
+		}
+
+		return dailyAnchors(start, func(day time.Time) bool {
+			return days[day.Weekday()]
+		}), nil
+	case models.ScheduleMonthly:
+		if len(sch.DaysOfMonth) == 0 {
+			return nil, fmt.Errorf("%w: monthly schedule has no days", ErrInvalid)
+		}
+
+		for _, dom := range sch.DaysOfMonth {
+			if dom == 0 || dom > 31 || dom < -31 {
+				return nil, fmt.Errorf("%w: invalid day of month %d", ErrInvalid, dom)
+			}
+		}
+
+		return dailyAnchors(start, func(day time.Time) bool {
+			last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+			for _, dom := range sch.DaysOfMonth {
+				if dom == day.Day() || dom < 0 && last+1+dom == day.Day() {
+					return true
+				}
+			}
+			return false
+		}), nil
+	case models.ScheduleCron:
+		expr, err := cron.Parse(sch.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+
+		t := start.Add(-time.Nanosecond)
+		return func() (time.Time, bool) {
+			t = expr.Next(t)
+			return t, !t.IsZero()
+		}, nil
+	case models.ScheduleAsNeeded:
+		return nil, fmt.Errorf("%w: as needed schedules have no scheduled doses", ErrInvalid)
+	case models.ScheduleTapered:
+		return nil, fmt.Errorf("%w: tapered schedules are walked phase by phase", ErrInvalid)
+	default:
+		return nil, fmt.Errorf("%w: unknown schedule kind %q", ErrInvalid, sch.Kind)
+	}
+}
+
+// dailyAnchors yields midnight of every day from start's day onward that
+// match accepts.
+func dailyAnchors(start time.Time, match func(day time.Time) bool) func() (time.Time, bool) {
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	return func() (time.Time, bool) {
+		for !match(day) {
+			day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location())
+		}
+
+		anchor := day
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location())
+		return anchor, true
+	}
+}
+
+// scheduleLocation returns the zone a schedule's wall clock times are in:
+// the schedule's own zone, then the patient's home zone, then fallback.
+func scheduleLocation(sch models.Schedule, home string, fallback *time.Location) (*time.Location, error) {
+	name := sch.TimeZone
+	if name == "" {
+		name = home
+	}
+
+	if name == "" {
+		return fallback, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalid, name)
+	}
+
+	return loc, nil
+}
+
+func isPeriodic(sch models.Schedule) bool {
+	return sch.Kind == "" || sch.Kind == models.SchedulePeriodic
+}
+
+// wholeDays returns d in days, or 0 if d isn't a whole number of days.
+func wholeDays(d time.Duration) int {
+	if d <= 0 || d%(24*time.Hour) != 0 {
+		return 0
+	}
+
+	return int(d / (24 * time.Hour))
+}
+
+// addWallClock moves t forward by d as read on a clock on the wall in t's
+// location, rather than by elapsed time. See cron.WallClock for times DST
+// skips or repeats.
+func addWallClock(t time.Time, d time.Duration) time.Time {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(),
+		t.Second()+int(d/time.Second), t.Nanosecond()+int(d%time.Second), time.UTC)
+
+	return cron.WallClock(wall, t.Location())
+}
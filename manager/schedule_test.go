@@ -0,0 +1,336 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kzs0/pill_manager/models"
+)
+
+func hours(h float64) models.Duration {
+	return models.Duration{Duration: time.Duration(h * float64(time.Hour))}
+}
+
+// tablets returns a dose of n tablets at each offset into the period.
+func tablets(n float64, offsets ...float64) []models.ScheduledDose {
+	doses := make([]models.ScheduledDose, 0, len(offsets))
+	for _, offset := range offsets {
+		doses = append(doses, models.ScheduledDose{DurationIntoPeriod: hours(offset), Amount: n, Unit: "tablet"})
+	}
+
+	return doses
+}
+
+func TestPlanDoses(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, ny)
+	}
+	// Go doesn't say which of a repeated time time.Date picks
+	est := time.FixedZone("EST", -5*60*60)
+	edt := time.FixedZone("EDT", -4*60*60)
+
+	tests := []struct {
+		name  string
+		sch   models.Schedule
+		start time.Time
+		from  time.Time // If zero, start
+		want  []time.Time
+	}{
+		{
+			name:  "daily doses keep their time of day across DST",
+			sch:   models.Schedule{Period: hours(24), Doses: tablets(1, 8)},
+			start: at(2024, 3, 9, 0, 0),
+			want:  []time.Time{at(2024, 3, 9, 8, 0), at(2024, 3, 10, 8, 0), at(2024, 3, 11, 8, 0)},
+		},
+		{
+			name:  "skipped time of day is as far past the jump",
+			sch:   models.Schedule{Period: hours(24), Doses: tablets(1, 2.5)},
+			start: at(2024, 3, 9, 0, 0),
+			want:  []time.Time{at(2024, 3, 9, 2, 30), time.Date(2024, 3, 10, 3, 30, 0, 0, edt), at(2024, 3, 11, 2, 30)},
+		},
+		{
+			name:  "repeated time of day is taken once",
+			sch:   models.Schedule{Period: hours(24), Doses: tablets(1, 1.5)},
+			start: at(2024, 11, 2, 0, 0),
+			want:  []time.Time{at(2024, 11, 2, 1, 30), time.Date(2024, 11, 3, 1, 30, 0, 0, edt), time.Date(2024, 11, 4, 1, 30, 0, 0, est)},
+		},
+		{
+			name:  "hourly periods are elapsed time across DST",
+			sch:   models.Schedule{Period: hours(8), Doses: tablets(1, 0)},
+			start: time.Date(2024, 11, 2, 22, 0, 0, 0, edt),
+			want:  []time.Time{at(2024, 11, 2, 22, 0), time.Date(2024, 11, 3, 6, 0, 0, 0, edt), time.Date(2024, 11, 3, 14, 0, 0, 0, edt)},
+		},
+		{
+			name:  "several doses a period, in order",
+			sch:   models.Schedule{Period: hours(24), Doses: tablets(1, 8, 20)},
+			start: at(2024, 5, 1, 12, 0),
+			want:  []time.Time{at(2024, 5, 1, 20, 0), at(2024, 5, 2, 8, 0), at(2024, 5, 2, 20, 0)},
+		},
+		{
+			name:  "doses before from are skipped",
+			sch:   models.Schedule{Period: hours(24), Doses: tablets(1, 8)},
+			start: at(2024, 5, 1, 0, 0),
+			from:  at(2024, 5, 3, 8, 0),
+			want:  []time.Time{at(2024, 5, 3, 8, 0), at(2024, 5, 4, 8, 0)},
+		},
+		{
+			name: "weekly",
+			sch: models.Schedule{
+				Kind:     models.ScheduleWeekly,
+				Weekdays: []models.Weekday{{Weekday: time.Monday}, {Weekday: time.Thursday}},
+				Doses:    tablets(1, 9),
+			},
+			// A Wednesday
+			start: at(2024, 5, 1, 12, 0),
+			want:  []time.Time{at(2024, 5, 2, 9, 0), at(2024, 5, 6, 9, 0), at(2024, 5, 9, 9, 0)},
+		},
+		{
+			name: "weekly starts later on the first day",
+			sch: models.Schedule{
+				Kind:     models.ScheduleWeekly,
+				Weekdays: []models.Weekday{{Weekday: time.Wednesday}},
+				Doses:    tablets(1, 9),
+			},
+			start: at(2024, 5, 1, 8, 0),
+			want:  []time.Time{at(2024, 5, 1, 9, 0), at(2024, 5, 8, 9, 0)},
+		},
+		{
+			name: "last day of the month",
+			sch: models.Schedule{
+				Kind:        models.ScheduleMonthly,
+				DaysOfMonth: []int{-1},
+				Doses:       tablets(1, 8),
+			},
+			start: at(2024, 1, 15, 0, 0),
+			want:  []time.Time{at(2024, 1, 31, 8, 0), at(2024, 2, 29, 8, 0), at(2024, 3, 31, 8, 0), at(2024, 4, 30, 8, 0)},
+		},
+		{
+			name: "days a month doesn't have are skipped",
+			sch: models.Schedule{
+				Kind:        models.ScheduleMonthly,
+				DaysOfMonth: []int{1, 31},
+				Doses:       tablets(1, 8),
+			},
+			start: at(2024, 3, 15, 0, 0),
+			want:  []time.Time{at(2024, 3, 31, 8, 0), at(2024, 4, 1, 8, 0), at(2024, 5, 1, 8, 0), at(2024, 5, 31, 8, 0)},
+		},
+		{
+			name: "cron in the schedule's zone",
+			sch: models.Schedule{
+				Kind:  models.ScheduleCron,
+				Cron:  "0 8 * * MON-FRI",
+				Doses: tablets(1, 0),
+			},
+			// A Friday
+			start: at(2024, 5, 3, 8, 0),
+			want:  []time.Time{at(2024, 5, 3, 8, 0), at(2024, 5, 6, 8, 0)},
+		},
+		{
+			name: "cron doses are offset from each time it fires",
+			sch: models.Schedule{
+				Kind:  models.ScheduleCron,
+				Cron:  "0 8 1 * *",
+				Doses: tablets(1, 0, 12),
+			},
+			start: at(2024, 5, 2, 0, 0),
+			want:  []time.Time{at(2024, 6, 1, 8, 0), at(2024, 6, 1, 20, 0), at(2024, 7, 1, 8, 0)},
+		},
+		{
+			name: "cron that never fires",
+			sch: models.Schedule{
+				Kind:  models.ScheduleCron,
+				Cron:  "0 0 30 2 *",
+				Doses: tablets(1, 0),
+			},
+			start: at(2024, 5, 1, 0, 0),
+			want:  []time.Time{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := tt.from
+			if from.IsZero() {
+				from = tt.start
+			}
+
+			count := len(tt.want)
+			if count == 0 {
+				count = 1
+			}
+
+			planned, err := planDoses(tt.sch, ny, tt.start, from, count)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(planned) != len(tt.want) {
+				t.Fatalf("got %d doses, want %d: %v", len(planned), len(tt.want), planned)
+			}
+			for i, dose := range planned {
+				if !dose.Time.Equal(tt.want[i]) {
+					t.Errorf("dose %d at %s, want %s", i, dose.Time, tt.want[i].In(ny))
+				}
+				if dose.Time.Location() != ny {
+					t.Errorf("dose %d in %s, want %s", i, dose.Time.Location(), ny)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanTaper(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two tablets twice a day for 3 days, then one a day for 2, over the
+	// start of DST on 2024-03-10
+	sch := models.Schedule{
+		Kind: models.ScheduleTapered,
+		Phases: []models.Phase{
+			{
+				Schedule: models.Schedule{Period: hours(24), Doses: tablets(2, 8, 20)},
+				Duration: hours(3 * 24),
+			},
+			{
+				Schedule: models.Schedule{Period: hours(24), Doses: tablets(1, 8)},
+				Duration: hours(2 * 24),
+			},
+		},
+	}
+	start := time.Date(2024, 3, 8, 0, 0, 0, 0, ny)
+
+	count, err := countDoses(sch, ny, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 8 {
+		t.Errorf("got %d doses, want 8", count)
+	}
+
+	planned, err := planDoses(sch, ny, start, start, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type want struct {
+		day, hour int
+		amount    float64
+		phase     int
+	}
+	wants := []want{
+		{8, 8, 2, 0}, {8, 20, 2, 0},
+		{9, 8, 2, 0}, {9, 20, 2, 0},
+		{10, 8, 2, 0}, {10, 20, 2, 0},
+		// Whole days end at midnight on the wall clock, after the jump
+		{11, 8, 1, 1},
+		{12, 8, 1, 1},
+	}
+	if len(planned) != len(wants) {
+		t.Fatalf("got %d doses, want %d: %v", len(planned), len(wants), planned)
+	}
+	for i, w := range wants {
+		got := planned[i]
+		wantTime := time.Date(2024, 3, w.day, w.hour, 0, 0, 0, ny)
+		if !got.Time.Equal(wantTime) || got.Amount != w.amount || got.Phase != w.phase {
+			t.Errorf("dose %d got %s %v tablets in phase %d, want %s %v in phase %d",
+				i, got.Time, got.Amount, got.Phase, wantTime, w.amount, w.phase)
+		}
+	}
+
+	// Planning from partway through picks up in the right phase
+	from := time.Date(2024, 3, 10, 12, 0, 0, 0, ny)
+	planned, err = planDoses(sch, ny, start, from, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(planned) != 2 || planned[0].Phase != 0 || planned[1].Phase != 1 {
+		t.Errorf("got %v, want the last dose of phase 0 and the first of phase 1", planned)
+	}
+}
+
+func TestPlanTaperHourlyPhases(t *testing.T) {
+	// Phases that aren't whole days are elapsed time, and a dose on the
+	// boundary belongs to the next phase
+	sch := models.Schedule{
+		Kind: models.ScheduleTapered,
+		Phases: []models.Phase{
+			{Schedule: models.Schedule{Period: hours(6), Doses: tablets(2, 0)}, Duration: hours(12)},
+			{Schedule: models.Schedule{Period: hours(6), Doses: tablets(1, 0)}, Duration: hours(12)},
+		},
+	}
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	planned, err := planDoses(sch, time.UTC, start, start, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantAmounts := []float64{2, 2, 1, 1}
+	if len(planned) != len(wantAmounts) {
+		t.Fatalf("got %d doses, want %d: %v", len(planned), len(wantAmounts), planned)
+	}
+	for i, amount := range wantAmounts {
+		wantTime := start.Add(time.Duration(i) * 6 * time.Hour)
+		if !planned[i].Time.Equal(wantTime) || planned[i].Amount != amount {
+			t.Errorf("dose %d got %s %v, want %s %v", i, planned[i].Time, planned[i].Amount, wantTime, amount)
+		}
+	}
+}
+
+func TestPlanDosesInvalid(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]models.Schedule{
+		"no doses":              {Period: hours(24)},
+		"no period":             {Doses: tablets(1, 0)},
+		"negative period":       {Period: hours(-1), Doses: tablets(1, 0)},
+		"period under a minute": {Period: models.Duration{Duration: time.Nanosecond}, Doses: tablets(1, 0)},
+		"no weekdays":           {Kind: models.ScheduleWeekly, Doses: tablets(1, 8)},
+		"no days of month":      {Kind: models.ScheduleMonthly, Doses: tablets(1, 8)},
+		"day of month 0":        {Kind: models.ScheduleMonthly, DaysOfMonth: []int{0}, Doses: tablets(1, 8)},
+		"day of month 32":       {Kind: models.ScheduleMonthly, DaysOfMonth: []int{32}, Doses: tablets(1, 8)},
+		"bad cron":              {Kind: models.ScheduleCron, Cron: "0 8 * *", Doses: tablets(1, 0)},
+		"as needed":             {Kind: models.ScheduleAsNeeded, Doses: tablets(1, 0)},
+		"unknown kind":          {Kind: "hourly", Doses: tablets(1, 0)},
+		"taper, no phases":      {Kind: models.ScheduleTapered},
+		"taper, zero phase":     {Kind: models.ScheduleTapered, Phases: []models.Phase{{Schedule: models.Schedule{Period: hours(24), Doses: tablets(1, 8)}}}},
+		"taper in a taper": {Kind: models.ScheduleTapered, Phases: []models.Phase{
+			{Schedule: models.Schedule{Kind: models.ScheduleTapered}, Duration: hours(24)},
+		}},
+		"as needed phase": {Kind: models.ScheduleTapered, Phases: []models.Phase{
+			{Schedule: models.Schedule{Kind: models.ScheduleAsNeeded}, Duration: hours(24)},
+		}},
+	}
+
+	for name, sch := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := planDoses(sch, time.UTC, start, start, 10)
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("got %v, want ErrInvalid", err)
+			}
+		})
+	}
+
+	_, err := countDoses(models.Schedule{Period: hours(24), Doses: tablets(1, 8)}, time.UTC, start)
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("counting an open ended schedule got %v, want ErrInvalid", err)
+	}
+
+	// A minute apart for ten years stops being walked at maxDoses
+	long := models.Schedule{Kind: models.ScheduleTapered, Phases: []models.Phase{
+		{Schedule: models.Schedule{Period: models.Duration{Duration: minPeriod}, Doses: tablets(1, 0)}, Duration: hours(10 * 365 * 24)},
+	}}
+	_, err = countDoses(long, time.UTC, start)
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("counting a taper with too many doses got %v, want ErrInvalid", err)
+	}
+}
@@ -0,0 +1,57 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+// MissedDoseSweeper periodically marks doses that went unlogged past their
+// prescription's grace window as missed, which takes them off the remaining
+// doses list. Doses of paused regimens and discontinued prescriptions are
+// left alone.
+type MissedDoseSweeper struct {
+	Handler  *Handler
+	Interval time.Duration
+	// Used for prescriptions that don't set their own MissedGrace
+	DefaultGrace time.Duration
+}
+
+// Run sweeps every Interval until ctx is done.
+func (s *MissedDoseSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		missed, err := s.Sweep(ctx, time.Now())
+		if err != nil {
+			slog.Error("failed to sweep missed doses", "err", err)
+		} else if missed > 0 {
+			slog.Info("marked doses missed", "count", missed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep marks the doses that are overdue as of now missed and returns how
+// many there were.
+func (s *MissedDoseSweeper) Sweep(ctx context.Context, now time.Time) (_ int64, err error) {
+	ctx, done := koko.Operation(ctx, "sweep_missed_doses")
+	defer done(&ctx, &err)
+
+	params := sqlc.MarkOverdueDosesMissedParams{
+		Now:          sql.NullInt64{Int64: now.Unix(), Valid: true},
+		DefaultGrace: sql.NullInt64{Int64: int64(s.DefaultGrace / time.Second), Valid: true},
+	}
+
+	return s.Handler.Queries.MarkOverdueDosesMissed(ctx, params)
+}
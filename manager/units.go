@@ -0,0 +1,190 @@
+package manager
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kzs0/pill_manager/models"
+)
+
+var forms = []models.DosageForm{
+	models.FormTablet,
+	models.FormCapsule,
+	models.FormLiquid,
+	models.FormInjection,
+	models.FormPatch,
+	models.FormInhaler,
+}
+
+var routes = []models.Route{
+	models.RouteOral,
+	models.RouteSublingual,
+	models.RouteTopical,
+	models.RouteTransdermal,
+	models.RouteInhaled,
+	models.RouteNasal,
+	models.RouteOphthalmic,
+	models.RouteOtic,
+	models.RouteRectal,
+	models.RouteVaginal,
+	models.RouteSubcutaneous,
+	models.RouteIntramuscular,
+	models.RouteIntravenous,
+}
+
+// Volumes in mL. Teaspoons and tablespoons are the 5 and 15 mL measures
+// used on prescription labels.
+var volumeUnits = map[string]float64{
+	"ml":         1,
+	"milliliter": 1,
+	"millilitre": 1,
+	"cc":         1,
+	"l":          1000,
+	"liter":      1000,
+	"litre":      1000,
+	"tsp":        5,
+	"teaspoon":   5,
+	"tbsp":       15,
+	"tablespoon": 15,
+	"fl oz":      29.5735,
+}
+
+var massUnits = []string{"mg", "mcg", "µg", "g", "gram", "milligram", "microgram"}
+
+// Units doses of each form can be counted in, besides volumes and masses
+var countUnits = map[models.DosageForm][]string{
+	models.FormTablet:    {"tablet", "tab", "pill"},
+	models.FormCapsule:   {"capsule", "cap", "pill"},
+	models.FormInjection: {"injection", "unit", "iu"},
+	models.FormPatch:     {"patch"},
+	models.FormInhaler:   {"puff", "inhalation", "actuation"},
+}
+
+// checkDoseUnits checks that every dose in sch is measured in a unit that
+// makes sense for form. Liquid volumes are converted to mL so every dose,
+// and the inventory, is in the same unit. Schedules of medications with no
+// form aren't checked.
+func checkDoseUnits(form models.DosageForm, sch *models.Schedule) error {
+	if form == "" {
+		return nil
+	}
+
+	for i := range sch.Doses {
+		err := checkDoseUnit(form, &sch.Doses[i].Amount, &sch.Doses[i].Unit)
+		if err != nil {
+			return err
+		}
+	}
+
+	if sch.AsNeeded != nil {
+		err := checkDoseUnit(form, &sch.AsNeeded.Amount, &sch.AsNeeded.Unit)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range sch.Phases {
+		err := checkDoseUnits(form, &sch.Phases[i].Schedule)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkDoseUnit(form models.DosageForm, amount *float64, unit *string) error {
+	u := normalizeKey(*unit)
+
+	if form == models.FormLiquid || form == models.FormInjection {
+		if ml, ok := lookupUnit(volumeUnits, u); ok {
+			*amount = math.Round(*amount*ml*1000) / 1000
+			*unit = "mL"
+			return nil
+		}
+	}
+
+	if form != models.FormPatch && form != models.FormInhaler && unitIn(massUnits, u) {
+		return nil
+	}
+
+	if unitIn(countUnits[form], u) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %q isn't a unit for a %s", ErrInvalid, *unit, form)
+}
+
+// lookupUnit finds u, or u without a plural ending, in units.
+func lookupUnit[V any](units map[string]V, u string) (V, bool) {
+	for _, candidate := range singulars(u) {
+		if v, ok := units[candidate]; ok {
+			return v, true
+		}
+	}
+
+	var zero V
+	return zero, false
+}
+
+func unitIn(units []string, u string) bool {
+	for _, candidate := range singulars(u) {
+		if slices.Contains(units, candidate) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func singulars(u string) []string {
+	return []string{u, strings.TrimSuffix(u, "s"), strings.TrimSuffix(u, "es")}
+}
+
+func validateMedicationKind(medication models.Medication) error {
+	if medication.Form != "" && !slices.Contains(forms, medication.Form) {
+		return fmt.Errorf("%w: unknown dosage form %q", ErrInvalid, medication.Form)
+	}
+
+	if medication.Route != "" && !slices.Contains(routes, medication.Route) {
+		return fmt.Errorf("%w: unknown route %q", ErrInvalid, medication.Route)
+	}
+
+	if s := medication.Strength; s != nil && (s.Value <= 0 || strings.TrimSpace(s.Unit) == "") {
+		return fmt.Errorf("%w: strength needs a positive value and a unit", ErrInvalid)
+	}
+
+	return nil
+}
+
+var strengthPattern = regexp.MustCompile(`^\s*(\d+(?:\.\d+)?)\s*(\S.*?)\s*$`)
+
+// ParseStrength parses a strength like "500 mg", "500mg" or "100 mg/5 mL".
+func ParseStrength(s string) (*models.Strength, error) {
+	match := strengthPattern.FindStringSubmatch(s)
+	if match == nil {
+		return nil, fmt.Errorf("%w: invalid strength %q", ErrInvalid, s)
+	}
+
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil || value <= 0 {
+		return nil, fmt.Errorf("%w: invalid strength %q", ErrInvalid, s)
+	}
+
+	return &models.Strength{
+		Value: value,
+		Unit:  strings.Join(strings.Fields(match[2]), " "),
+	}, nil
+}
+
+func formatStrength(strength *models.Strength) string {
+	if strength == nil {
+		return ""
+	}
+
+	return strconv.FormatFloat(strength.Value, 'f', -1, 64) + " " + strings.Join(strings.Fields(strength.Unit), " ")
+}
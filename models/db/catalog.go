@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// NormalizeKey is how catalog keys are built: lowercased, with runs of
+// whitespace collapsed to single spaces and trimmed.
+func NormalizeKey(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+type catalogRow struct {
+	id, name, brand, strength string
+}
+
+// rekeyMedications finishes 0015_catalog. SQLite's lower() only folds ASCII
+// letters, so the keys it built are rebuilt with NormalizeKey and rows that
+// turn out to be the same drug are merged into the one with the smallest id,
+// as the migration does for the rest.
+func rekeyMedications(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, name, brand, strength FROM medications ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	medications := make([]catalogRow, 0)
+	for rows.Next() {
+		var m catalogRow
+		if err := rows.Scan(&m.id, &m.name, &m.brand, &m.strength); err != nil {
+			return err
+		}
+		medications = append(medications, m)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	type key struct{ name, brand, strength string }
+
+	kept := make(map[key]string, len(medications))
+	merged := make(map[string]string)
+	for _, m := range medications {
+		k := key{NormalizeKey(m.name), NormalizeKey(m.brand), NormalizeKey(m.strength)}
+		if keep, ok := kept[k]; ok {
+			merged[m.id] = keep
+			continue
+		}
+		kept[k] = m.id
+	}
+
+	// Duplicates go first so no row briefly takes a key that is still in use
+	for dup, keep := range merged {
+		for _, stmt := range []string{
+			`UPDATE prescriptions SET medication_id = ? WHERE medication_id = ?`,
+			`UPDATE regimens SET medication_id = ? WHERE medication_id = ?`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt, keep, dup); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM medications WHERE id = ?`, dup); err != nil {
+			return err
+		}
+	}
+
+	for k, id := range kept {
+		_, err := tx.ExecContext(ctx,
+			`UPDATE medications SET name_key = ?, brand_key = ?, strength_key = ? WHERE id = ?`,
+			k.name, k.brand, k.strength, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
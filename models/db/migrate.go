@@ -0,0 +1,293 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration files are named <version>_<name>.<up|down>.sql. sqlc reads the
+// same directory as its schema and ignores the down files.
+//
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+const schemaVersionDDL = `CREATE TABLE IF NOT EXISTS schema_version (
+    version INT PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at BIGINT NOT NULL -- seconds since epoch
+)`
+
+// Go run by a migration after its SQL, in the same transaction, for what
+// SQLite can't do itself.
+var migrationFuncs = map[int]func(ctx context.Context, tx *sql.Tx) error{
+	15: rekeyMedications,
+}
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time // If nil, the migration is pending
+}
+
+// Migrations returns every embedded migration ordered by version.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration, len(entries))
+	for _, entry := range entries {
+		file := entry.Name()
+
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %q: expected <version>_<name>.<up|down>.sql", file)
+		}
+
+		versionS, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionS)
+		if err != nil {
+			return nil, fmt.Errorf("migration %q: invalid version: %w", file, err)
+		}
+
+		contents, err := migrationFS.ReadFile(path.Join("migrations", file))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s is missing its up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Status reports every known migration and when it was applied, if ever.
+func Status(ctx context.Context, db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction, and returns the ones it applied.
+func Up(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	statuses, err := Status(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	ran := make([]Migration, 0)
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			continue
+		}
+
+		m := status.Migration
+		err = inTx(ctx, db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+				return err
+			}
+
+			if f, ok := migrationFuncs[m.Version]; ok {
+				if err := f(ctx, tx); err != nil {
+					return err
+				}
+			}
+
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.Version, m.Name, time.Now().Unix())
+			return err
+		})
+		if err != nil {
+			return ran, fmt.Errorf("applying migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		ran = append(ran, m)
+	}
+
+	return ran, nil
+}
+
+// Down reverts up to steps of the most recently applied migrations and
+// returns the ones it reverted.
+func Down(ctx context.Context, db *sql.DB, steps int) ([]Migration, error) {
+	statuses, err := Status(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	ran := make([]Migration, 0, steps)
+	for i := len(statuses) - 1; i >= 0 && len(ran) < steps; i-- {
+		if statuses[i].AppliedAt == nil {
+			continue
+		}
+
+		m := statuses[i].Migration
+		if m.Down == "" {
+			return ran, fmt.Errorf("migration %d_%s cannot be reverted: missing down file", m.Version, m.Name)
+		}
+
+		err = inTx(ctx, db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+				return err
+			}
+
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_version WHERE version = ?`, m.Version)
+			return err
+		})
+		if err != nil {
+			return ran, fmt.Errorf("reverting migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		ran = append(ran, m)
+	}
+
+	return ran, nil
+}
+
+func appliedVersions(ctx context.Context, db *sql.DB) (map[int]time.Time, error) {
+	if _, err := db.ExecContext(ctx, schemaVersionDDL); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at int64
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = time.Unix(at, 0)
+	}
+
+	return applied, rows.Err()
+}
+
+// inTx runs f in a transaction with foreign keys off, so migrations can
+// rebuild tables other tables reference, which is how SQLite changes a
+// column's constraints. If they were on, the foreign keys are checked before
+// committing instead.
+func inTx(ctx context.Context, db *sql.DB, f func(tx *sql.Tx) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var foreignKeys bool
+	err = conn.QueryRowContext(ctx, `PRAGMA foreign_keys`).Scan(&foreignKeys)
+	if err != nil {
+		return err
+	}
+
+	if foreignKeys {
+		if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.WithoutCancel(ctx), `PRAGMA foreign_keys = ON`)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if foreignKeys {
+		if err := checkForeignKeys(ctx, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func checkForeignKeys(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `PRAGMA foreign_key_check`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fkid int
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return err
+		}
+		return fmt.Errorf("foreign key violated: %s row %d references a missing %s", table, rowid.Int64, parent)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+
+	sqldb, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqldb.Close()
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ran, err := Up(ctx, sqldb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", len(ran), len(migrations))
+	}
+
+	ran, err = Down(ctx, sqldb, len(migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != len(migrations) {
+		t.Fatalf("reverted %d migrations, want %d", len(ran), len(migrations))
+	}
+
+	_, err = Up(ctx, sqldb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rebuilding tables turns foreign keys off, only for the migration
+	var foreignKeys bool
+	err = sqldb.QueryRowContext(ctx, `PRAGMA foreign_keys`).Scan(&foreignKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !foreignKeys {
+		t.Error("foreign keys were left off")
+	}
+}
+
+func TestForeignKeysChecked(t *testing.T) {
+	ctx := context.Background()
+
+	sqldb, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqldb.Close()
+
+	_, err = Up(ctx, sqldb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Dependents' prescriptions would be left referencing missing users
+	_, err = sqldb.ExecContext(ctx, `
+		INSERT INTO users (id, approved) VALUES ('alice', true);
+		INSERT INTO patients (id, name, owner, created_at) VALUES ('kid', 'Kid', 'alice', 0);
+		INSERT INTO medications (id, name, generic, brand) VALUES ('ibuprofen', 'Ibuprofen', true, '');
+		INSERT INTO prescriptions (id, medication_id, schedule, refills, doses, patient)
+		VALUES ('rx', 'ibuprofen', '{}', 0, 1, 'kid');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Down(ctx, sqldb, 4)
+	if err == nil {
+		t.Fatal("reverted patients with a dependent's prescription left behind")
+	}
+
+	var prescriptions int
+	err = sqldb.QueryRowContext(ctx, `SELECT COUNT(*) FROM prescriptions`).Scan(&prescriptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prescriptions != 1 {
+		t.Errorf("got %d prescriptions after a failed revert, want 1", prescriptions)
+	}
+}
+
+func TestCatalogKeys(t *testing.T) {
+	ctx := context.Background()
+
+	sqldb, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqldb.Close()
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Up(ctx, sqldb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Back to before the catalog, when every prescription had its own row
+	_, err = Down(ctx, sqldb, len(migrations)-14)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = sqldb.ExecContext(ctx, `
+		INSERT INTO users (id, approved) VALUES ('alice', true);
+		INSERT INTO medications (id, name, generic, brand) VALUES
+			('a', 'ÉPO', true, ''),
+			('b', ' épo ', true, ''),
+			('c', 'Ibuprofen', true, 'ADVIL');
+		INSERT INTO prescriptions (id, medication_id, schedule, refills, doses, patient) VALUES
+			('rx-a', 'a', '{}', 0, 1, 'alice'),
+			('rx-b', 'b', '{}', 0, 1, 'alice'),
+			('rx-c', 'c', '{}', 0, 1, 'alice');
+		INSERT INTO regimens (id, medication_id, patient, prescription_id) VALUES
+			('reg-a', 'a', 'alice', 'rx-a'),
+			('reg-b', 'b', 'alice', 'rx-b'),
+			('reg-c', 'c', 'alice', 'rx-c');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Up(ctx, sqldb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := sqldb.QueryContext(ctx, `SELECT id, name_key, brand_key FROM medications ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	got := make([]string, 0)
+	for rows.Next() {
+		var id, name, brand string
+		if err := rows.Scan(&id, &name, &brand); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, id+":"+name+":"+brand)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a:épo:", "c:ibuprofen:advil"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got medications %q, want %q", got, want)
+	}
+
+	for _, table := range []string{"prescriptions", "regimens"} {
+		var merged int
+		err = sqldb.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+` WHERE medication_id = 'a'`).Scan(&merged)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if merged != 2 {
+			t.Errorf("got %d %s on the merged medication, want 2", merged, table)
+		}
+	}
+}
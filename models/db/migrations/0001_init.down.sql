@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS doses;
+
+DROP TABLE IF EXISTS regimens;
+
+DROP TABLE IF EXISTS prescriptions;
+
+DROP TABLE IF EXISTS medications;
+
+DROP TABLE IF EXISTS users;
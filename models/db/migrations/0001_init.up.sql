@@ -1,4 +1,7 @@
-CREATE TABLE doses (
+-- Baseline schema. Tables are created only if missing so databases that were
+-- created by hand before migrations existed can adopt this version as-is.
+
+CREATE TABLE IF NOT EXISTS doses (
     id TEXT PRIMARY KEY,
     regimen_id TEXT NOT NULL, -- References Regimen ID
     refill INT NOT NULL, -- which refill this dose is in
@@ -10,7 +13,7 @@ CREATE TABLE doses (
     FOREIGN KEY (regimen_id) REFERENCES regimens (id)
 );
 
-CREATE TABLE regimens (
+CREATE TABLE IF NOT EXISTS regimens (
     id TEXT PRIMARY KEY,
     medication_id TEXT NOT NULL, -- References Medication ID
     patient TEXT NOT NULL, -- References User ID
@@ -19,7 +22,7 @@ CREATE TABLE regimens (
     FOREIGN KEY (patient) REFERENCES users (id)
 );
 
-CREATE TABLE prescriptions (
+CREATE TABLE IF NOT EXISTS prescriptions (
     id TEXT PRIMARY KEY,
     medication_id TEXT NOT NULL, -- References Medication ID
     schedule BLOB NOT NULL, -- JSON schedule
@@ -31,11 +34,11 @@ CREATE TABLE prescriptions (
     FOREIGN KEY (patient) REFERENCES users (id)
 );
 
-CREATE TABLE medications (
+CREATE TABLE IF NOT EXISTS medications (
     id TEXT PRIMARY KEY,
     name TEXT NOT NULL,
     generic BOOLEAN NOT NULL,
     brand TEXT NOT NULL
 );
 
-CREATE TABLE users (id TEXT PRIMARY KEY, approved BOOLEAN NOT NULL);
+CREATE TABLE IF NOT EXISTS users (id TEXT PRIMARY KEY, approved BOOLEAN NOT NULL);
@@ -0,0 +1,5 @@
+ALTER TABLE prescriptions
+DROP COLUMN discontinued_reason;
+
+ALTER TABLE prescriptions
+DROP COLUMN discontinued_at;
@@ -0,0 +1,5 @@
+ALTER TABLE prescriptions
+ADD COLUMN discontinued_at BIGINT; -- If Null, still active
+
+ALTER TABLE prescriptions
+ADD COLUMN discontinued_reason TEXT;
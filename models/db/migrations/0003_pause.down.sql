@@ -0,0 +1,2 @@
+ALTER TABLE regimens
+DROP COLUMN paused_at;
@@ -0,0 +1,2 @@
+ALTER TABLE regimens
+ADD COLUMN paused_at BIGINT; -- If Null, not paused
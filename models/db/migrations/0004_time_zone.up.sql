@@ -0,0 +1,2 @@
+ALTER TABLE users
+ADD COLUMN time_zone TEXT NOT NULL DEFAULT ''; -- IANA zone, empty if unknown
@@ -0,0 +1,2 @@
+ALTER TABLE doses
+DROP COLUMN phase;
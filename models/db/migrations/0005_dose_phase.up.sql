@@ -0,0 +1,2 @@
+ALTER TABLE doses
+ADD COLUMN phase INT NOT NULL DEFAULT 0; -- which phase of a tapered schedule this dose is in
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS dose_events_dose_id;
+
+DROP TABLE IF EXISTS dose_events;
+
+ALTER TABLE doses
+DROP COLUMN amount_taken;
@@ -0,0 +1,17 @@
+ALTER TABLE doses
+ADD COLUMN amount_taken REAL; -- If Null, the scheduled amount was taken
+
+-- Append only. Rows are kept even if their dose is deleted.
+CREATE TABLE IF NOT EXISTS dose_events (
+    id TEXT PRIMARY KEY,
+    dose_id TEXT NOT NULL, -- References Dose ID
+    event TEXT NOT NULL, -- taken, skipped, undone, edited
+    actor TEXT NOT NULL, -- References User ID
+    time BIGINT NOT NULL, -- seconds since epoch
+    -- The dose after the event
+    taken BOOLEAN,
+    time_taken BIGINT,
+    amount_taken REAL
+);
+
+CREATE INDEX IF NOT EXISTS dose_events_dose_id ON dose_events (dose_id);
@@ -0,0 +1,2 @@
+ALTER TABLE prescriptions
+DROP COLUMN on_time_tolerance;
@@ -0,0 +1,2 @@
+ALTER TABLE prescriptions
+ADD COLUMN on_time_tolerance BIGINT; -- seconds, If Null the default is used
@@ -0,0 +1,5 @@
+ALTER TABLE prescriptions
+DROP COLUMN missed_grace;
+
+ALTER TABLE doses
+DROP COLUMN missed_at;
@@ -0,0 +1,5 @@
+ALTER TABLE doses
+ADD COLUMN missed_at BIGINT; -- If Null, the dose hasn't been missed
+
+ALTER TABLE prescriptions
+ADD COLUMN missed_grace BIGINT; -- seconds, If Null the default is used
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS reminders;
+
+DROP INDEX IF EXISTS notification_targets_user_id;
+
+DROP TABLE IF EXISTS notification_targets;
@@ -0,0 +1,18 @@
+-- Where a user's reminders are delivered
+CREATE TABLE IF NOT EXISTS notification_targets (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL, -- References User ID
+    channel TEXT NOT NULL, -- webhook, email, web_push
+    address TEXT NOT NULL, -- URL, email address or push subscription JSON
+    created_at BIGINT NOT NULL, -- seconds since epoch
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS notification_targets_user_id ON notification_targets (user_id);
+
+-- The last reminder sent about each dose
+CREATE TABLE IF NOT EXISTS reminders (
+    dose_id TEXT PRIMARY KEY, -- References Dose ID
+    sent_at BIGINT NOT NULL, -- seconds since epoch
+    count INT NOT NULL -- reminders sent so far
+);
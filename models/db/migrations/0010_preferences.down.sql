@@ -0,0 +1,4 @@
+ALTER TABLE prescriptions
+DROP COLUMN critical;
+
+DROP TABLE IF EXISTS user_preferences;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id TEXT PRIMARY KEY, -- References User ID
+    channels TEXT NOT NULL, -- comma separated, If empty every channel is used
+    lead_time BIGINT, -- seconds, If Null the default is used
+    snooze BIGINT, -- seconds, If Null the default is used
+    quiet_start BIGINT, -- seconds into the day, If Null there are no quiet hours
+    quiet_end BIGINT, -- seconds into the day
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+ALTER TABLE prescriptions
+ADD COLUMN critical BOOLEAN NOT NULL DEFAULT false; -- Reminders ignore quiet hours
@@ -0,0 +1,5 @@
+ALTER TABLE doses
+DROP COLUMN snoozes;
+
+ALTER TABLE doses
+DROP COLUMN snoozed_until;
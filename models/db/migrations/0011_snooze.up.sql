@@ -0,0 +1,5 @@
+ALTER TABLE doses
+ADD COLUMN snoozed_until BIGINT; -- If Null, due at time
+
+ALTER TABLE doses
+ADD COLUMN snoozes INT NOT NULL DEFAULT 0; -- times the dose was snoozed
@@ -0,0 +1,11 @@
+ALTER TABLE prescriptions
+DROP COLUMN low_supply_alerted_at;
+
+ALTER TABLE prescriptions
+DROP COLUMN low_supply;
+
+DROP INDEX IF EXISTS inventory_dose_id;
+
+DROP INDEX IF EXISTS inventory_prescription_id;
+
+DROP TABLE IF EXISTS inventory;
@@ -0,0 +1,23 @@
+-- Every change to the medication on hand for a prescription. What is on
+-- hand is the sum of quantity.
+CREATE TABLE IF NOT EXISTS inventory (
+    id TEXT PRIMARY KEY,
+    prescription_id TEXT NOT NULL, -- References Prescription ID
+    kind TEXT NOT NULL, -- fill, dose, adjustment
+    quantity REAL NOT NULL, -- added if positive, removed if negative
+    dose_id TEXT, -- References Dose ID, If Null not a dose entry
+    note TEXT NOT NULL,
+    actor TEXT NOT NULL, -- References User ID
+    time BIGINT NOT NULL, -- seconds since epoch
+    FOREIGN KEY (prescription_id) REFERENCES prescriptions (id)
+);
+
+CREATE INDEX IF NOT EXISTS inventory_prescription_id ON inventory (prescription_id);
+
+CREATE INDEX IF NOT EXISTS inventory_dose_id ON inventory (dose_id);
+
+ALTER TABLE prescriptions
+ADD COLUMN low_supply REAL; -- If Null, no low supply alerts
+
+ALTER TABLE prescriptions
+ADD COLUMN low_supply_alerted_at BIGINT; -- If Null, no alert is outstanding
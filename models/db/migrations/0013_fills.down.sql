@@ -0,0 +1,7 @@
+-- Doses of refills that were never filled aren't brought back
+ALTER TABLE prescriptions
+DROP COLUMN refills_used;
+
+DROP INDEX IF EXISTS fills_prescription_id;
+
+DROP TABLE IF EXISTS fills;
@@ -0,0 +1,89 @@
+-- Pharmacy fills of a prescription after the original. Doses used to be
+-- generated for every refill up front; now each fill adds its own.
+CREATE TABLE IF NOT EXISTS fills (
+    id TEXT PRIMARY KEY,
+    prescription_id TEXT NOT NULL, -- References Prescription ID
+    refill INT NOT NULL, -- 1 for the first refill
+    time BIGINT NOT NULL, -- seconds since epoch the fill was picked up
+    quantity REAL NOT NULL, -- in the units of the prescription's doses
+    pharmacy TEXT NOT NULL,
+    actor TEXT NOT NULL, -- References User ID
+    FOREIGN KEY (prescription_id) REFERENCES prescriptions (id)
+);
+
+CREATE INDEX IF NOT EXISTS fills_prescription_id ON fills (prescription_id);
+
+ALTER TABLE prescriptions
+ADD COLUMN refills_used INT NOT NULL DEFAULT 0;
+
+-- Refills that were generated up front and have doses due by now are taken
+-- to have been filled when their first dose was due.
+INSERT INTO
+    fills (id, prescription_id, refill, time, quantity, pharmacy, actor)
+SELECT
+    lower(hex(randomblob(16))),
+    regimens.prescription_id,
+    doses.refill,
+    MIN(doses.time),
+    0,
+    '',
+    regimens.patient
+FROM
+    doses
+    INNER JOIN regimens ON doses.regimen_id = regimens.id
+WHERE
+    doses.refill > 0
+GROUP BY
+    regimens.prescription_id,
+    doses.refill
+HAVING
+    MIN(doses.time) <= CAST(strftime('%s', 'now') AS INTEGER);
+
+UPDATE prescriptions
+SET
+    refills_used = (
+        SELECT
+            COUNT(*)
+        FROM
+            fills
+        WHERE
+            fills.prescription_id = prescriptions.id
+    );
+
+-- The rest were never filled, so their doses go until they are
+DELETE FROM reminders
+WHERE
+    dose_id IN (
+        SELECT
+            doses.id
+        FROM
+            doses
+            INNER JOIN regimens ON doses.regimen_id = regimens.id
+        WHERE
+            doses.refill > 0
+            AND doses.taken IS NULL
+            AND NOT EXISTS (
+                SELECT
+                    1
+                FROM
+                    fills
+                WHERE
+                    fills.prescription_id = regimens.prescription_id
+                    AND fills.refill = doses.refill
+            )
+    );
+
+DELETE FROM doses
+WHERE
+    doses.refill > 0
+    AND doses.taken IS NULL
+    AND NOT EXISTS (
+        SELECT
+            1
+        FROM
+            fills
+            INNER JOIN regimens ON fills.prescription_id = regimens.prescription_id
+        WHERE
+            regimens.id = doses.regimen_id
+            AND fills.refill = doses.refill
+    );
@@ -0,0 +1,2 @@
+ALTER TABLE user_preferences
+DROP COLUMN refill_lead_days;
@@ -0,0 +1,2 @@
+ALTER TABLE user_preferences
+ADD COLUMN refill_lead_days INT; -- If Null the default is used
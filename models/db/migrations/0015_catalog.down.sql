@@ -0,0 +1,16 @@
+-- Merged medications stay merged
+DROP INDEX IF EXISTS medications_brand_key;
+
+DROP INDEX IF EXISTS medications_key;
+
+ALTER TABLE medications
+DROP COLUMN strength_key;
+
+ALTER TABLE medications
+DROP COLUMN brand_key;
+
+ALTER TABLE medications
+DROP COLUMN name_key;
+
+ALTER TABLE medications
+DROP COLUMN strength;
@@ -0,0 +1,87 @@
+-- Medications become a shared catalog, one row per drug. The keys are the
+-- name, brand and strength lowercased with runs of spaces collapsed, and
+-- are what a medication is looked up by.
+ALTER TABLE medications
+ADD COLUMN strength TEXT NOT NULL DEFAULT ''; -- e.g. 500 mg, If empty unknown
+
+ALTER TABLE medications
+ADD COLUMN name_key TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE medications
+ADD COLUMN brand_key TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE medications
+ADD COLUMN strength_key TEXT NOT NULL DEFAULT '';
+
+-- Keys have to match the ones the server builds, which splits on
+-- whitespace and joins the words with single spaces. SQLite's lower() only
+-- folds ASCII letters, so Up rebuilds the keys in Go once this has run,
+-- see rekeyMedications.
+UPDATE medications
+SET
+    name_key = replace(replace(replace(replace(replace(name, char(9), ' '), char(10), ' '), char(11), ' '), char(12), ' '), char(13), ' '),
+    brand_key = replace(replace(replace(replace(replace(brand, char(9), ' '), char(10), ' '), char(11), ' '), char(12), ' '), char(13), ' ');
+
+-- Runs of spaces are collapsed by marking each space, dropping the marks
+-- followed by another space, and then the marks that are left
+UPDATE medications
+SET
+    name_key = replace(
+        replace(replace(name_key, ' ', ' ' || char(1)), char(1) || ' ', ''),
+        char(1),
+        ''
+    ),
+    brand_key = replace(
+        replace(replace(brand_key, ' ', ' ' || char(1)), char(1) || ' ', ''),
+        char(1),
+        ''
+    );
+
+UPDATE medications
+SET
+    name_key = lower(trim(name_key)),
+    brand_key = lower(trim(brand_key));
+
+-- Every prescription used to get its own row, so rows with the same keys
+-- are merged
+UPDATE prescriptions
+SET
+    medication_id = (
+        SELECT
+            MIN(keep.id)
+        FROM
+            medications AS dup
+            INNER JOIN medications AS keep ON keep.name_key = dup.name_key
+            AND keep.brand_key = dup.brand_key
+            AND keep.strength_key = dup.strength_key
+        WHERE
+            dup.id = prescriptions.medication_id
+    );
+
+UPDATE regimens
+SET
+    medication_id = (
+        SELECT
+            prescriptions.medication_id
+        FROM
+            prescriptions
+        WHERE
+            prescriptions.id = regimens.prescription_id
+    );
+
+DELETE FROM medications
+WHERE
+    id NOT IN (
+        SELECT
+            MIN(id)
+        FROM
+            medications
+        GROUP BY
+            name_key,
+            brand_key,
+            strength_key
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS medications_key ON medications (name_key, brand_key, strength_key);
+
+CREATE INDEX IF NOT EXISTS medications_brand_key ON medications (brand_key);
@@ -0,0 +1,16 @@
+-- Fails if the same drug was added in more than one form
+DROP INDEX IF EXISTS medications_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS medications_key ON medications (name_key, brand_key, strength_key);
+
+ALTER TABLE medications
+DROP COLUMN route;
+
+ALTER TABLE medications
+DROP COLUMN form;
+
+ALTER TABLE medications
+DROP COLUMN strength_unit;
+
+ALTER TABLE medications
+DROP COLUMN strength_value;
@@ -0,0 +1,25 @@
+ALTER TABLE medications
+ADD COLUMN strength_value REAL; -- If Null the strength is unknown
+
+ALTER TABLE medications
+ADD COLUMN strength_unit TEXT NOT NULL DEFAULT ''; -- e.g. mg, mg/5 mL
+
+ALTER TABLE medications
+ADD COLUMN form TEXT NOT NULL DEFAULT ''; -- tablet, capsule, liquid, injection, patch, inhaler, If empty unknown
+
+ALTER TABLE medications
+ADD COLUMN route TEXT NOT NULL DEFAULT ''; -- oral, topical, etc, If empty unknown
+
+-- Strengths were saved as a number, a space and the unit
+UPDATE medications
+SET
+    strength_value = CAST(substr(strength, 1, instr(strength, ' ') - 1) AS REAL),
+    strength_unit = substr(strength, instr(strength, ' ') + 1)
+WHERE
+    instr(strength, ' ') > 0
+    AND CAST(substr(strength, 1, instr(strength, ' ') - 1) AS REAL) > 0;
+
+-- The same drug can come as a tablet and as a liquid
+DROP INDEX IF EXISTS medications_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS medications_key ON medications (name_key, brand_key, strength_key, form);
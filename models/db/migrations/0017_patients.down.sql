@@ -0,0 +1,64 @@
+-- Prescriptions of dependents are kept, keyed by patients that no longer
+-- exist, so with foreign keys on this fails until they are deleted
+
+CREATE TABLE regimens_old (
+    id TEXT PRIMARY KEY,
+    medication_id TEXT NOT NULL, -- References Medication ID
+    patient TEXT NOT NULL, -- References User ID
+    prescription_id TEXT NOT NULL, -- References Prescription ID
+    paused_at BIGINT,
+    FOREIGN KEY (medication_id) REFERENCES medications (id),
+    FOREIGN KEY (patient) REFERENCES users (id)
+);
+
+INSERT INTO
+    regimens_old
+SELECT
+    *
+FROM
+    regimens;
+
+DROP TABLE regimens;
+
+ALTER TABLE regimens_old
+RENAME TO regimens;
+
+CREATE TABLE prescriptions_old (
+    id TEXT PRIMARY KEY,
+    medication_id TEXT NOT NULL, -- References Medication ID
+    schedule BLOB NOT NULL, -- JSON schedule
+    scheduled_start BIGINT, -- If Null, hasn't started
+    refills INT NOT NULL,
+    doses INT NOT NULL,
+    patient TEXT NOT NULL, -- References User ID
+    discontinued_at BIGINT,
+    discontinued_reason TEXT,
+    on_time_tolerance BIGINT,
+    missed_grace BIGINT,
+    critical BOOLEAN NOT NULL DEFAULT false,
+    low_supply REAL,
+    low_supply_alerted_at BIGINT,
+    refills_used INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (medication_id) REFERENCES medications (id),
+    FOREIGN KEY (patient) REFERENCES users (id)
+);
+
+INSERT INTO
+    prescriptions_old
+SELECT
+    *
+FROM
+    prescriptions;
+
+DROP TABLE prescriptions;
+
+ALTER TABLE prescriptions_old
+RENAME TO prescriptions;
+
+DROP INDEX IF EXISTS caregivers_user_id;
+
+DROP TABLE IF EXISTS caregivers;
+
+DROP INDEX IF EXISTS patients_owner;
+
+DROP TABLE IF EXISTS patients;
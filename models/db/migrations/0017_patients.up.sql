@@ -0,0 +1,98 @@
+-- Patients are whose medications are tracked, separate from the users that
+-- log in. Every user is a patient with the same id, and a user can add
+-- dependents, like children, that don't log in themselves.
+CREATE TABLE IF NOT EXISTS patients (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    user_id TEXT UNIQUE, -- References User ID, If Null the patient doesn't log in
+    owner TEXT NOT NULL, -- References User ID, who grants caregivers access
+    time_zone TEXT NOT NULL DEFAULT '', -- IANA zone, empty if unknown. The user's zone is used if there is one
+    created_at BIGINT NOT NULL, -- seconds since epoch
+    FOREIGN KEY (user_id) REFERENCES users (id),
+    FOREIGN KEY (owner) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS patients_owner ON patients (owner);
+
+INSERT INTO
+    patients (id, name, user_id, owner, created_at)
+SELECT
+    id,
+    '',
+    id,
+    id,
+    CAST(strftime('%s', 'now') AS INTEGER)
+FROM
+    users;
+
+-- Users a patient's owner has given access to the patient's records
+CREATE TABLE IF NOT EXISTS caregivers (
+    patient_id TEXT NOT NULL, -- References Patient ID
+    user_id TEXT NOT NULL, -- References User ID
+    grant_level TEXT NOT NULL, -- view, log, manage
+    granted_by TEXT NOT NULL, -- References User ID
+    granted_at BIGINT NOT NULL, -- seconds since epoch
+    PRIMARY KEY (patient_id, user_id),
+    FOREIGN KEY (patient_id) REFERENCES patients (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS caregivers_user_id ON caregivers (user_id);
+
+-- Prescriptions and regimens are keyed by patient now, and dependents are
+-- only in patients, so their foreign keys move from users to patients.
+-- SQLite can't change a foreign key, so the tables are rebuilt.
+
+CREATE TABLE prescriptions_new (
+    id TEXT PRIMARY KEY,
+    medication_id TEXT NOT NULL, -- References Medication ID
+    schedule BLOB NOT NULL, -- JSON schedule
+    scheduled_start BIGINT, -- If Null, hasn't started
+    refills INT NOT NULL,
+    doses INT NOT NULL,
+    patient TEXT NOT NULL, -- References Patient ID
+    discontinued_at BIGINT,
+    discontinued_reason TEXT,
+    on_time_tolerance BIGINT,
+    missed_grace BIGINT,
+    critical BOOLEAN NOT NULL DEFAULT false,
+    low_supply REAL,
+    low_supply_alerted_at BIGINT,
+    refills_used INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (medication_id) REFERENCES medications (id),
+    FOREIGN KEY (patient) REFERENCES patients (id)
+);
+
+INSERT INTO
+    prescriptions_new
+SELECT
+    *
+FROM
+    prescriptions;
+
+DROP TABLE prescriptions;
+
+ALTER TABLE prescriptions_new
+RENAME TO prescriptions;
+
+CREATE TABLE regimens_new (
+    id TEXT PRIMARY KEY,
+    medication_id TEXT NOT NULL, -- References Medication ID
+    patient TEXT NOT NULL, -- References Patient ID
+    prescription_id TEXT NOT NULL, -- References Prescription ID
+    paused_at BIGINT,
+    FOREIGN KEY (medication_id) REFERENCES medications (id),
+    FOREIGN KEY (patient) REFERENCES patients (id)
+);
+
+INSERT INTO
+    regimens_new
+SELECT
+    *
+FROM
+    regimens;
+
+DROP TABLE regimens;
+
+ALTER TABLE regimens_new
+RENAME TO regimens;
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS user_decisions_user_id;
+
+DROP TABLE IF EXISTS user_decisions;
+
+DROP INDEX IF EXISTS users_status;
+
+ALTER TABLE users
+DROP COLUMN created_at;
+
+ALTER TABLE users
+DROP COLUMN status;
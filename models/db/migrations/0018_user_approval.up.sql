@@ -0,0 +1,28 @@
+-- Users are approved, denied and revoked by admins. approved is kept in
+-- step with status, approved exactly when status is approved.
+ALTER TABLE users
+ADD COLUMN status TEXT NOT NULL DEFAULT 'pending'; -- pending, approved, denied, revoked
+
+ALTER TABLE users
+ADD COLUMN created_at BIGINT; -- seconds since epoch, If Null from before sign ups were recorded
+
+UPDATE users
+SET
+    status = 'approved'
+WHERE
+    approved;
+
+CREATE INDEX IF NOT EXISTS users_status ON users (status);
+
+-- Every admin decision about a user, as an audit trail
+CREATE TABLE IF NOT EXISTS user_decisions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL, -- References User ID
+    decision TEXT NOT NULL, -- approved, denied, revoked
+    reason TEXT NOT NULL,
+    actor TEXT NOT NULL, -- Subject of the admin who decided
+    time BIGINT NOT NULL, -- seconds since epoch
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS user_decisions_user_id ON user_decisions (user_id);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS invite_failures_user_id;
+
+DROP TABLE IF EXISTS invite_failures;
+
+DROP TABLE IF EXISTS invite_redemptions;
+
+DROP INDEX IF EXISTS invites_created_by;
+
+DROP TABLE IF EXISTS invites;
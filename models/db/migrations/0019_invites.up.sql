@@ -0,0 +1,32 @@
+-- Invite codes let new users approve themselves. Only a hash of each code
+-- is kept.
+CREATE TABLE IF NOT EXISTS invites (
+    id TEXT PRIMARY KEY,
+    code_hash TEXT NOT NULL UNIQUE, -- hex SHA-256 of the normalized code
+    created_by TEXT NOT NULL, -- References User ID, or the subject of an admin
+    max_uses INT NOT NULL,
+    uses INT NOT NULL DEFAULT 0,
+    expires_at BIGINT NOT NULL, -- seconds since epoch
+    created_at BIGINT NOT NULL -- seconds since epoch
+);
+
+CREATE INDEX IF NOT EXISTS invites_created_by ON invites (created_by);
+
+CREATE TABLE IF NOT EXISTS invite_redemptions (
+    invite_id TEXT NOT NULL, -- References Invite ID
+    user_id TEXT NOT NULL, -- References User ID
+    time BIGINT NOT NULL, -- seconds since epoch
+    PRIMARY KEY (invite_id, user_id),
+    FOREIGN KEY (invite_id) REFERENCES invites (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+-- Codes that didn't work, to limit how fast users can guess
+CREATE TABLE IF NOT EXISTS invite_failures (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL, -- References User ID
+    time BIGINT NOT NULL, -- seconds since epoch
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS invite_failures_user_id ON invite_failures (user_id, time);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS api_keys_user_id;
+
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,15 @@
+-- Personal API keys let scripts act as a user without a token. Only a hash
+-- of each key is kept.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL, -- References User ID
+    name TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE, -- hex SHA-256 of the key
+    scopes TEXT NOT NULL, -- space separated
+    last_used_at BIGINT, -- seconds since epoch, null if never used
+    revoked_at BIGINT, -- seconds since epoch
+    created_at BIGINT NOT NULL, -- seconds since epoch
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id ON api_keys (user_id);
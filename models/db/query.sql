@@ -6,11 +6,11 @@ VALUES
 
 -- name: CreateDose :one
 INSERT INTO
-    doses (id, regimen_id, refill, time, amount, unit)
+    doses (id, regimen_id, refill, time, amount, unit, phase)
 VALUES
-    (?, ?, ?, ?, ?, ?) RETURNING *;
+    (?, ?, ?, ?, ?, ?, ?) RETURNING *;
 
--- name: DosesTillEmpty :one
+-- name: CountPendingDoses :one
 SELECT
     count(*)
 FROM
@@ -19,24 +19,6 @@ WHERE
     doses.regimen_id = ?
     AND doses.taken IS NULL;
 
--- name: DosesTillRefill :one
-SELECT
-    COUNT(*)
-FROM
-    doses
-WHERE
-    doses.regimen_id = ?
-    AND doses.taken IS NULL
-    AND doses.refill = (
-        SELECT
-            MIN(dose_inner.refill)
-        FROM
-            doses AS dose_inner
-        WHERE
-            dose_inner.regimen_id = ?
-            AND dose_inner.taken IS NULL
-    );
-
 -- name: GetDosesByPatient :many
 SELECT
     doses.*,
@@ -46,11 +28,15 @@ FROM
     doses
     INNER JOIN regimens ON doses.regimen_id = regimens.id
     INNER JOIN medications ON regimens.medication_id = medications.id
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
 WHERE
     doses.taken IS NULL
+    AND doses.missed_at IS NULL
+    AND prescriptions.discontinued_at IS NULL
+    AND regimens.paused_at IS NULL
     AND regimens.patient = ?
 ORDER BY
-    doses.Time;
+    COALESCE(doses.snoozed_until, doses.time);
 
 -- name: GetDosesByPatientLimitBy :many
 SELECT
@@ -61,21 +47,27 @@ FROM
     doses
     INNER JOIN regimens ON doses.regimen_id = regimens.id
     INNER JOIN medications ON regimens.medication_id = medications.id
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
 WHERE
     doses.taken IS NULL
+    AND doses.missed_at IS NULL
+    AND prescriptions.discontinued_at IS NULL
+    AND regimens.paused_at IS NULL
     AND regimens.patient = ?
 ORDER BY
-    doses.Time
+    COALESCE(doses.snoozed_until, doses.time)
 LIMIT
     ?;
 
--- name: MarkDoseTaken :exec
+-- name: MarkDoseTaken :execrows
 UPDATE doses
 SET
     taken = ?,
-    time_taken = ?
+    time_taken = ?,
+    missed_at = NULL
 WHERE
-    id = ?;
+    id = ?
+    AND taken IS NULL;
 
 -- name: CreateRx :one
 INSERT INTO
@@ -86,10 +78,14 @@ INSERT INTO
         refills,
         doses,
         schedule,
-        patient
+        patient,
+        on_time_tolerance,
+        missed_grace,
+        critical,
+        low_supply
     )
 VALUES
-    (?, ?, ?, ?, ?, ?, ?) RETURNING *;
+    (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING *;
 
 -- name: GetRx :one
 SELECT
@@ -101,9 +97,49 @@ WHERE
 
 -- name: CreateMedication :one
 INSERT INTO
-    medications (id, name, generic, brand)
+    medications (
+        id,
+        name,
+        generic,
+        brand,
+        strength,
+        name_key,
+        brand_key,
+        strength_key,
+        strength_value,
+        strength_unit,
+        form,
+        route
+    )
 VALUES
-    (?, ?, ?, ?) RETURNING *;
+    (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING *;
+
+-- name: GetMedicationByKey :one
+SELECT
+    *
+FROM
+    medications
+WHERE
+    name_key = ?
+    AND brand_key = ?
+    AND strength_key = ?
+    AND form = ?;
+
+-- name: SearchMedications :many
+SELECT
+    *
+FROM
+    medications
+WHERE
+    name_key GLOB sqlc.arg (pattern)
+    OR brand_key GLOB sqlc.arg (pattern)
+ORDER BY
+    name_key,
+    brand_key,
+    strength_key,
+    form
+LIMIT
+    sqlc.arg (max_results);
 
 -- name: GetMedication :one
 SELECT
@@ -115,9 +151,9 @@ WHERE
 
 -- name: CreateUser :one
 INSERT INTO
-    users (id, approved)
+    users (id, approved, created_at)
 VALUES
-    (?, false) RETURNING *;
+    (?, false, CAST(strftime('%s', 'now') AS INTEGER)) RETURNING *;
 
 -- name: GetUser :one
 SELECT
@@ -126,3 +162,858 @@ FROM
     users
 WHERE
     id = ?;
+
+-- name: GetRxByPatient :one
+SELECT
+    *
+FROM
+    prescriptions
+WHERE
+    id = ?
+    AND patient = ?;
+
+-- name: UpdateRx :one
+UPDATE prescriptions
+SET
+    schedule = ?,
+    scheduled_start = ?,
+    refills = ?,
+    doses = ?,
+    on_time_tolerance = ?,
+    missed_grace = ?,
+    critical = ?,
+    low_supply = ?
+WHERE
+    id = ? RETURNING *;
+
+-- name: GetRegimenByPatient :one
+SELECT
+    regimens.*
+FROM
+    regimens
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+WHERE
+    regimens.id = sqlc.arg (id)
+    AND regimens.patient = sqlc.arg (patient)
+    AND prescriptions.patient = sqlc.arg (patient);
+
+-- name: GetRegimenByRx :one
+SELECT
+    *
+FROM
+    regimens
+WHERE
+    prescription_id = ?;
+
+-- name: CountLoggedDoses :one
+SELECT
+    count(*)
+FROM
+    doses
+WHERE
+    doses.regimen_id = ?
+    AND (
+        doses.taken IS NOT NULL
+        OR doses.missed_at IS NOT NULL
+    );
+
+-- name: DeletePendingReminders :exec
+DELETE FROM reminders
+WHERE
+    dose_id IN (
+        SELECT
+            doses.id
+        FROM
+            doses
+        WHERE
+            doses.regimen_id = ?
+            AND doses.taken IS NULL
+            AND doses.missed_at IS NULL
+    );
+
+-- name: DeletePendingDoses :exec
+DELETE FROM doses
+WHERE
+    regimen_id = ?
+    AND taken IS NULL
+    AND missed_at IS NULL;
+
+-- name: DiscontinueRx :one
+UPDATE prescriptions
+SET
+    discontinued_at = ?,
+    discontinued_reason = ?
+WHERE
+    id = ? RETURNING *;
+
+-- name: DeletePendingRemindersAfter :exec
+DELETE FROM reminders
+WHERE
+    dose_id IN (
+        SELECT
+            doses.id
+        FROM
+            doses
+        WHERE
+            doses.regimen_id = ?
+            AND doses.taken IS NULL
+            AND doses.missed_at IS NULL
+            AND doses.time > ?
+    );
+
+-- name: DeletePendingDosesAfter :exec
+DELETE FROM doses
+WHERE
+    regimen_id = ?
+    AND taken IS NULL
+    AND missed_at IS NULL
+    AND time > ?;
+
+-- name: DeleteRemindersByRx :exec
+DELETE FROM reminders
+WHERE
+    dose_id IN (
+        SELECT
+            doses.id
+        FROM
+            doses
+            INNER JOIN regimens ON doses.regimen_id = regimens.id
+        WHERE
+            regimens.prescription_id = ?
+    );
+
+-- name: DeleteDosesByRx :exec
+DELETE FROM doses
+WHERE
+    regimen_id IN (
+        SELECT
+            regimens.id
+        FROM
+            regimens
+        WHERE
+            regimens.prescription_id = ?
+    );
+
+-- name: DeleteRegimensByRx :exec
+DELETE FROM regimens
+WHERE
+    prescription_id = ?;
+
+-- name: DeleteFillsByRx :exec
+DELETE FROM fills
+WHERE
+    prescription_id = ?;
+
+-- name: DeleteInventoryByRx :exec
+DELETE FROM inventory
+WHERE
+    prescription_id = ?;
+
+-- name: DeleteRx :exec
+DELETE FROM prescriptions
+WHERE
+    id = ?;
+
+-- name: PauseRegimen :exec
+UPDATE regimens
+SET
+    paused_at = ?
+WHERE
+    id = ?;
+
+-- name: ResumeRegimen :exec
+UPDATE regimens
+SET
+    paused_at = NULL
+WHERE
+    id = ?;
+
+-- name: ShiftPendingDoses :exec
+UPDATE doses
+SET
+    time = time + sqlc.arg (shift),
+    snoozed_until = snoozed_until + sqlc.arg (shift)
+WHERE
+    regimen_id = sqlc.arg (regimen_id)
+    AND taken IS NULL
+    AND time >= sqlc.arg (since);
+
+-- name: SetUserTimeZone :one
+UPDATE users
+SET
+    time_zone = ?
+WHERE
+    id = ? RETURNING *;
+
+-- name: GetPendingDosesByPatient :many
+SELECT
+    doses.id,
+    doses.time,
+    prescriptions.schedule
+FROM
+    doses
+    INNER JOIN regimens ON doses.regimen_id = regimens.id
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+WHERE
+    doses.taken IS NULL
+    AND doses.missed_at IS NULL
+    AND regimens.patient = ?;
+
+-- name: UpdateDoseTime :exec
+UPDATE doses
+SET
+    time = sqlc.arg (time),
+    snoozed_until = snoozed_until + sqlc.arg (time) - time
+WHERE
+    id = sqlc.arg (id);
+
+-- name: CreateTakenDose :one
+INSERT INTO
+    doses (
+        id,
+        regimen_id,
+        refill,
+        time,
+        amount,
+        unit,
+        taken,
+        time_taken
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, true, ?) RETURNING *;
+
+-- name: GetTakenDosesSince :many
+SELECT
+    *
+FROM
+    doses
+WHERE
+    regimen_id = ?
+    AND taken = true
+    AND time_taken >= ?
+ORDER BY
+    time_taken;
+
+-- name: GetNextPendingDose :one
+SELECT
+    *
+FROM
+    doses
+WHERE
+    regimen_id = ?
+    AND taken IS NULL
+    AND missed_at IS NULL
+ORDER BY
+    time
+LIMIT
+    1;
+
+-- name: GetDose :one
+SELECT
+    *
+FROM
+    doses
+WHERE
+    id = ?;
+
+-- name: GetDoseByPatient :one
+SELECT
+    doses.*,
+    prescriptions.id AS prescription_id,
+    prescriptions.schedule
+FROM
+    doses
+    INNER JOIN regimens ON doses.regimen_id = regimens.id
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+WHERE
+    doses.id = sqlc.arg (id)
+    AND regimens.patient = sqlc.arg (patient)
+    AND prescriptions.patient = sqlc.arg (patient);
+
+-- name: UpdateDoseLog :one
+UPDATE doses
+SET
+    taken = ?,
+    time_taken = ?,
+    amount_taken = ?
+WHERE
+    id = ? RETURNING *;
+
+-- name: DeleteDose :exec
+DELETE FROM doses
+WHERE
+    id = ?;
+
+-- name: CreateDoseEvent :one
+INSERT INTO
+    dose_events (
+        id,
+        dose_id,
+        event,
+        actor,
+        time,
+        taken,
+        time_taken,
+        amount_taken
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, ?, ?) RETURNING *;
+
+-- name: GetDoseEvents :many
+SELECT
+    *
+FROM
+    dose_events
+WHERE
+    dose_id = ?
+ORDER BY
+    time;
+
+-- name: GetDosesInRange :many
+SELECT
+    doses.*,
+    prescriptions.id AS prescription_id,
+    prescriptions.schedule,
+    prescriptions.on_time_tolerance,
+    medications.*
+FROM
+    doses
+    INNER JOIN regimens ON doses.regimen_id = regimens.id
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+    INNER JOIN medications ON regimens.medication_id = medications.id
+WHERE
+    regimens.patient = sqlc.arg (patient)
+    AND prescriptions.patient = sqlc.arg (patient)
+    AND doses.time >= sqlc.arg (since)
+    AND doses.time < sqlc.arg (until)
+    AND (
+        sqlc.narg (prescription_id) IS NULL
+        OR prescriptions.id = sqlc.narg (prescription_id)
+    )
+ORDER BY
+    doses.time;
+
+-- name: MarkOverdueDosesMissed :execrows
+UPDATE doses
+SET
+    missed_at = sqlc.arg (now)
+WHERE
+    taken IS NULL
+    AND missed_at IS NULL
+    AND id IN (
+        SELECT
+            doses.id
+        FROM
+            doses
+            INNER JOIN regimens ON doses.regimen_id = regimens.id
+            INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+        WHERE
+            prescriptions.discontinued_at IS NULL
+            AND regimens.paused_at IS NULL
+            AND COALESCE(doses.snoozed_until, doses.time) + COALESCE(
+                prescriptions.missed_grace,
+                sqlc.arg (default_grace)
+            ) < sqlc.arg (now)
+    );
+
+-- name: CreateNotificationTarget :one
+INSERT INTO
+    notification_targets (id, user_id, channel, address, created_at)
+VALUES
+    (?, ?, ?, ?, ?) RETURNING *;
+
+-- name: GetNotificationTargets :many
+SELECT
+    *
+FROM
+    notification_targets
+WHERE
+    user_id = ?
+ORDER BY
+    created_at;
+
+-- name: DeleteNotificationTarget :execrows
+DELETE FROM notification_targets
+WHERE
+    id = ?
+    AND user_id = ?;
+
+-- name: GetDueReminders :many
+SELECT
+    doses.id,
+    doses.time,
+    doses.snoozed_until,
+    doses.amount,
+    doses.unit,
+    regimens.patient,
+    regimens.prescription_id,
+    prescriptions.critical,
+    medications.name,
+    reminders.sent_at,
+    reminders.count
+FROM
+    doses
+    INNER JOIN regimens ON doses.regimen_id = regimens.id
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+    INNER JOIN medications ON regimens.medication_id = medications.id
+    LEFT JOIN reminders ON reminders.dose_id = doses.id
+WHERE
+    doses.taken IS NULL
+    AND doses.missed_at IS NULL
+    AND prescriptions.discontinued_at IS NULL
+    AND regimens.paused_at IS NULL
+    AND COALESCE(doses.snoozed_until, doses.time) >= sqlc.arg (since)
+    AND COALESCE(doses.snoozed_until, doses.time) <= sqlc.arg (until)
+    AND (
+        reminders.dose_id IS NULL
+        OR reminders.sent_at <= sqlc.arg (renotify_before)
+        AND reminders.count < sqlc.arg (max_count)
+    )
+ORDER BY
+    COALESCE(doses.snoozed_until, doses.time);
+
+-- name: RecordReminder :exec
+INSERT INTO
+    reminders (dose_id, sent_at, count)
+VALUES
+    (?, ?, 1) ON CONFLICT (dose_id) DO
+UPDATE
+SET
+    sent_at = excluded.sent_at,
+    count = reminders.count + 1;
+
+-- name: GetUserPreferences :one
+SELECT
+    *
+FROM
+    user_preferences
+WHERE
+    user_id = ?;
+
+-- name: SetUserPreferences :one
+INSERT INTO
+    user_preferences (
+        user_id,
+        channels,
+        lead_time,
+        snooze,
+        quiet_start,
+        quiet_end,
+        refill_lead_days
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (user_id) DO
+UPDATE
+SET
+    channels = excluded.channels,
+    lead_time = excluded.lead_time,
+    snooze = excluded.snooze,
+    quiet_start = excluded.quiet_start,
+    quiet_end = excluded.quiet_end,
+    refill_lead_days = excluded.refill_lead_days RETURNING *;
+
+-- name: DeleteUserPreferences :exec
+DELETE FROM user_preferences
+WHERE
+    user_id = ?;
+
+-- name: SnoozeDose :one
+UPDATE doses
+SET
+    snoozed_until = ?,
+    snoozes = snoozes + 1
+WHERE
+    id = ?
+    AND taken IS NULL
+    AND missed_at IS NULL RETURNING *;
+
+-- name: DeleteReminder :exec
+DELETE FROM reminders
+WHERE
+    dose_id = ?;
+
+-- name: CreateInventoryEntry :one
+INSERT INTO
+    inventory (
+        id,
+        prescription_id,
+        kind,
+        quantity,
+        dose_id,
+        note,
+        actor,
+        time
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, ?, ?) RETURNING *;
+
+-- name: GetInventory :many
+SELECT
+    *
+FROM
+    inventory
+WHERE
+    prescription_id = ?
+ORDER BY
+    time,
+    rowid;
+
+-- name: GetOnHand :one
+SELECT
+    CAST(COALESCE(SUM(quantity), 0) AS REAL) AS on_hand,
+    COUNT(*) AS entries
+FROM
+    inventory
+WHERE
+    prescription_id = ?;
+
+-- name: GetDoseInventoryUse :one
+SELECT
+    CAST(COALESCE(SUM(quantity), 0) AS REAL) AS quantity
+FROM
+    inventory
+WHERE
+    dose_id = ?;
+
+-- name: GetUpcomingDoses :many
+SELECT
+    *
+FROM
+    doses
+WHERE
+    regimen_id = ?
+    AND taken IS NULL
+    AND missed_at IS NULL
+ORDER BY
+    COALESCE(snoozed_until, time);
+
+-- name: SetLowSupplyAlerted :exec
+UPDATE prescriptions
+SET
+    low_supply_alerted_at = ?
+WHERE
+    id = ?;
+
+-- name: RearmLowSupply :exec
+UPDATE prescriptions
+SET
+    low_supply_alerted_at = NULL
+WHERE
+    prescriptions.id = ?
+    AND low_supply_alerted_at IS NOT NULL
+    AND (
+        low_supply IS NULL
+        OR (
+            SELECT
+                COALESCE(SUM(quantity), 0)
+            FROM
+                inventory
+            WHERE
+                inventory.prescription_id = prescriptions.id
+        ) > low_supply
+    );
+
+-- name: GetLowSupplyAlerts :many
+SELECT
+    prescriptions.id,
+    prescriptions.patient,
+    prescriptions.low_supply,
+    medications.name,
+    CAST(SUM(inventory.quantity) AS REAL) AS on_hand
+FROM
+    prescriptions
+    INNER JOIN medications ON prescriptions.medication_id = medications.id
+    INNER JOIN inventory ON inventory.prescription_id = prescriptions.id
+WHERE
+    prescriptions.low_supply IS NOT NULL
+    AND prescriptions.low_supply_alerted_at IS NULL
+    AND prescriptions.discontinued_at IS NULL
+GROUP BY
+    prescriptions.id
+HAVING
+    SUM(inventory.quantity) <= prescriptions.low_supply;
+
+-- name: UseRefill :execrows
+UPDATE prescriptions
+SET
+    refills_used = refills_used + 1
+WHERE
+    id = ?
+    AND refills_used < refills;
+
+-- name: CreateFill :one
+INSERT INTO
+    fills (
+        id,
+        prescription_id,
+        refill,
+        time,
+        quantity,
+        pharmacy,
+        actor
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, ?) RETURNING *;
+
+-- name: GetFills :many
+SELECT
+    *
+FROM
+    fills
+WHERE
+    prescription_id = ?
+ORDER BY
+    refill;
+
+-- name: GetLastDoseTime :one
+SELECT
+    CAST(COALESCE(MAX(time), 0) AS INTEGER) AS time
+FROM
+    doses
+WHERE
+    regimen_id = ?;
+
+-- name: CreatePatient :one
+INSERT INTO
+    patients (id, name, user_id, owner, time_zone, created_at)
+VALUES
+    (?, ?, ?, ?, ?, ?) RETURNING *;
+
+-- name: CreateUserPatient :exec
+INSERT INTO
+    patients (id, name, user_id, owner, created_at)
+VALUES
+    (
+        sqlc.arg (id),
+        '',
+        sqlc.arg (id),
+        sqlc.arg (id),
+        sqlc.arg (created_at)
+    );
+
+-- name: GetPatient :one
+SELECT
+    patients.id,
+    patients.name,
+    patients.user_id,
+    patients.owner,
+    CAST(COALESCE(users.time_zone, patients.time_zone) AS TEXT) AS time_zone
+FROM
+    patients
+    LEFT JOIN users ON users.id = patients.user_id
+WHERE
+    patients.id = ?;
+
+-- name: SetPatientTimeZone :exec
+UPDATE patients
+SET
+    time_zone = ?
+WHERE
+    id = ?;
+
+-- name: GetUserPatients :many
+SELECT
+    patients.id,
+    patients.name,
+    patients.user_id,
+    patients.owner,
+    CAST(COALESCE(users.time_zone, patients.time_zone) AS TEXT) AS time_zone,
+    CAST(COALESCE(caregivers.grant_level, 'manage') AS TEXT) AS grant_level
+FROM
+    patients
+    LEFT JOIN users ON users.id = patients.user_id
+    LEFT JOIN caregivers ON caregivers.patient_id = patients.id
+    AND caregivers.user_id = sqlc.arg (user_id)
+WHERE
+    patients.owner = sqlc.arg (user_id)
+    OR patients.user_id = sqlc.arg (user_id)
+    OR caregivers.user_id IS NOT NULL
+ORDER BY
+    caregivers.user_id IS NOT NULL,
+    patients.user_id IS NULL,
+    patients.name,
+    patients.id;
+
+-- name: GetCaregiver :one
+SELECT
+    *
+FROM
+    caregivers
+WHERE
+    patient_id = ?
+    AND user_id = ?;
+
+-- name: GetCaregivers :many
+SELECT
+    *
+FROM
+    caregivers
+WHERE
+    patient_id = ?
+ORDER BY
+    granted_at,
+    user_id;
+
+-- name: SetCaregiver :one
+INSERT INTO
+    caregivers (
+        patient_id,
+        user_id,
+        grant_level,
+        granted_by,
+        granted_at
+    )
+VALUES
+    (?, ?, ?, ?, ?) ON CONFLICT (patient_id, user_id) DO
+UPDATE
+SET
+    grant_level = excluded.grant_level,
+    granted_by = excluded.granted_by,
+    granted_at = excluded.granted_at RETURNING *;
+
+-- name: DeleteCaregiver :execrows
+DELETE FROM caregivers
+WHERE
+    patient_id = ?
+    AND user_id = ?;
+
+-- name: GetUsersByStatus :many
+SELECT
+    *
+FROM
+    users
+WHERE
+    status = ?
+ORDER BY
+    created_at,
+    id;
+
+-- name: SetUserStatus :execrows
+UPDATE users
+SET
+    status = sqlc.arg (status),
+    approved = sqlc.arg (status) = 'approved'
+WHERE
+    id = sqlc.arg (id)
+    AND status = sqlc.arg (current);
+
+-- name: CreateUserDecision :one
+INSERT INTO
+    user_decisions (id, user_id, decision, reason, actor, time)
+VALUES
+    (?, ?, ?, ?, ?, ?) RETURNING *;
+
+-- name: GetUserDecisions :many
+SELECT
+    *
+FROM
+    user_decisions
+WHERE
+    user_id = ?
+ORDER BY
+    time,
+    id;
+
+-- name: CreateInvite :one
+INSERT INTO
+    invites (
+        id,
+        code_hash,
+        created_by,
+        max_uses,
+        expires_at,
+        created_at
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?) RETURNING *;
+
+-- name: GetInvitesByCreator :many
+SELECT
+    *
+FROM
+    invites
+WHERE
+    created_by = ?
+ORDER BY
+    created_at DESC,
+    id;
+
+-- name: GetInviteByCode :one
+SELECT
+    *
+FROM
+    invites
+WHERE
+    code_hash = ?;
+
+-- name: UseInvite :execrows
+UPDATE invites
+SET
+    uses = uses + 1
+WHERE
+    id = sqlc.arg (id)
+    AND uses < max_uses
+    AND expires_at > sqlc.arg (now);
+
+-- name: CreateInviteRedemption :exec
+INSERT INTO
+    invite_redemptions (invite_id, user_id, time)
+VALUES
+    (?, ?, ?);
+
+-- name: CreateInviteFailure :exec
+INSERT INTO
+    invite_failures (id, user_id, time)
+VALUES
+    (?, ?, ?);
+
+-- name: CountInviteFailures :one
+SELECT
+    COUNT(*)
+FROM
+    invite_failures
+WHERE
+    user_id = ?
+    AND time > sqlc.arg (since);
+
+-- name: CreateAPIKey :one
+INSERT INTO
+    api_keys (id, user_id, name, key_hash, scopes, created_at)
+VALUES
+    (?, ?, ?, ?, ?, ?) RETURNING *;
+
+-- name: GetAPIKeysByUser :many
+SELECT
+    *
+FROM
+    api_keys
+WHERE
+    user_id = ?
+ORDER BY
+    created_at DESC,
+    id;
+
+-- name: GetAPIKeyByHash :one
+SELECT
+    *
+FROM
+    api_keys
+WHERE
+    key_hash = ?
+    AND revoked_at IS NULL;
+
+-- name: UseAPIKey :exec
+UPDATE api_keys
+SET
+    last_used_at = sqlc.arg (now)
+WHERE
+    id = sqlc.arg (id);
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET
+    revoked_at = sqlc.arg (now)
+WHERE
+    id = sqlc.arg (id)
+    AND user_id = sqlc.arg (user_id)
+    AND revoked_at IS NULL;
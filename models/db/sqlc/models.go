@@ -8,32 +8,143 @@ import (
 	"database/sql"
 )
 
+type ApiKey struct {
+	ID         string
+	UserID     string
+	Name       string
+	KeyHash    string
+	Scopes     string
+	LastUsedAt sql.NullInt64
+	RevokedAt  sql.NullInt64
+	CreatedAt  int64
+}
+
+type Caregiver struct {
+	PatientID  string
+	UserID     string
+	GrantLevel string
+	GrantedBy  string
+	GrantedAt  int64
+}
+
 type Dose struct {
+	ID           string
+	RegimenID    string
+	Refill       int64
+	Time         int64
+	Amount       float64
+	Unit         string
+	Taken        sql.NullBool
+	TimeTaken    sql.NullInt64
+	Phase        int64
+	AmountTaken  sql.NullFloat64
+	MissedAt     sql.NullInt64
+	SnoozedUntil sql.NullInt64
+	Snoozes      int64
+}
+
+type DoseEvent struct {
+	ID          string
+	DoseID      string
+	Event       string
+	Actor       string
+	Time        int64
+	Taken       sql.NullBool
+	TimeTaken   sql.NullInt64
+	AmountTaken sql.NullFloat64
+}
+
+type Fill struct {
+	ID             string
+	PrescriptionID string
+	Refill         int64
+	Time           int64
+	Quantity       float64
+	Pharmacy       string
+	Actor          string
+}
+
+type Inventory struct {
+	ID             string
+	PrescriptionID string
+	Kind           string
+	Quantity       float64
+	DoseID         sql.NullString
+	Note           string
+	Actor          string
+	Time           int64
+}
+
+type Invite struct {
 	ID        string
-	RegimenID string
-	Refill    int64
-	Time      int64
-	Amount    float64
-	Unit      string
-	Taken     sql.NullBool
-	TimeTaken sql.NullInt64
+	CodeHash  string
+	CreatedBy string
+	MaxUses   int64
+	Uses      int64
+	ExpiresAt int64
+	CreatedAt int64
+}
+
+type InviteFailure struct {
+	ID     string
+	UserID string
+	Time   int64
+}
+
+type InviteRedemption struct {
+	InviteID string
+	UserID   string
+	Time     int64
 }
 
 type Medication struct {
-	ID      string
-	Name    string
-	Generic bool
-	Brand   string
+	ID            string
+	Name          string
+	Generic       bool
+	Brand         string
+	Strength      string
+	NameKey       string
+	BrandKey      string
+	StrengthKey   string
+	StrengthValue sql.NullFloat64
+	StrengthUnit  string
+	Form          string
+	Route         string
+}
+
+type NotificationTarget struct {
+	ID        string
+	UserID    string
+	Channel   string
+	Address   string
+	CreatedAt int64
+}
+
+type Patient struct {
+	ID        string
+	Name      string
+	UserID    sql.NullString
+	Owner     string
+	TimeZone  string
+	CreatedAt int64
 }
 
 type Prescription struct {
-	ID             string
-	MedicationID   string
-	Schedule       []byte
-	ScheduledStart sql.NullInt64
-	Refills        int64
-	Doses          int64
-	Patient        string
+	ID                 string
+	MedicationID       string
+	Schedule           []byte
+	ScheduledStart     sql.NullInt64
+	Refills            int64
+	Doses              int64
+	Patient            string
+	DiscontinuedAt     sql.NullInt64
+	DiscontinuedReason sql.NullString
+	OnTimeTolerance    sql.NullInt64
+	MissedGrace        sql.NullInt64
+	Critical           bool
+	LowSupply          sql.NullFloat64
+	LowSupplyAlertedAt sql.NullInt64
+	RefillsUsed        int64
 }
 
 type Regimen struct {
@@ -41,9 +152,38 @@ type Regimen struct {
 	MedicationID   string
 	Patient        string
 	PrescriptionID string
+	PausedAt       sql.NullInt64
+}
+
+type Reminder struct {
+	DoseID string
+	SentAt int64
+	Count  int64
 }
 
 type User struct {
+	ID        string
+	Approved  bool
+	TimeZone  string
+	Status    string
+	CreatedAt sql.NullInt64
+}
+
+type UserDecision struct {
 	ID       string
-	Approved bool
+	UserID   string
+	Decision string
+	Reason   string
+	Actor    string
+	Time     int64
+}
+
+type UserPreference struct {
+	UserID         string
+	Channels       string
+	LeadTime       sql.NullInt64
+	Snooze         sql.NullInt64
+	QuietStart     sql.NullInt64
+	QuietEnd       sql.NullInt64
+	RefillLeadDays sql.NullInt64
 }
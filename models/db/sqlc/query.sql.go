@@ -10,11 +10,109 @@ import (
 	"database/sql"
 )
 
+const countInviteFailures = `-- name: CountInviteFailures :one
+SELECT
+    COUNT(*)
+FROM
+    invite_failures
+WHERE
+    user_id = ?
+    AND time > ?2
+`
+
+type CountInviteFailuresParams struct {
+	UserID string
+	Since  int64
+}
+
+func (q *Queries) CountInviteFailures(ctx context.Context, arg CountInviteFailuresParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countInviteFailures, arg.UserID, arg.Since)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countLoggedDoses = `-- name: CountLoggedDoses :one
+SELECT
+    count(*)
+FROM
+    doses
+WHERE
+    doses.regimen_id = ?
+    AND (
+        doses.taken IS NOT NULL
+        OR doses.missed_at IS NOT NULL
+    )
+`
+
+func (q *Queries) CountLoggedDoses(ctx context.Context, regimenID string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countLoggedDoses, regimenID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countPendingDoses = `-- name: CountPendingDoses :one
+SELECT
+    count(*)
+FROM
+    doses
+WHERE
+    doses.regimen_id = ?
+    AND doses.taken IS NULL
+`
+
+func (q *Queries) CountPendingDoses(ctx context.Context, regimenID string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPendingDoses, regimenID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAPIKey = `-- name: CreateAPIKey :one
+INSERT INTO
+    api_keys (id, user_id, name, key_hash, scopes, created_at)
+VALUES
+    (?, ?, ?, ?, ?, ?) RETURNING id, user_id, name, key_hash, scopes, last_used_at, revoked_at, created_at
+`
+
+type CreateAPIKeyParams struct {
+	ID        string
+	UserID    string
+	Name      string
+	KeyHash   string
+	Scopes    string
+	CreatedAt int64
+}
+
+func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error) {
+	row := q.db.QueryRowContext(ctx, createAPIKey,
+		arg.ID,
+		arg.UserID,
+		arg.Name,
+		arg.KeyHash,
+		arg.Scopes,
+		arg.CreatedAt,
+	)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.KeyHash,
+		&i.Scopes,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const createDose = `-- name: CreateDose :one
 INSERT INTO
-    doses (id, regimen_id, refill, time, amount, unit)
+    doses (id, regimen_id, refill, time, amount, unit, phase)
 VALUES
-    (?, ?, ?, ?, ?, ?) RETURNING id, regimen_id, refill, time, amount, unit, taken, time_taken
+    (?, ?, ?, ?, ?, ?, ?) RETURNING id, regimen_id, refill, time, amount, unit, taken, time_taken, phase, amount_taken, missed_at, snoozed_until, snoozes
 `
 
 type CreateDoseParams struct {
@@ -24,6 +122,7 @@ type CreateDoseParams struct {
 	Time      int64
 	Amount    float64
 	Unit      string
+	Phase     int64
 }
 
 func (q *Queries) CreateDose(ctx context.Context, arg CreateDoseParams) (Dose, error) {
@@ -34,6 +133,7 @@ func (q *Queries) CreateDose(ctx context.Context, arg CreateDoseParams) (Dose, e
 		arg.Time,
 		arg.Amount,
 		arg.Unit,
+		arg.Phase,
 	)
 	var i Dose
 	err := row.Scan(
@@ -45,22 +145,281 @@ func (q *Queries) CreateDose(ctx context.Context, arg CreateDoseParams) (Dose, e
 		&i.Unit,
 		&i.Taken,
 		&i.TimeTaken,
+		&i.Phase,
+		&i.AmountTaken,
+		&i.MissedAt,
+		&i.SnoozedUntil,
+		&i.Snoozes,
+	)
+	return i, err
+}
+
+const createDoseEvent = `-- name: CreateDoseEvent :one
+INSERT INTO
+    dose_events (
+        id,
+        dose_id,
+        event,
+        actor,
+        time,
+        taken,
+        time_taken,
+        amount_taken
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, dose_id, event, actor, time, taken, time_taken, amount_taken
+`
+
+type CreateDoseEventParams struct {
+	ID          string
+	DoseID      string
+	Event       string
+	Actor       string
+	Time        int64
+	Taken       sql.NullBool
+	TimeTaken   sql.NullInt64
+	AmountTaken sql.NullFloat64
+}
+
+func (q *Queries) CreateDoseEvent(ctx context.Context, arg CreateDoseEventParams) (DoseEvent, error) {
+	row := q.db.QueryRowContext(ctx, createDoseEvent,
+		arg.ID,
+		arg.DoseID,
+		arg.Event,
+		arg.Actor,
+		arg.Time,
+		arg.Taken,
+		arg.TimeTaken,
+		arg.AmountTaken,
+	)
+	var i DoseEvent
+	err := row.Scan(
+		&i.ID,
+		&i.DoseID,
+		&i.Event,
+		&i.Actor,
+		&i.Time,
+		&i.Taken,
+		&i.TimeTaken,
+		&i.AmountTaken,
+	)
+	return i, err
+}
+
+const createFill = `-- name: CreateFill :one
+INSERT INTO
+    fills (
+        id,
+        prescription_id,
+        refill,
+        time,
+        quantity,
+        pharmacy,
+        actor
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, ?) RETURNING id, prescription_id, refill, time, quantity, pharmacy, actor
+`
+
+type CreateFillParams struct {
+	ID             string
+	PrescriptionID string
+	Refill         int64
+	Time           int64
+	Quantity       float64
+	Pharmacy       string
+	Actor          string
+}
+
+func (q *Queries) CreateFill(ctx context.Context, arg CreateFillParams) (Fill, error) {
+	row := q.db.QueryRowContext(ctx, createFill,
+		arg.ID,
+		arg.PrescriptionID,
+		arg.Refill,
+		arg.Time,
+		arg.Quantity,
+		arg.Pharmacy,
+		arg.Actor,
+	)
+	var i Fill
+	err := row.Scan(
+		&i.ID,
+		&i.PrescriptionID,
+		&i.Refill,
+		&i.Time,
+		&i.Quantity,
+		&i.Pharmacy,
+		&i.Actor,
+	)
+	return i, err
+}
+
+const createInventoryEntry = `-- name: CreateInventoryEntry :one
+INSERT INTO
+    inventory (
+        id,
+        prescription_id,
+        kind,
+        quantity,
+        dose_id,
+        note,
+        actor,
+        time
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, prescription_id, kind, quantity, dose_id, note, actor, time
+`
+
+type CreateInventoryEntryParams struct {
+	ID             string
+	PrescriptionID string
+	Kind           string
+	Quantity       float64
+	DoseID         sql.NullString
+	Note           string
+	Actor          string
+	Time           int64
+}
+
+func (q *Queries) CreateInventoryEntry(ctx context.Context, arg CreateInventoryEntryParams) (Inventory, error) {
+	row := q.db.QueryRowContext(ctx, createInventoryEntry,
+		arg.ID,
+		arg.PrescriptionID,
+		arg.Kind,
+		arg.Quantity,
+		arg.DoseID,
+		arg.Note,
+		arg.Actor,
+		arg.Time,
+	)
+	var i Inventory
+	err := row.Scan(
+		&i.ID,
+		&i.PrescriptionID,
+		&i.Kind,
+		&i.Quantity,
+		&i.DoseID,
+		&i.Note,
+		&i.Actor,
+		&i.Time,
+	)
+	return i, err
+}
+
+const createInvite = `-- name: CreateInvite :one
+INSERT INTO
+    invites (
+        id,
+        code_hash,
+        created_by,
+        max_uses,
+        expires_at,
+        created_at
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?) RETURNING id, code_hash, created_by, max_uses, uses, expires_at, created_at
+`
+
+type CreateInviteParams struct {
+	ID        string
+	CodeHash  string
+	CreatedBy string
+	MaxUses   int64
+	ExpiresAt int64
+	CreatedAt int64
+}
+
+func (q *Queries) CreateInvite(ctx context.Context, arg CreateInviteParams) (Invite, error) {
+	row := q.db.QueryRowContext(ctx, createInvite,
+		arg.ID,
+		arg.CodeHash,
+		arg.CreatedBy,
+		arg.MaxUses,
+		arg.ExpiresAt,
+		arg.CreatedAt,
+	)
+	var i Invite
+	err := row.Scan(
+		&i.ID,
+		&i.CodeHash,
+		&i.CreatedBy,
+		&i.MaxUses,
+		&i.Uses,
+		&i.ExpiresAt,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
+const createInviteFailure = `-- name: CreateInviteFailure :exec
+INSERT INTO
+    invite_failures (id, user_id, time)
+VALUES
+    (?, ?, ?)
+`
+
+type CreateInviteFailureParams struct {
+	ID     string
+	UserID string
+	Time   int64
+}
+
+func (q *Queries) CreateInviteFailure(ctx context.Context, arg CreateInviteFailureParams) error {
+	_, err := q.db.ExecContext(ctx, createInviteFailure, arg.ID, arg.UserID, arg.Time)
+	return err
+}
+
+const createInviteRedemption = `-- name: CreateInviteRedemption :exec
+INSERT INTO
+    invite_redemptions (invite_id, user_id, time)
+VALUES
+    (?, ?, ?)
+`
+
+type CreateInviteRedemptionParams struct {
+	InviteID string
+	UserID   string
+	Time     int64
+}
+
+func (q *Queries) CreateInviteRedemption(ctx context.Context, arg CreateInviteRedemptionParams) error {
+	_, err := q.db.ExecContext(ctx, createInviteRedemption, arg.InviteID, arg.UserID, arg.Time)
+	return err
+}
+
 const createMedication = `-- name: CreateMedication :one
 INSERT INTO
-    medications (id, name, generic, brand)
+    medications (
+        id,
+        name,
+        generic,
+        brand,
+        strength,
+        name_key,
+        brand_key,
+        strength_key,
+        strength_value,
+        strength_unit,
+        form,
+        route
+    )
 VALUES
-    (?, ?, ?, ?) RETURNING id, name, generic, brand
+    (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, name, generic, brand, strength, name_key, brand_key, strength_key, strength_value, strength_unit, form, route
 `
 
 type CreateMedicationParams struct {
-	ID      string
-	Name    string
-	Generic bool
-	Brand   string
+	ID            string
+	Name          string
+	Generic       bool
+	Brand         string
+	Strength      string
+	NameKey       string
+	BrandKey      string
+	StrengthKey   string
+	StrengthValue sql.NullFloat64
+	StrengthUnit  string
+	Form          string
+	Route         string
 }
 
 func (q *Queries) CreateMedication(ctx context.Context, arg CreateMedicationParams) (Medication, error) {
@@ -69,6 +428,14 @@ func (q *Queries) CreateMedication(ctx context.Context, arg CreateMedicationPara
 		arg.Name,
 		arg.Generic,
 		arg.Brand,
+		arg.Strength,
+		arg.NameKey,
+		arg.BrandKey,
+		arg.StrengthKey,
+		arg.StrengthValue,
+		arg.StrengthUnit,
+		arg.Form,
+		arg.Route,
 	)
 	var i Medication
 	err := row.Scan(
@@ -76,6 +443,85 @@ func (q *Queries) CreateMedication(ctx context.Context, arg CreateMedicationPara
 		&i.Name,
 		&i.Generic,
 		&i.Brand,
+		&i.Strength,
+		&i.NameKey,
+		&i.BrandKey,
+		&i.StrengthKey,
+		&i.StrengthValue,
+		&i.StrengthUnit,
+		&i.Form,
+		&i.Route,
+	)
+	return i, err
+}
+
+const createNotificationTarget = `-- name: CreateNotificationTarget :one
+INSERT INTO
+    notification_targets (id, user_id, channel, address, created_at)
+VALUES
+    (?, ?, ?, ?, ?) RETURNING id, user_id, channel, address, created_at
+`
+
+type CreateNotificationTargetParams struct {
+	ID        string
+	UserID    string
+	Channel   string
+	Address   string
+	CreatedAt int64
+}
+
+func (q *Queries) CreateNotificationTarget(ctx context.Context, arg CreateNotificationTargetParams) (NotificationTarget, error) {
+	row := q.db.QueryRowContext(ctx, createNotificationTarget,
+		arg.ID,
+		arg.UserID,
+		arg.Channel,
+		arg.Address,
+		arg.CreatedAt,
+	)
+	var i NotificationTarget
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Channel,
+		&i.Address,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createPatient = `-- name: CreatePatient :one
+INSERT INTO
+    patients (id, name, user_id, owner, time_zone, created_at)
+VALUES
+    (?, ?, ?, ?, ?, ?) RETURNING id, name, user_id, owner, time_zone, created_at
+`
+
+type CreatePatientParams struct {
+	ID        string
+	Name      string
+	UserID    sql.NullString
+	Owner     string
+	TimeZone  string
+	CreatedAt int64
+}
+
+func (q *Queries) CreatePatient(ctx context.Context, arg CreatePatientParams) (Patient, error) {
+	row := q.db.QueryRowContext(ctx, createPatient,
+		arg.ID,
+		arg.Name,
+		arg.UserID,
+		arg.Owner,
+		arg.TimeZone,
+		arg.CreatedAt,
+	)
+	var i Patient
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.UserID,
+		&i.Owner,
+		&i.TimeZone,
+		&i.CreatedAt,
 	)
 	return i, err
 }
@@ -84,7 +530,7 @@ const createRegimen = `-- name: CreateRegimen :one
 INSERT INTO
     regimens (id, medication_id, patient, prescription_id)
 VALUES
-    (?, ?, ?, ?) RETURNING id, medication_id, patient, prescription_id
+    (?, ?, ?, ?) RETURNING id, medication_id, patient, prescription_id, paused_at
 `
 
 type CreateRegimenParams struct {
@@ -107,6 +553,7 @@ func (q *Queries) CreateRegimen(ctx context.Context, arg CreateRegimenParams) (R
 		&i.MedicationID,
 		&i.Patient,
 		&i.PrescriptionID,
+		&i.PausedAt,
 	)
 	return i, err
 }
@@ -120,20 +567,28 @@ INSERT INTO
         refills,
         doses,
         schedule,
-        patient
+        patient,
+        on_time_tolerance,
+        missed_grace,
+        critical,
+        low_supply
     )
 VALUES
-    (?, ?, ?, ?, ?, ?, ?) RETURNING id, medication_id, schedule, scheduled_start, refills, doses, patient
+    (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, medication_id, schedule, scheduled_start, refills, doses, patient, discontinued_at, discontinued_reason, on_time_tolerance, missed_grace, critical, low_supply, low_supply_alerted_at, refills_used
 `
 
 type CreateRxParams struct {
-	ID             string
-	MedicationID   string
-	ScheduledStart sql.NullInt64
-	Refills        int64
-	Doses          int64
-	Schedule       []byte
-	Patient        string
+	ID              string
+	MedicationID    string
+	ScheduledStart  sql.NullInt64
+	Refills         int64
+	Doses           int64
+	Schedule        []byte
+	Patient         string
+	OnTimeTolerance sql.NullInt64
+	MissedGrace     sql.NullInt64
+	Critical        bool
+	LowSupply       sql.NullFloat64
 }
 
 func (q *Queries) CreateRx(ctx context.Context, arg CreateRxParams) (Prescription, error) {
@@ -145,6 +600,10 @@ func (q *Queries) CreateRx(ctx context.Context, arg CreateRxParams) (Prescriptio
 		arg.Doses,
 		arg.Schedule,
 		arg.Patient,
+		arg.OnTimeTolerance,
+		arg.MissedGrace,
+		arg.Critical,
+		arg.LowSupply,
 	)
 	var i Prescription
 	err := row.Scan(
@@ -155,116 +614,1775 @@ func (q *Queries) CreateRx(ctx context.Context, arg CreateRxParams) (Prescriptio
 		&i.Refills,
 		&i.Doses,
 		&i.Patient,
+		&i.DiscontinuedAt,
+		&i.DiscontinuedReason,
+		&i.OnTimeTolerance,
+		&i.MissedGrace,
+		&i.Critical,
+		&i.LowSupply,
+		&i.LowSupplyAlertedAt,
+		&i.RefillsUsed,
+	)
+	return i, err
+}
+
+const createTakenDose = `-- name: CreateTakenDose :one
+INSERT INTO
+    doses (
+        id,
+        regimen_id,
+        refill,
+        time,
+        amount,
+        unit,
+        taken,
+        time_taken
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, true, ?) RETURNING id, regimen_id, refill, time, amount, unit, taken, time_taken, phase, amount_taken, missed_at, snoozed_until, snoozes
+`
+
+type CreateTakenDoseParams struct {
+	ID        string
+	RegimenID string
+	Refill    int64
+	Time      int64
+	Amount    float64
+	Unit      string
+	TimeTaken sql.NullInt64
+}
+
+func (q *Queries) CreateTakenDose(ctx context.Context, arg CreateTakenDoseParams) (Dose, error) {
+	row := q.db.QueryRowContext(ctx, createTakenDose,
+		arg.ID,
+		arg.RegimenID,
+		arg.Refill,
+		arg.Time,
+		arg.Amount,
+		arg.Unit,
+		arg.TimeTaken,
+	)
+	var i Dose
+	err := row.Scan(
+		&i.ID,
+		&i.RegimenID,
+		&i.Refill,
+		&i.Time,
+		&i.Amount,
+		&i.Unit,
+		&i.Taken,
+		&i.TimeTaken,
+		&i.Phase,
+		&i.AmountTaken,
+		&i.MissedAt,
+		&i.SnoozedUntil,
+		&i.Snoozes,
 	)
 	return i, err
 }
 
 const createUser = `-- name: CreateUser :one
 INSERT INTO
-    users (id, approved)
+    users (id, approved, created_at)
 VALUES
-    (?, false) RETURNING id, approved
+    (?, false, CAST(strftime('%s', 'now') AS INTEGER)) RETURNING id, approved, time_zone, status, created_at
 `
 
 func (q *Queries) CreateUser(ctx context.Context, id string) (User, error) {
 	row := q.db.QueryRowContext(ctx, createUser, id)
 	var i User
-	err := row.Scan(&i.ID, &i.Approved)
+	err := row.Scan(
+		&i.ID,
+		&i.Approved,
+		&i.TimeZone,
+		&i.Status,
+		&i.CreatedAt,
+	)
 	return i, err
 }
 
-const dosesTillEmpty = `-- name: DosesTillEmpty :one
-SELECT
-    count(*)
-FROM
-    doses
-WHERE
-    doses.regimen_id = ?
-    AND doses.taken IS NULL
+const createUserDecision = `-- name: CreateUserDecision :one
+INSERT INTO
+    user_decisions (id, user_id, decision, reason, actor, time)
+VALUES
+    (?, ?, ?, ?, ?, ?) RETURNING id, user_id, decision, reason, actor, time
 `
 
-func (q *Queries) DosesTillEmpty(ctx context.Context, regimenID string) (int64, error) {
-	row := q.db.QueryRowContext(ctx, dosesTillEmpty, regimenID)
-	var count int64
-	err := row.Scan(&count)
-	return count, err
+type CreateUserDecisionParams struct {
+	ID       string
+	UserID   string
+	Decision string
+	Reason   string
+	Actor    string
+	Time     int64
 }
 
-const dosesTillRefill = `-- name: DosesTillRefill :one
-SELECT
-    COUNT(*)
-FROM
-    doses
+func (q *Queries) CreateUserDecision(ctx context.Context, arg CreateUserDecisionParams) (UserDecision, error) {
+	row := q.db.QueryRowContext(ctx, createUserDecision,
+		arg.ID,
+		arg.UserID,
+		arg.Decision,
+		arg.Reason,
+		arg.Actor,
+		arg.Time,
+	)
+	var i UserDecision
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Decision,
+		&i.Reason,
+		&i.Actor,
+		&i.Time,
+	)
+	return i, err
+}
+
+const createUserPatient = `-- name: CreateUserPatient :exec
+INSERT INTO
+    patients (id, name, user_id, owner, created_at)
+VALUES
+    (
+        ?1,
+        '',
+        ?1,
+        ?1,
+        ?2
+    )
+`
+
+type CreateUserPatientParams struct {
+	ID        string
+	CreatedAt int64
+}
+
+func (q *Queries) CreateUserPatient(ctx context.Context, arg CreateUserPatientParams) error {
+	_, err := q.db.ExecContext(ctx, createUserPatient, arg.ID, arg.CreatedAt)
+	return err
+}
+
+const deleteCaregiver = `-- name: DeleteCaregiver :execrows
+DELETE FROM caregivers
 WHERE
-    doses.regimen_id = ?
-    AND doses.taken IS NULL
-    AND doses.refill = (
+    patient_id = ?
+    AND user_id = ?
+`
+
+type DeleteCaregiverParams struct {
+	PatientID string
+	UserID    string
+}
+
+func (q *Queries) DeleteCaregiver(ctx context.Context, arg DeleteCaregiverParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteCaregiver, arg.PatientID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteDose = `-- name: DeleteDose :exec
+DELETE FROM doses
+WHERE
+    id = ?
+`
+
+func (q *Queries) DeleteDose(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, deleteDose, id)
+	return err
+}
+
+const deleteDosesByRx = `-- name: DeleteDosesByRx :exec
+DELETE FROM doses
+WHERE
+    regimen_id IN (
+        SELECT
+            regimens.id
+        FROM
+            regimens
+        WHERE
+            regimens.prescription_id = ?
+    )
+`
+
+func (q *Queries) DeleteDosesByRx(ctx context.Context, prescriptionID string) error {
+	_, err := q.db.ExecContext(ctx, deleteDosesByRx, prescriptionID)
+	return err
+}
+
+const deleteFillsByRx = `-- name: DeleteFillsByRx :exec
+DELETE FROM fills
+WHERE
+    prescription_id = ?
+`
+
+func (q *Queries) DeleteFillsByRx(ctx context.Context, prescriptionID string) error {
+	_, err := q.db.ExecContext(ctx, deleteFillsByRx, prescriptionID)
+	return err
+}
+
+const deleteInventoryByRx = `-- name: DeleteInventoryByRx :exec
+DELETE FROM inventory
+WHERE
+    prescription_id = ?
+`
+
+func (q *Queries) DeleteInventoryByRx(ctx context.Context, prescriptionID string) error {
+	_, err := q.db.ExecContext(ctx, deleteInventoryByRx, prescriptionID)
+	return err
+}
+
+const deleteNotificationTarget = `-- name: DeleteNotificationTarget :execrows
+DELETE FROM notification_targets
+WHERE
+    id = ?
+    AND user_id = ?
+`
+
+type DeleteNotificationTargetParams struct {
+	ID     string
+	UserID string
+}
+
+func (q *Queries) DeleteNotificationTarget(ctx context.Context, arg DeleteNotificationTargetParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteNotificationTarget, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deletePendingDoses = `-- name: DeletePendingDoses :exec
+DELETE FROM doses
+WHERE
+    regimen_id = ?
+    AND taken IS NULL
+    AND missed_at IS NULL
+`
+
+func (q *Queries) DeletePendingDoses(ctx context.Context, regimenID string) error {
+	_, err := q.db.ExecContext(ctx, deletePendingDoses, regimenID)
+	return err
+}
+
+const deletePendingDosesAfter = `-- name: DeletePendingDosesAfter :exec
+DELETE FROM doses
+WHERE
+    regimen_id = ?
+    AND taken IS NULL
+    AND missed_at IS NULL
+    AND time > ?
+`
+
+type DeletePendingDosesAfterParams struct {
+	RegimenID string
+	Time      int64
+}
+
+func (q *Queries) DeletePendingDosesAfter(ctx context.Context, arg DeletePendingDosesAfterParams) error {
+	_, err := q.db.ExecContext(ctx, deletePendingDosesAfter, arg.RegimenID, arg.Time)
+	return err
+}
+
+const deletePendingReminders = `-- name: DeletePendingReminders :exec
+DELETE FROM reminders
+WHERE
+    dose_id IN (
+        SELECT
+            doses.id
+        FROM
+            doses
+        WHERE
+            doses.regimen_id = ?
+            AND doses.taken IS NULL
+            AND doses.missed_at IS NULL
+    )
+`
+
+func (q *Queries) DeletePendingReminders(ctx context.Context, regimenID string) error {
+	_, err := q.db.ExecContext(ctx, deletePendingReminders, regimenID)
+	return err
+}
+
+const deletePendingRemindersAfter = `-- name: DeletePendingRemindersAfter :exec
+DELETE FROM reminders
+WHERE
+    dose_id IN (
+        SELECT
+            doses.id
+        FROM
+            doses
+        WHERE
+            doses.regimen_id = ?
+            AND doses.taken IS NULL
+            AND doses.missed_at IS NULL
+            AND doses.time > ?
+    )
+`
+
+type DeletePendingRemindersAfterParams struct {
+	RegimenID string
+	Time      int64
+}
+
+func (q *Queries) DeletePendingRemindersAfter(ctx context.Context, arg DeletePendingRemindersAfterParams) error {
+	_, err := q.db.ExecContext(ctx, deletePendingRemindersAfter, arg.RegimenID, arg.Time)
+	return err
+}
+
+const deleteRegimensByRx = `-- name: DeleteRegimensByRx :exec
+DELETE FROM regimens
+WHERE
+    prescription_id = ?
+`
+
+func (q *Queries) DeleteRegimensByRx(ctx context.Context, prescriptionID string) error {
+	_, err := q.db.ExecContext(ctx, deleteRegimensByRx, prescriptionID)
+	return err
+}
+
+const deleteReminder = `-- name: DeleteReminder :exec
+DELETE FROM reminders
+WHERE
+    dose_id = ?
+`
+
+func (q *Queries) DeleteReminder(ctx context.Context, doseID string) error {
+	_, err := q.db.ExecContext(ctx, deleteReminder, doseID)
+	return err
+}
+
+const deleteRemindersByRx = `-- name: DeleteRemindersByRx :exec
+DELETE FROM reminders
+WHERE
+    dose_id IN (
         SELECT
-            MIN(dose_inner.refill)
+            doses.id
         FROM
-            doses AS dose_inner
+            doses
+            INNER JOIN regimens ON doses.regimen_id = regimens.id
         WHERE
-            dose_inner.regimen_id = ?
-            AND dose_inner.taken IS NULL
+            regimens.prescription_id = ?
     )
 `
 
-type DosesTillRefillParams struct {
-	RegimenID   string
-	RegimenID_2 string
+func (q *Queries) DeleteRemindersByRx(ctx context.Context, prescriptionID string) error {
+	_, err := q.db.ExecContext(ctx, deleteRemindersByRx, prescriptionID)
+	return err
+}
+
+const deleteRx = `-- name: DeleteRx :exec
+DELETE FROM prescriptions
+WHERE
+    id = ?
+`
+
+func (q *Queries) DeleteRx(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, deleteRx, id)
+	return err
+}
+
+const deleteUserPreferences = `-- name: DeleteUserPreferences :exec
+DELETE FROM user_preferences
+WHERE
+    user_id = ?
+`
+
+func (q *Queries) DeleteUserPreferences(ctx context.Context, userID string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserPreferences, userID)
+	return err
+}
+
+const discontinueRx = `-- name: DiscontinueRx :one
+UPDATE prescriptions
+SET
+    discontinued_at = ?,
+    discontinued_reason = ?
+WHERE
+    id = ? RETURNING id, medication_id, schedule, scheduled_start, refills, doses, patient, discontinued_at, discontinued_reason, on_time_tolerance, missed_grace, critical, low_supply, low_supply_alerted_at, refills_used
+`
+
+type DiscontinueRxParams struct {
+	DiscontinuedAt     sql.NullInt64
+	DiscontinuedReason sql.NullString
+	ID                 string
+}
+
+func (q *Queries) DiscontinueRx(ctx context.Context, arg DiscontinueRxParams) (Prescription, error) {
+	row := q.db.QueryRowContext(ctx, discontinueRx, arg.DiscontinuedAt, arg.DiscontinuedReason, arg.ID)
+	var i Prescription
+	err := row.Scan(
+		&i.ID,
+		&i.MedicationID,
+		&i.Schedule,
+		&i.ScheduledStart,
+		&i.Refills,
+		&i.Doses,
+		&i.Patient,
+		&i.DiscontinuedAt,
+		&i.DiscontinuedReason,
+		&i.OnTimeTolerance,
+		&i.MissedGrace,
+		&i.Critical,
+		&i.LowSupply,
+		&i.LowSupplyAlertedAt,
+		&i.RefillsUsed,
+	)
+	return i, err
+}
+
+const getAPIKeyByHash = `-- name: GetAPIKeyByHash :one
+SELECT
+    id, user_id, name, key_hash, scopes, last_used_at, revoked_at, created_at
+FROM
+    api_keys
+WHERE
+    key_hash = ?
+    AND revoked_at IS NULL
+`
+
+func (q *Queries) GetAPIKeyByHash(ctx context.Context, keyHash string) (ApiKey, error) {
+	row := q.db.QueryRowContext(ctx, getAPIKeyByHash, keyHash)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.KeyHash,
+		&i.Scopes,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getAPIKeysByUser = `-- name: GetAPIKeysByUser :many
+SELECT
+    id, user_id, name, key_hash, scopes, last_used_at, revoked_at, created_at
+FROM
+    api_keys
+WHERE
+    user_id = ?
+ORDER BY
+    created_at DESC,
+    id
+`
+
+func (q *Queries) GetAPIKeysByUser(ctx context.Context, userID string) ([]ApiKey, error) {
+	rows, err := q.db.QueryContext(ctx, getAPIKeysByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ApiKey
+	for rows.Next() {
+		var i ApiKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.KeyHash,
+			&i.Scopes,
+			&i.LastUsedAt,
+			&i.RevokedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCaregiver = `-- name: GetCaregiver :one
+SELECT
+    patient_id, user_id, grant_level, granted_by, granted_at
+FROM
+    caregivers
+WHERE
+    patient_id = ?
+    AND user_id = ?
+`
+
+type GetCaregiverParams struct {
+	PatientID string
+	UserID    string
+}
+
+func (q *Queries) GetCaregiver(ctx context.Context, arg GetCaregiverParams) (Caregiver, error) {
+	row := q.db.QueryRowContext(ctx, getCaregiver, arg.PatientID, arg.UserID)
+	var i Caregiver
+	err := row.Scan(
+		&i.PatientID,
+		&i.UserID,
+		&i.GrantLevel,
+		&i.GrantedBy,
+		&i.GrantedAt,
+	)
+	return i, err
+}
+
+const getCaregivers = `-- name: GetCaregivers :many
+SELECT
+    patient_id, user_id, grant_level, granted_by, granted_at
+FROM
+    caregivers
+WHERE
+    patient_id = ?
+ORDER BY
+    granted_at,
+    user_id
+`
+
+func (q *Queries) GetCaregivers(ctx context.Context, patientID string) ([]Caregiver, error) {
+	rows, err := q.db.QueryContext(ctx, getCaregivers, patientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Caregiver
+	for rows.Next() {
+		var i Caregiver
+		if err := rows.Scan(
+			&i.PatientID,
+			&i.UserID,
+			&i.GrantLevel,
+			&i.GrantedBy,
+			&i.GrantedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDose = `-- name: GetDose :one
+SELECT
+    id, regimen_id, refill, time, amount, unit, taken, time_taken, phase, amount_taken, missed_at, snoozed_until, snoozes
+FROM
+    doses
+WHERE
+    id = ?
+`
+
+func (q *Queries) GetDose(ctx context.Context, id string) (Dose, error) {
+	row := q.db.QueryRowContext(ctx, getDose, id)
+	var i Dose
+	err := row.Scan(
+		&i.ID,
+		&i.RegimenID,
+		&i.Refill,
+		&i.Time,
+		&i.Amount,
+		&i.Unit,
+		&i.Taken,
+		&i.TimeTaken,
+		&i.Phase,
+		&i.AmountTaken,
+		&i.MissedAt,
+		&i.SnoozedUntil,
+		&i.Snoozes,
+	)
+	return i, err
+}
+
+const getDoseByPatient = `-- name: GetDoseByPatient :one
+SELECT
+    doses.id, doses.regimen_id, doses.refill, doses.time, doses.amount, doses.unit, doses.taken, doses.time_taken, doses.phase, doses.amount_taken, doses.missed_at, doses.snoozed_until, doses.snoozes,
+    prescriptions.id AS prescription_id,
+    prescriptions.schedule
+FROM
+    doses
+    INNER JOIN regimens ON doses.regimen_id = regimens.id
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+WHERE
+    doses.id = ?1
+    AND regimens.patient = ?2
+    AND prescriptions.patient = ?2
+`
+
+type GetDoseByPatientParams struct {
+	ID      string
+	Patient string
+}
+
+type GetDoseByPatientRow struct {
+	ID             string
+	RegimenID      string
+	Refill         int64
+	Time           int64
+	Amount         float64
+	Unit           string
+	Taken          sql.NullBool
+	TimeTaken      sql.NullInt64
+	Phase          int64
+	AmountTaken    sql.NullFloat64
+	MissedAt       sql.NullInt64
+	SnoozedUntil   sql.NullInt64
+	Snoozes        int64
+	PrescriptionID string
+	Schedule       []byte
+}
+
+func (q *Queries) GetDoseByPatient(ctx context.Context, arg GetDoseByPatientParams) (GetDoseByPatientRow, error) {
+	row := q.db.QueryRowContext(ctx, getDoseByPatient, arg.ID, arg.Patient)
+	var i GetDoseByPatientRow
+	err := row.Scan(
+		&i.ID,
+		&i.RegimenID,
+		&i.Refill,
+		&i.Time,
+		&i.Amount,
+		&i.Unit,
+		&i.Taken,
+		&i.TimeTaken,
+		&i.Phase,
+		&i.AmountTaken,
+		&i.MissedAt,
+		&i.SnoozedUntil,
+		&i.Snoozes,
+		&i.PrescriptionID,
+		&i.Schedule,
+	)
+	return i, err
+}
+
+const getDoseEvents = `-- name: GetDoseEvents :many
+SELECT
+    id, dose_id, event, actor, time, taken, time_taken, amount_taken
+FROM
+    dose_events
+WHERE
+    dose_id = ?
+ORDER BY
+    time
+`
+
+func (q *Queries) GetDoseEvents(ctx context.Context, doseID string) ([]DoseEvent, error) {
+	rows, err := q.db.QueryContext(ctx, getDoseEvents, doseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DoseEvent
+	for rows.Next() {
+		var i DoseEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.DoseID,
+			&i.Event,
+			&i.Actor,
+			&i.Time,
+			&i.Taken,
+			&i.TimeTaken,
+			&i.AmountTaken,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDoseInventoryUse = `-- name: GetDoseInventoryUse :one
+SELECT
+    CAST(COALESCE(SUM(quantity), 0) AS REAL) AS quantity
+FROM
+    inventory
+WHERE
+    dose_id = ?
+`
+
+func (q *Queries) GetDoseInventoryUse(ctx context.Context, doseID sql.NullString) (float64, error) {
+	row := q.db.QueryRowContext(ctx, getDoseInventoryUse, doseID)
+	var quantity float64
+	err := row.Scan(&quantity)
+	return quantity, err
+}
+
+const getDosesByPatient = `-- name: GetDosesByPatient :many
+SELECT
+    doses.id, doses.regimen_id, doses.refill, doses.time, doses.amount, doses.unit, doses.taken, doses.time_taken, doses.phase, doses.amount_taken, doses.missed_at, doses.snoozed_until, doses.snoozes,
+    medications.id, medications.name, medications.generic, medications.brand, medications.strength, medications.name_key, medications.brand_key, medications.strength_key, medications.strength_value, medications.strength_unit, medications.form, medications.route,
+    regimens.id, regimens.medication_id, regimens.patient, regimens.prescription_id, regimens.paused_at
+FROM
+    doses
+    INNER JOIN regimens ON doses.regimen_id = regimens.id
+    INNER JOIN medications ON regimens.medication_id = medications.id
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+WHERE
+    doses.taken IS NULL
+    AND doses.missed_at IS NULL
+    AND prescriptions.discontinued_at IS NULL
+    AND regimens.paused_at IS NULL
+    AND regimens.patient = ?
+ORDER BY
+    COALESCE(doses.snoozed_until, doses.time)
+`
+
+type GetDosesByPatientRow struct {
+	ID             string
+	RegimenID      string
+	Refill         int64
+	Time           int64
+	Amount         float64
+	Unit           string
+	Taken          sql.NullBool
+	TimeTaken      sql.NullInt64
+	Phase          int64
+	AmountTaken    sql.NullFloat64
+	MissedAt       sql.NullInt64
+	SnoozedUntil   sql.NullInt64
+	Snoozes        int64
+	ID_2           string
+	Name           string
+	Generic        bool
+	Brand          string
+	Strength       string
+	NameKey        string
+	BrandKey       string
+	StrengthKey    string
+	StrengthValue  sql.NullFloat64
+	StrengthUnit   string
+	Form           string
+	Route          string
+	ID_3           string
+	MedicationID   string
+	Patient        string
+	PrescriptionID string
+	PausedAt       sql.NullInt64
+}
+
+func (q *Queries) GetDosesByPatient(ctx context.Context, patient string) ([]GetDosesByPatientRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDosesByPatient, patient)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDosesByPatientRow
+	for rows.Next() {
+		var i GetDosesByPatientRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.RegimenID,
+			&i.Refill,
+			&i.Time,
+			&i.Amount,
+			&i.Unit,
+			&i.Taken,
+			&i.TimeTaken,
+			&i.Phase,
+			&i.AmountTaken,
+			&i.MissedAt,
+			&i.SnoozedUntil,
+			&i.Snoozes,
+			&i.ID_2,
+			&i.Name,
+			&i.Generic,
+			&i.Brand,
+			&i.Strength,
+			&i.NameKey,
+			&i.BrandKey,
+			&i.StrengthKey,
+			&i.StrengthValue,
+			&i.StrengthUnit,
+			&i.Form,
+			&i.Route,
+			&i.ID_3,
+			&i.MedicationID,
+			&i.Patient,
+			&i.PrescriptionID,
+			&i.PausedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDosesByPatientLimitBy = `-- name: GetDosesByPatientLimitBy :many
+SELECT
+    doses.id, doses.regimen_id, doses.refill, doses.time, doses.amount, doses.unit, doses.taken, doses.time_taken, doses.phase, doses.amount_taken, doses.missed_at, doses.snoozed_until, doses.snoozes,
+    medications.id, medications.name, medications.generic, medications.brand, medications.strength, medications.name_key, medications.brand_key, medications.strength_key, medications.strength_value, medications.strength_unit, medications.form, medications.route,
+    regimens.id, regimens.medication_id, regimens.patient, regimens.prescription_id, regimens.paused_at
+FROM
+    doses
+    INNER JOIN regimens ON doses.regimen_id = regimens.id
+    INNER JOIN medications ON regimens.medication_id = medications.id
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+WHERE
+    doses.taken IS NULL
+    AND doses.missed_at IS NULL
+    AND prescriptions.discontinued_at IS NULL
+    AND regimens.paused_at IS NULL
+    AND regimens.patient = ?
+ORDER BY
+    COALESCE(doses.snoozed_until, doses.time)
+LIMIT
+    ?
+`
+
+type GetDosesByPatientLimitByParams struct {
+	Patient string
+	Limit   int64
+}
+
+type GetDosesByPatientLimitByRow struct {
+	ID             string
+	RegimenID      string
+	Refill         int64
+	Time           int64
+	Amount         float64
+	Unit           string
+	Taken          sql.NullBool
+	TimeTaken      sql.NullInt64
+	Phase          int64
+	AmountTaken    sql.NullFloat64
+	MissedAt       sql.NullInt64
+	SnoozedUntil   sql.NullInt64
+	Snoozes        int64
+	ID_2           string
+	Name           string
+	Generic        bool
+	Brand          string
+	Strength       string
+	NameKey        string
+	BrandKey       string
+	StrengthKey    string
+	StrengthValue  sql.NullFloat64
+	StrengthUnit   string
+	Form           string
+	Route          string
+	ID_3           string
+	MedicationID   string
+	Patient        string
+	PrescriptionID string
+	PausedAt       sql.NullInt64
+}
+
+func (q *Queries) GetDosesByPatientLimitBy(ctx context.Context, arg GetDosesByPatientLimitByParams) ([]GetDosesByPatientLimitByRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDosesByPatientLimitBy, arg.Patient, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDosesByPatientLimitByRow
+	for rows.Next() {
+		var i GetDosesByPatientLimitByRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.RegimenID,
+			&i.Refill,
+			&i.Time,
+			&i.Amount,
+			&i.Unit,
+			&i.Taken,
+			&i.TimeTaken,
+			&i.Phase,
+			&i.AmountTaken,
+			&i.MissedAt,
+			&i.SnoozedUntil,
+			&i.Snoozes,
+			&i.ID_2,
+			&i.Name,
+			&i.Generic,
+			&i.Brand,
+			&i.Strength,
+			&i.NameKey,
+			&i.BrandKey,
+			&i.StrengthKey,
+			&i.StrengthValue,
+			&i.StrengthUnit,
+			&i.Form,
+			&i.Route,
+			&i.ID_3,
+			&i.MedicationID,
+			&i.Patient,
+			&i.PrescriptionID,
+			&i.PausedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDosesInRange = `-- name: GetDosesInRange :many
+SELECT
+    doses.id, doses.regimen_id, doses.refill, doses.time, doses.amount, doses.unit, doses.taken, doses.time_taken, doses.phase, doses.amount_taken, doses.missed_at, doses.snoozed_until, doses.snoozes,
+    prescriptions.id AS prescription_id,
+    prescriptions.schedule,
+    prescriptions.on_time_tolerance,
+    medications.id, medications.name, medications.generic, medications.brand, medications.strength, medications.name_key, medications.brand_key, medications.strength_key, medications.strength_value, medications.strength_unit, medications.form, medications.route
+FROM
+    doses
+    INNER JOIN regimens ON doses.regimen_id = regimens.id
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+    INNER JOIN medications ON regimens.medication_id = medications.id
+WHERE
+    regimens.patient = ?1
+    AND prescriptions.patient = ?1
+    AND doses.time >= ?2
+    AND doses.time < ?3
+    AND (
+        ?4 IS NULL
+        OR prescriptions.id = ?4
+    )
+ORDER BY
+    doses.time
+`
+
+type GetDosesInRangeParams struct {
+	Patient        string
+	Since          int64
+	Until          int64
+	PrescriptionID interface{}
+}
+
+type GetDosesInRangeRow struct {
+	ID              string
+	RegimenID       string
+	Refill          int64
+	Time            int64
+	Amount          float64
+	Unit            string
+	Taken           sql.NullBool
+	TimeTaken       sql.NullInt64
+	Phase           int64
+	AmountTaken     sql.NullFloat64
+	MissedAt        sql.NullInt64
+	SnoozedUntil    sql.NullInt64
+	Snoozes         int64
+	PrescriptionID  string
+	Schedule        []byte
+	OnTimeTolerance sql.NullInt64
+	ID_2            string
+	Name            string
+	Generic         bool
+	Brand           string
+	Strength        string
+	NameKey         string
+	BrandKey        string
+	StrengthKey     string
+	StrengthValue   sql.NullFloat64
+	StrengthUnit    string
+	Form            string
+	Route           string
+}
+
+func (q *Queries) GetDosesInRange(ctx context.Context, arg GetDosesInRangeParams) ([]GetDosesInRangeRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDosesInRange,
+		arg.Patient,
+		arg.Since,
+		arg.Until,
+		arg.PrescriptionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDosesInRangeRow
+	for rows.Next() {
+		var i GetDosesInRangeRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.RegimenID,
+			&i.Refill,
+			&i.Time,
+			&i.Amount,
+			&i.Unit,
+			&i.Taken,
+			&i.TimeTaken,
+			&i.Phase,
+			&i.AmountTaken,
+			&i.MissedAt,
+			&i.SnoozedUntil,
+			&i.Snoozes,
+			&i.PrescriptionID,
+			&i.Schedule,
+			&i.OnTimeTolerance,
+			&i.ID_2,
+			&i.Name,
+			&i.Generic,
+			&i.Brand,
+			&i.Strength,
+			&i.NameKey,
+			&i.BrandKey,
+			&i.StrengthKey,
+			&i.StrengthValue,
+			&i.StrengthUnit,
+			&i.Form,
+			&i.Route,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDueReminders = `-- name: GetDueReminders :many
+SELECT
+    doses.id,
+    doses.time,
+    doses.snoozed_until,
+    doses.amount,
+    doses.unit,
+    regimens.patient,
+    regimens.prescription_id,
+    prescriptions.critical,
+    medications.name,
+    reminders.sent_at,
+    reminders.count
+FROM
+    doses
+    INNER JOIN regimens ON doses.regimen_id = regimens.id
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+    INNER JOIN medications ON regimens.medication_id = medications.id
+    LEFT JOIN reminders ON reminders.dose_id = doses.id
+WHERE
+    doses.taken IS NULL
+    AND doses.missed_at IS NULL
+    AND prescriptions.discontinued_at IS NULL
+    AND regimens.paused_at IS NULL
+    AND COALESCE(doses.snoozed_until, doses.time) >= ?1
+    AND COALESCE(doses.snoozed_until, doses.time) <= ?2
+    AND (
+        reminders.dose_id IS NULL
+        OR reminders.sent_at <= ?3
+        AND reminders.count < ?4
+    )
+ORDER BY
+    COALESCE(doses.snoozed_until, doses.time)
+`
+
+type GetDueRemindersParams struct {
+	Since          sql.NullInt64
+	Until          sql.NullInt64
+	RenotifyBefore int64
+	MaxCount       int64
+}
+
+type GetDueRemindersRow struct {
+	ID             string
+	Time           int64
+	SnoozedUntil   sql.NullInt64
+	Amount         float64
+	Unit           string
+	Patient        string
+	PrescriptionID string
+	Critical       bool
+	Name           string
+	SentAt         sql.NullInt64
+	Count          sql.NullInt64
+}
+
+func (q *Queries) GetDueReminders(ctx context.Context, arg GetDueRemindersParams) ([]GetDueRemindersRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDueReminders,
+		arg.Since,
+		arg.Until,
+		arg.RenotifyBefore,
+		arg.MaxCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDueRemindersRow
+	for rows.Next() {
+		var i GetDueRemindersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Time,
+			&i.SnoozedUntil,
+			&i.Amount,
+			&i.Unit,
+			&i.Patient,
+			&i.PrescriptionID,
+			&i.Critical,
+			&i.Name,
+			&i.SentAt,
+			&i.Count,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFills = `-- name: GetFills :many
+SELECT
+    id, prescription_id, refill, time, quantity, pharmacy, actor
+FROM
+    fills
+WHERE
+    prescription_id = ?
+ORDER BY
+    refill
+`
+
+func (q *Queries) GetFills(ctx context.Context, prescriptionID string) ([]Fill, error) {
+	rows, err := q.db.QueryContext(ctx, getFills, prescriptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Fill
+	for rows.Next() {
+		var i Fill
+		if err := rows.Scan(
+			&i.ID,
+			&i.PrescriptionID,
+			&i.Refill,
+			&i.Time,
+			&i.Quantity,
+			&i.Pharmacy,
+			&i.Actor,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getInventory = `-- name: GetInventory :many
+SELECT
+    id, prescription_id, kind, quantity, dose_id, note, actor, time
+FROM
+    inventory
+WHERE
+    prescription_id = ?
+ORDER BY
+    time,
+    rowid
+`
+
+func (q *Queries) GetInventory(ctx context.Context, prescriptionID string) ([]Inventory, error) {
+	rows, err := q.db.QueryContext(ctx, getInventory, prescriptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Inventory
+	for rows.Next() {
+		var i Inventory
+		if err := rows.Scan(
+			&i.ID,
+			&i.PrescriptionID,
+			&i.Kind,
+			&i.Quantity,
+			&i.DoseID,
+			&i.Note,
+			&i.Actor,
+			&i.Time,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getInviteByCode = `-- name: GetInviteByCode :one
+SELECT
+    id, code_hash, created_by, max_uses, uses, expires_at, created_at
+FROM
+    invites
+WHERE
+    code_hash = ?
+`
+
+func (q *Queries) GetInviteByCode(ctx context.Context, codeHash string) (Invite, error) {
+	row := q.db.QueryRowContext(ctx, getInviteByCode, codeHash)
+	var i Invite
+	err := row.Scan(
+		&i.ID,
+		&i.CodeHash,
+		&i.CreatedBy,
+		&i.MaxUses,
+		&i.Uses,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getInvitesByCreator = `-- name: GetInvitesByCreator :many
+SELECT
+    id, code_hash, created_by, max_uses, uses, expires_at, created_at
+FROM
+    invites
+WHERE
+    created_by = ?
+ORDER BY
+    created_at DESC,
+    id
+`
+
+func (q *Queries) GetInvitesByCreator(ctx context.Context, createdBy string) ([]Invite, error) {
+	rows, err := q.db.QueryContext(ctx, getInvitesByCreator, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Invite
+	for rows.Next() {
+		var i Invite
+		if err := rows.Scan(
+			&i.ID,
+			&i.CodeHash,
+			&i.CreatedBy,
+			&i.MaxUses,
+			&i.Uses,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLastDoseTime = `-- name: GetLastDoseTime :one
+SELECT
+    CAST(COALESCE(MAX(time), 0) AS INTEGER) AS time
+FROM
+    doses
+WHERE
+    regimen_id = ?
+`
+
+func (q *Queries) GetLastDoseTime(ctx context.Context, regimenID string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getLastDoseTime, regimenID)
+	var time int64
+	err := row.Scan(&time)
+	return time, err
+}
+
+const getLowSupplyAlerts = `-- name: GetLowSupplyAlerts :many
+SELECT
+    prescriptions.id,
+    prescriptions.patient,
+    prescriptions.low_supply,
+    medications.name,
+    CAST(SUM(inventory.quantity) AS REAL) AS on_hand
+FROM
+    prescriptions
+    INNER JOIN medications ON prescriptions.medication_id = medications.id
+    INNER JOIN inventory ON inventory.prescription_id = prescriptions.id
+WHERE
+    prescriptions.low_supply IS NOT NULL
+    AND prescriptions.low_supply_alerted_at IS NULL
+    AND prescriptions.discontinued_at IS NULL
+GROUP BY
+    prescriptions.id
+HAVING
+    SUM(inventory.quantity) <= prescriptions.low_supply
+`
+
+type GetLowSupplyAlertsRow struct {
+	ID        string
+	Patient   string
+	LowSupply sql.NullFloat64
+	Name      string
+	OnHand    float64
+}
+
+func (q *Queries) GetLowSupplyAlerts(ctx context.Context) ([]GetLowSupplyAlertsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getLowSupplyAlerts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetLowSupplyAlertsRow
+	for rows.Next() {
+		var i GetLowSupplyAlertsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Patient,
+			&i.LowSupply,
+			&i.Name,
+			&i.OnHand,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMedication = `-- name: GetMedication :one
+SELECT
+    id, name, generic, brand, strength, name_key, brand_key, strength_key, strength_value, strength_unit, form, route
+FROM
+    medications
+WHERE
+    id = ?
+`
+
+func (q *Queries) GetMedication(ctx context.Context, id string) (Medication, error) {
+	row := q.db.QueryRowContext(ctx, getMedication, id)
+	var i Medication
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Generic,
+		&i.Brand,
+		&i.Strength,
+		&i.NameKey,
+		&i.BrandKey,
+		&i.StrengthKey,
+		&i.StrengthValue,
+		&i.StrengthUnit,
+		&i.Form,
+		&i.Route,
+	)
+	return i, err
+}
+
+const getMedicationByKey = `-- name: GetMedicationByKey :one
+SELECT
+    id, name, generic, brand, strength, name_key, brand_key, strength_key, strength_value, strength_unit, form, route
+FROM
+    medications
+WHERE
+    name_key = ?
+    AND brand_key = ?
+    AND strength_key = ?
+    AND form = ?
+`
+
+type GetMedicationByKeyParams struct {
+	NameKey     string
+	BrandKey    string
+	StrengthKey string
+	Form        string
+}
+
+func (q *Queries) GetMedicationByKey(ctx context.Context, arg GetMedicationByKeyParams) (Medication, error) {
+	row := q.db.QueryRowContext(ctx, getMedicationByKey,
+		arg.NameKey,
+		arg.BrandKey,
+		arg.StrengthKey,
+		arg.Form,
+	)
+	var i Medication
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Generic,
+		&i.Brand,
+		&i.Strength,
+		&i.NameKey,
+		&i.BrandKey,
+		&i.StrengthKey,
+		&i.StrengthValue,
+		&i.StrengthUnit,
+		&i.Form,
+		&i.Route,
+	)
+	return i, err
+}
+
+const getNextPendingDose = `-- name: GetNextPendingDose :one
+SELECT
+    id, regimen_id, refill, time, amount, unit, taken, time_taken, phase, amount_taken, missed_at, snoozed_until, snoozes
+FROM
+    doses
+WHERE
+    regimen_id = ?
+    AND taken IS NULL
+    AND missed_at IS NULL
+ORDER BY
+    time
+LIMIT
+    1
+`
+
+func (q *Queries) GetNextPendingDose(ctx context.Context, regimenID string) (Dose, error) {
+	row := q.db.QueryRowContext(ctx, getNextPendingDose, regimenID)
+	var i Dose
+	err := row.Scan(
+		&i.ID,
+		&i.RegimenID,
+		&i.Refill,
+		&i.Time,
+		&i.Amount,
+		&i.Unit,
+		&i.Taken,
+		&i.TimeTaken,
+		&i.Phase,
+		&i.AmountTaken,
+		&i.MissedAt,
+		&i.SnoozedUntil,
+		&i.Snoozes,
+	)
+	return i, err
+}
+
+const getNotificationTargets = `-- name: GetNotificationTargets :many
+SELECT
+    id, user_id, channel, address, created_at
+FROM
+    notification_targets
+WHERE
+    user_id = ?
+ORDER BY
+    created_at
+`
+
+func (q *Queries) GetNotificationTargets(ctx context.Context, userID string) ([]NotificationTarget, error) {
+	rows, err := q.db.QueryContext(ctx, getNotificationTargets, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []NotificationTarget
+	for rows.Next() {
+		var i NotificationTarget
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Channel,
+			&i.Address,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOnHand = `-- name: GetOnHand :one
+SELECT
+    CAST(COALESCE(SUM(quantity), 0) AS REAL) AS on_hand,
+    COUNT(*) AS entries
+FROM
+    inventory
+WHERE
+    prescription_id = ?
+`
+
+type GetOnHandRow struct {
+	OnHand  float64
+	Entries int64
+}
+
+func (q *Queries) GetOnHand(ctx context.Context, prescriptionID string) (GetOnHandRow, error) {
+	row := q.db.QueryRowContext(ctx, getOnHand, prescriptionID)
+	var i GetOnHandRow
+	err := row.Scan(&i.OnHand, &i.Entries)
+	return i, err
+}
+
+const getPatient = `-- name: GetPatient :one
+SELECT
+    patients.id,
+    patients.name,
+    patients.user_id,
+    patients.owner,
+    CAST(COALESCE(users.time_zone, patients.time_zone) AS TEXT) AS time_zone
+FROM
+    patients
+    LEFT JOIN users ON users.id = patients.user_id
+WHERE
+    patients.id = ?
+`
+
+type GetPatientRow struct {
+	ID       string
+	Name     string
+	UserID   sql.NullString
+	Owner    string
+	TimeZone string
+}
+
+func (q *Queries) GetPatient(ctx context.Context, id string) (GetPatientRow, error) {
+	row := q.db.QueryRowContext(ctx, getPatient, id)
+	var i GetPatientRow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.UserID,
+		&i.Owner,
+		&i.TimeZone,
+	)
+	return i, err
+}
+
+const getPendingDosesByPatient = `-- name: GetPendingDosesByPatient :many
+SELECT
+    doses.id,
+    doses.time,
+    prescriptions.schedule
+FROM
+    doses
+    INNER JOIN regimens ON doses.regimen_id = regimens.id
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+WHERE
+    doses.taken IS NULL
+    AND doses.missed_at IS NULL
+    AND regimens.patient = ?
+`
+
+type GetPendingDosesByPatientRow struct {
+	ID       string
+	Time     int64
+	Schedule []byte
+}
+
+func (q *Queries) GetPendingDosesByPatient(ctx context.Context, patient string) ([]GetPendingDosesByPatientRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPendingDosesByPatient, patient)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPendingDosesByPatientRow
+	for rows.Next() {
+		var i GetPendingDosesByPatientRow
+		if err := rows.Scan(&i.ID, &i.Time, &i.Schedule); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRegimenByPatient = `-- name: GetRegimenByPatient :one
+SELECT
+    regimens.id, regimens.medication_id, regimens.patient, regimens.prescription_id, regimens.paused_at
+FROM
+    regimens
+    INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+WHERE
+    regimens.id = ?1
+    AND regimens.patient = ?2
+    AND prescriptions.patient = ?2
+`
+
+type GetRegimenByPatientParams struct {
+	ID      string
+	Patient string
+}
+
+func (q *Queries) GetRegimenByPatient(ctx context.Context, arg GetRegimenByPatientParams) (Regimen, error) {
+	row := q.db.QueryRowContext(ctx, getRegimenByPatient, arg.ID, arg.Patient)
+	var i Regimen
+	err := row.Scan(
+		&i.ID,
+		&i.MedicationID,
+		&i.Patient,
+		&i.PrescriptionID,
+		&i.PausedAt,
+	)
+	return i, err
+}
+
+const getRegimenByRx = `-- name: GetRegimenByRx :one
+SELECT
+    id, medication_id, patient, prescription_id, paused_at
+FROM
+    regimens
+WHERE
+    prescription_id = ?
+`
+
+func (q *Queries) GetRegimenByRx(ctx context.Context, prescriptionID string) (Regimen, error) {
+	row := q.db.QueryRowContext(ctx, getRegimenByRx, prescriptionID)
+	var i Regimen
+	err := row.Scan(
+		&i.ID,
+		&i.MedicationID,
+		&i.Patient,
+		&i.PrescriptionID,
+		&i.PausedAt,
+	)
+	return i, err
+}
+
+const getRx = `-- name: GetRx :one
+SELECT
+    id, medication_id, schedule, scheduled_start, refills, doses, patient, discontinued_at, discontinued_reason, on_time_tolerance, missed_grace, critical, low_supply, low_supply_alerted_at, refills_used
+FROM
+    prescriptions
+WHERE
+    id = ?
+`
+
+func (q *Queries) GetRx(ctx context.Context, id string) (Prescription, error) {
+	row := q.db.QueryRowContext(ctx, getRx, id)
+	var i Prescription
+	err := row.Scan(
+		&i.ID,
+		&i.MedicationID,
+		&i.Schedule,
+		&i.ScheduledStart,
+		&i.Refills,
+		&i.Doses,
+		&i.Patient,
+		&i.DiscontinuedAt,
+		&i.DiscontinuedReason,
+		&i.OnTimeTolerance,
+		&i.MissedGrace,
+		&i.Critical,
+		&i.LowSupply,
+		&i.LowSupplyAlertedAt,
+		&i.RefillsUsed,
+	)
+	return i, err
+}
+
+const getRxByPatient = `-- name: GetRxByPatient :one
+SELECT
+    id, medication_id, schedule, scheduled_start, refills, doses, patient, discontinued_at, discontinued_reason, on_time_tolerance, missed_grace, critical, low_supply, low_supply_alerted_at, refills_used
+FROM
+    prescriptions
+WHERE
+    id = ?
+    AND patient = ?
+`
+
+type GetRxByPatientParams struct {
+	ID      string
+	Patient string
 }
 
-func (q *Queries) DosesTillRefill(ctx context.Context, arg DosesTillRefillParams) (int64, error) {
-	row := q.db.QueryRowContext(ctx, dosesTillRefill, arg.RegimenID, arg.RegimenID_2)
-	var count int64
-	err := row.Scan(&count)
-	return count, err
+func (q *Queries) GetRxByPatient(ctx context.Context, arg GetRxByPatientParams) (Prescription, error) {
+	row := q.db.QueryRowContext(ctx, getRxByPatient, arg.ID, arg.Patient)
+	var i Prescription
+	err := row.Scan(
+		&i.ID,
+		&i.MedicationID,
+		&i.Schedule,
+		&i.ScheduledStart,
+		&i.Refills,
+		&i.Doses,
+		&i.Patient,
+		&i.DiscontinuedAt,
+		&i.DiscontinuedReason,
+		&i.OnTimeTolerance,
+		&i.MissedGrace,
+		&i.Critical,
+		&i.LowSupply,
+		&i.LowSupplyAlertedAt,
+		&i.RefillsUsed,
+	)
+	return i, err
 }
 
-const getDosesByPatient = `-- name: GetDosesByPatient :many
+const getTakenDosesSince = `-- name: GetTakenDosesSince :many
 SELECT
-    doses.id, doses.regimen_id, doses.refill, doses.time, doses.amount, doses.unit, doses.taken, doses.time_taken,
-    medications.id, medications.name, medications.generic, medications.brand,
-    regimens.id, regimens.medication_id, regimens.patient, regimens.prescription_id
+    id, regimen_id, refill, time, amount, unit, taken, time_taken, phase, amount_taken, missed_at, snoozed_until, snoozes
 FROM
     doses
-    INNER JOIN regimens ON doses.regimen_id = regimens.id
-    INNER JOIN medications ON regimens.medication_id = medications.id
 WHERE
-    doses.taken IS NULL
-    AND regimens.patient = ?
+    regimen_id = ?
+    AND taken = true
+    AND time_taken >= ?
 ORDER BY
-    doses.Time
+    time_taken
 `
 
-type GetDosesByPatientRow struct {
-	ID             string
-	RegimenID      string
-	Refill         int64
-	Time           int64
-	Amount         float64
-	Unit           string
-	Taken          sql.NullBool
-	TimeTaken      sql.NullInt64
-	ID_2           string
-	Name           string
-	Generic        bool
-	Brand          string
-	ID_3           string
-	MedicationID   string
-	Patient        string
-	PrescriptionID string
+type GetTakenDosesSinceParams struct {
+	RegimenID string
+	TimeTaken sql.NullInt64
 }
 
-func (q *Queries) GetDosesByPatient(ctx context.Context, patient string) ([]GetDosesByPatientRow, error) {
-	rows, err := q.db.QueryContext(ctx, getDosesByPatient, patient)
+func (q *Queries) GetTakenDosesSince(ctx context.Context, arg GetTakenDosesSinceParams) ([]Dose, error) {
+	rows, err := q.db.QueryContext(ctx, getTakenDosesSince, arg.RegimenID, arg.TimeTaken)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetDosesByPatientRow
+	var items []Dose
 	for rows.Next() {
-		var i GetDosesByPatientRow
+		var i Dose
 		if err := rows.Scan(
 			&i.ID,
 			&i.RegimenID,
@@ -274,14 +2392,253 @@ func (q *Queries) GetDosesByPatient(ctx context.Context, patient string) ([]GetD
 			&i.Unit,
 			&i.Taken,
 			&i.TimeTaken,
-			&i.ID_2,
+			&i.Phase,
+			&i.AmountTaken,
+			&i.MissedAt,
+			&i.SnoozedUntil,
+			&i.Snoozes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUpcomingDoses = `-- name: GetUpcomingDoses :many
+SELECT
+    id, regimen_id, refill, time, amount, unit, taken, time_taken, phase, amount_taken, missed_at, snoozed_until, snoozes
+FROM
+    doses
+WHERE
+    regimen_id = ?
+    AND taken IS NULL
+    AND missed_at IS NULL
+ORDER BY
+    COALESCE(snoozed_until, time)
+`
+
+func (q *Queries) GetUpcomingDoses(ctx context.Context, regimenID string) ([]Dose, error) {
+	rows, err := q.db.QueryContext(ctx, getUpcomingDoses, regimenID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Dose
+	for rows.Next() {
+		var i Dose
+		if err := rows.Scan(
+			&i.ID,
+			&i.RegimenID,
+			&i.Refill,
+			&i.Time,
+			&i.Amount,
+			&i.Unit,
+			&i.Taken,
+			&i.TimeTaken,
+			&i.Phase,
+			&i.AmountTaken,
+			&i.MissedAt,
+			&i.SnoozedUntil,
+			&i.Snoozes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUser = `-- name: GetUser :one
+SELECT
+    id, approved, time_zone, status, created_at
+FROM
+    users
+WHERE
+    id = ?
+`
+
+func (q *Queries) GetUser(ctx context.Context, id string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Approved,
+		&i.TimeZone,
+		&i.Status,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUserDecisions = `-- name: GetUserDecisions :many
+SELECT
+    id, user_id, decision, reason, actor, time
+FROM
+    user_decisions
+WHERE
+    user_id = ?
+ORDER BY
+    time,
+    id
+`
+
+func (q *Queries) GetUserDecisions(ctx context.Context, userID string) ([]UserDecision, error) {
+	rows, err := q.db.QueryContext(ctx, getUserDecisions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserDecision
+	for rows.Next() {
+		var i UserDecision
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Decision,
+			&i.Reason,
+			&i.Actor,
+			&i.Time,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserPatients = `-- name: GetUserPatients :many
+SELECT
+    patients.id,
+    patients.name,
+    patients.user_id,
+    patients.owner,
+    CAST(COALESCE(users.time_zone, patients.time_zone) AS TEXT) AS time_zone,
+    CAST(COALESCE(caregivers.grant_level, 'manage') AS TEXT) AS grant_level
+FROM
+    patients
+    LEFT JOIN users ON users.id = patients.user_id
+    LEFT JOIN caregivers ON caregivers.patient_id = patients.id
+    AND caregivers.user_id = ?1
+WHERE
+    patients.owner = ?1
+    OR patients.user_id = ?1
+    OR caregivers.user_id IS NOT NULL
+ORDER BY
+    caregivers.user_id IS NOT NULL,
+    patients.user_id IS NULL,
+    patients.name,
+    patients.id
+`
+
+type GetUserPatientsRow struct {
+	ID         string
+	Name       string
+	UserID     sql.NullString
+	Owner      string
+	TimeZone   string
+	GrantLevel string
+}
+
+func (q *Queries) GetUserPatients(ctx context.Context, userID string) ([]GetUserPatientsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserPatients, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserPatientsRow
+	for rows.Next() {
+		var i GetUserPatientsRow
+		if err := rows.Scan(
+			&i.ID,
 			&i.Name,
-			&i.Generic,
-			&i.Brand,
-			&i.ID_3,
-			&i.MedicationID,
-			&i.Patient,
-			&i.PrescriptionID,
+			&i.UserID,
+			&i.Owner,
+			&i.TimeZone,
+			&i.GrantLevel,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserPreferences = `-- name: GetUserPreferences :one
+SELECT
+    user_id, channels, lead_time, snooze, quiet_start, quiet_end, refill_lead_days
+FROM
+    user_preferences
+WHERE
+    user_id = ?
+`
+
+func (q *Queries) GetUserPreferences(ctx context.Context, userID string) (UserPreference, error) {
+	row := q.db.QueryRowContext(ctx, getUserPreferences, userID)
+	var i UserPreference
+	err := row.Scan(
+		&i.UserID,
+		&i.Channels,
+		&i.LeadTime,
+		&i.Snooze,
+		&i.QuietStart,
+		&i.QuietEnd,
+		&i.RefillLeadDays,
+	)
+	return i, err
+}
+
+const getUsersByStatus = `-- name: GetUsersByStatus :many
+SELECT
+    id, approved, time_zone, status, created_at
+FROM
+    users
+WHERE
+    status = ?
+ORDER BY
+    created_at,
+    id
+`
+
+func (q *Queries) GetUsersByStatus(ctx context.Context, status string) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByStatus, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Approved,
+			&i.TimeZone,
+			&i.Status,
+			&i.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -293,77 +2650,216 @@ func (q *Queries) GetDosesByPatient(ctx context.Context, patient string) ([]GetD
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return items, nil
+	return items, nil
+}
+
+const markDoseTaken = `-- name: MarkDoseTaken :execrows
+UPDATE doses
+SET
+    taken = ?,
+    time_taken = ?,
+    missed_at = NULL
+WHERE
+    id = ?
+    AND taken IS NULL
+`
+
+type MarkDoseTakenParams struct {
+	Taken     sql.NullBool
+	TimeTaken sql.NullInt64
+	ID        string
+}
+
+func (q *Queries) MarkDoseTaken(ctx context.Context, arg MarkDoseTakenParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markDoseTaken, arg.Taken, arg.TimeTaken, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markOverdueDosesMissed = `-- name: MarkOverdueDosesMissed :execrows
+UPDATE doses
+SET
+    missed_at = ?1
+WHERE
+    taken IS NULL
+    AND missed_at IS NULL
+    AND id IN (
+        SELECT
+            doses.id
+        FROM
+            doses
+            INNER JOIN regimens ON doses.regimen_id = regimens.id
+            INNER JOIN prescriptions ON regimens.prescription_id = prescriptions.id
+        WHERE
+            prescriptions.discontinued_at IS NULL
+            AND regimens.paused_at IS NULL
+            AND COALESCE(doses.snoozed_until, doses.time) + COALESCE(
+                prescriptions.missed_grace,
+                ?2
+            ) < ?1
+    )
+`
+
+type MarkOverdueDosesMissedParams struct {
+	Now          sql.NullInt64
+	DefaultGrace sql.NullInt64
+}
+
+func (q *Queries) MarkOverdueDosesMissed(ctx context.Context, arg MarkOverdueDosesMissedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markOverdueDosesMissed, arg.Now, arg.DefaultGrace)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const pauseRegimen = `-- name: PauseRegimen :exec
+UPDATE regimens
+SET
+    paused_at = ?
+WHERE
+    id = ?
+`
+
+type PauseRegimenParams struct {
+	PausedAt sql.NullInt64
+	ID       string
+}
+
+func (q *Queries) PauseRegimen(ctx context.Context, arg PauseRegimenParams) error {
+	_, err := q.db.ExecContext(ctx, pauseRegimen, arg.PausedAt, arg.ID)
+	return err
+}
+
+const rearmLowSupply = `-- name: RearmLowSupply :exec
+UPDATE prescriptions
+SET
+    low_supply_alerted_at = NULL
+WHERE
+    prescriptions.id = ?
+    AND low_supply_alerted_at IS NOT NULL
+    AND (
+        low_supply IS NULL
+        OR (
+            SELECT
+                COALESCE(SUM(quantity), 0)
+            FROM
+                inventory
+            WHERE
+                inventory.prescription_id = prescriptions.id
+        ) > low_supply
+    )
+`
+
+func (q *Queries) RearmLowSupply(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, rearmLowSupply, id)
+	return err
+}
+
+const recordReminder = `-- name: RecordReminder :exec
+INSERT INTO
+    reminders (dose_id, sent_at, count)
+VALUES
+    (?, ?, 1) ON CONFLICT (dose_id) DO
+UPDATE
+SET
+    sent_at = excluded.sent_at,
+    count = reminders.count + 1
+`
+
+type RecordReminderParams struct {
+	DoseID string
+	SentAt int64
+}
+
+func (q *Queries) RecordReminder(ctx context.Context, arg RecordReminderParams) error {
+	_, err := q.db.ExecContext(ctx, recordReminder, arg.DoseID, arg.SentAt)
+	return err
+}
+
+const resumeRegimen = `-- name: ResumeRegimen :exec
+UPDATE regimens
+SET
+    paused_at = NULL
+WHERE
+    id = ?
+`
+
+func (q *Queries) ResumeRegimen(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, resumeRegimen, id)
+	return err
+}
+
+const revokeAPIKey = `-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET
+    revoked_at = ?1
+WHERE
+    id = ?2
+    AND user_id = ?3
+    AND revoked_at IS NULL
+`
+
+type RevokeAPIKeyParams struct {
+	Now    sql.NullInt64
+	ID     string
+	UserID string
+}
+
+func (q *Queries) RevokeAPIKey(ctx context.Context, arg RevokeAPIKeyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeAPIKey, arg.Now, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
-const getDosesByPatientLimitBy = `-- name: GetDosesByPatientLimitBy :many
+const searchMedications = `-- name: SearchMedications :many
 SELECT
-    doses.id, doses.regimen_id, doses.refill, doses.time, doses.amount, doses.unit, doses.taken, doses.time_taken,
-    medications.id, medications.name, medications.generic, medications.brand,
-    regimens.id, regimens.medication_id, regimens.patient, regimens.prescription_id
+    id, name, generic, brand, strength, name_key, brand_key, strength_key, strength_value, strength_unit, form, route
 FROM
-    doses
-    INNER JOIN regimens ON doses.regimen_id = regimens.id
-    INNER JOIN medications ON regimens.medication_id = medications.id
+    medications
 WHERE
-    doses.taken IS NULL
-    AND regimens.patient = ?
+    name_key GLOB ?1
+    OR brand_key GLOB ?1
 ORDER BY
-    doses.Time
+    name_key,
+    brand_key,
+    strength_key,
+    form
 LIMIT
-    ?
+    ?2
 `
 
-type GetDosesByPatientLimitByParams struct {
-	Patient string
-	Limit   int64
-}
-
-type GetDosesByPatientLimitByRow struct {
-	ID             string
-	RegimenID      string
-	Refill         int64
-	Time           int64
-	Amount         float64
-	Unit           string
-	Taken          sql.NullBool
-	TimeTaken      sql.NullInt64
-	ID_2           string
-	Name           string
-	Generic        bool
-	Brand          string
-	ID_3           string
-	MedicationID   string
-	Patient        string
-	PrescriptionID string
+type SearchMedicationsParams struct {
+	Pattern    string
+	MaxResults int64
 }
 
-func (q *Queries) GetDosesByPatientLimitBy(ctx context.Context, arg GetDosesByPatientLimitByParams) ([]GetDosesByPatientLimitByRow, error) {
-	rows, err := q.db.QueryContext(ctx, getDosesByPatientLimitBy, arg.Patient, arg.Limit)
+func (q *Queries) SearchMedications(ctx context.Context, arg SearchMedicationsParams) ([]Medication, error) {
+	rows, err := q.db.QueryContext(ctx, searchMedications, arg.Pattern, arg.MaxResults)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetDosesByPatientLimitByRow
+	var items []Medication
 	for rows.Next() {
-		var i GetDosesByPatientLimitByRow
+		var i Medication
 		if err := rows.Scan(
 			&i.ID,
-			&i.RegimenID,
-			&i.Refill,
-			&i.Time,
-			&i.Amount,
-			&i.Unit,
-			&i.Taken,
-			&i.TimeTaken,
-			&i.ID_2,
 			&i.Name,
 			&i.Generic,
 			&i.Brand,
-			&i.ID_3,
-			&i.MedicationID,
-			&i.Patient,
-			&i.PrescriptionID,
+			&i.Strength,
+			&i.NameKey,
+			&i.BrandKey,
+			&i.StrengthKey,
+			&i.StrengthValue,
+			&i.StrengthUnit,
+			&i.Form,
+			&i.Route,
 		); err != nil {
 			return nil, err
 		}
@@ -378,38 +2874,353 @@ func (q *Queries) GetDosesByPatientLimitBy(ctx context.Context, arg GetDosesByPa
 	return items, nil
 }
 
-const getMedication = `-- name: GetMedication :one
-SELECT
-    id, name, generic, brand
-FROM
-    medications
+const setCaregiver = `-- name: SetCaregiver :one
+INSERT INTO
+    caregivers (
+        patient_id,
+        user_id,
+        grant_level,
+        granted_by,
+        granted_at
+    )
+VALUES
+    (?, ?, ?, ?, ?) ON CONFLICT (patient_id, user_id) DO
+UPDATE
+SET
+    grant_level = excluded.grant_level,
+    granted_by = excluded.granted_by,
+    granted_at = excluded.granted_at RETURNING patient_id, user_id, grant_level, granted_by, granted_at
+`
+
+type SetCaregiverParams struct {
+	PatientID  string
+	UserID     string
+	GrantLevel string
+	GrantedBy  string
+	GrantedAt  int64
+}
+
+func (q *Queries) SetCaregiver(ctx context.Context, arg SetCaregiverParams) (Caregiver, error) {
+	row := q.db.QueryRowContext(ctx, setCaregiver,
+		arg.PatientID,
+		arg.UserID,
+		arg.GrantLevel,
+		arg.GrantedBy,
+		arg.GrantedAt,
+	)
+	var i Caregiver
+	err := row.Scan(
+		&i.PatientID,
+		&i.UserID,
+		&i.GrantLevel,
+		&i.GrantedBy,
+		&i.GrantedAt,
+	)
+	return i, err
+}
+
+const setLowSupplyAlerted = `-- name: SetLowSupplyAlerted :exec
+UPDATE prescriptions
+SET
+    low_supply_alerted_at = ?
 WHERE
     id = ?
 `
 
-func (q *Queries) GetMedication(ctx context.Context, id string) (Medication, error) {
-	row := q.db.QueryRowContext(ctx, getMedication, id)
-	var i Medication
+type SetLowSupplyAlertedParams struct {
+	LowSupplyAlertedAt sql.NullInt64
+	ID                 string
+}
+
+func (q *Queries) SetLowSupplyAlerted(ctx context.Context, arg SetLowSupplyAlertedParams) error {
+	_, err := q.db.ExecContext(ctx, setLowSupplyAlerted, arg.LowSupplyAlertedAt, arg.ID)
+	return err
+}
+
+const setPatientTimeZone = `-- name: SetPatientTimeZone :exec
+UPDATE patients
+SET
+    time_zone = ?
+WHERE
+    id = ?
+`
+
+type SetPatientTimeZoneParams struct {
+	TimeZone string
+	ID       string
+}
+
+func (q *Queries) SetPatientTimeZone(ctx context.Context, arg SetPatientTimeZoneParams) error {
+	_, err := q.db.ExecContext(ctx, setPatientTimeZone, arg.TimeZone, arg.ID)
+	return err
+}
+
+const setUserPreferences = `-- name: SetUserPreferences :one
+INSERT INTO
+    user_preferences (
+        user_id,
+        channels,
+        lead_time,
+        snooze,
+        quiet_start,
+        quiet_end,
+        refill_lead_days
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (user_id) DO
+UPDATE
+SET
+    channels = excluded.channels,
+    lead_time = excluded.lead_time,
+    snooze = excluded.snooze,
+    quiet_start = excluded.quiet_start,
+    quiet_end = excluded.quiet_end,
+    refill_lead_days = excluded.refill_lead_days RETURNING user_id, channels, lead_time, snooze, quiet_start, quiet_end, refill_lead_days
+`
+
+type SetUserPreferencesParams struct {
+	UserID         string
+	Channels       string
+	LeadTime       sql.NullInt64
+	Snooze         sql.NullInt64
+	QuietStart     sql.NullInt64
+	QuietEnd       sql.NullInt64
+	RefillLeadDays sql.NullInt64
+}
+
+func (q *Queries) SetUserPreferences(ctx context.Context, arg SetUserPreferencesParams) (UserPreference, error) {
+	row := q.db.QueryRowContext(ctx, setUserPreferences,
+		arg.UserID,
+		arg.Channels,
+		arg.LeadTime,
+		arg.Snooze,
+		arg.QuietStart,
+		arg.QuietEnd,
+		arg.RefillLeadDays,
+	)
+	var i UserPreference
+	err := row.Scan(
+		&i.UserID,
+		&i.Channels,
+		&i.LeadTime,
+		&i.Snooze,
+		&i.QuietStart,
+		&i.QuietEnd,
+		&i.RefillLeadDays,
+	)
+	return i, err
+}
+
+const setUserStatus = `-- name: SetUserStatus :execrows
+UPDATE users
+SET
+    status = ?1,
+    approved = ?1 = 'approved'
+WHERE
+    id = ?2
+    AND status = ?3
+`
+
+type SetUserStatusParams struct {
+	Status  string
+	ID      string
+	Current string
+}
+
+func (q *Queries) SetUserStatus(ctx context.Context, arg SetUserStatusParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserStatus, arg.Status, arg.ID, arg.Current)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserTimeZone = `-- name: SetUserTimeZone :one
+UPDATE users
+SET
+    time_zone = ?
+WHERE
+    id = ? RETURNING id, approved, time_zone, status, created_at
+`
+
+type SetUserTimeZoneParams struct {
+	TimeZone string
+	ID       string
+}
+
+func (q *Queries) SetUserTimeZone(ctx context.Context, arg SetUserTimeZoneParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserTimeZone, arg.TimeZone, arg.ID)
+	var i User
 	err := row.Scan(
 		&i.ID,
-		&i.Name,
-		&i.Generic,
-		&i.Brand,
+		&i.Approved,
+		&i.TimeZone,
+		&i.Status,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
-const getRx = `-- name: GetRx :one
-SELECT
-    id, medication_id, schedule, scheduled_start, refills, doses, patient
-FROM
-    prescriptions
+const shiftPendingDoses = `-- name: ShiftPendingDoses :exec
+UPDATE doses
+SET
+    time = time + ?1,
+    snoozed_until = snoozed_until + ?1
+WHERE
+    regimen_id = ?2
+    AND taken IS NULL
+    AND time >= ?3
+`
+
+type ShiftPendingDosesParams struct {
+	Shift     int64
+	RegimenID string
+	Since     int64
+}
+
+func (q *Queries) ShiftPendingDoses(ctx context.Context, arg ShiftPendingDosesParams) error {
+	_, err := q.db.ExecContext(ctx, shiftPendingDoses, arg.Shift, arg.RegimenID, arg.Since)
+	return err
+}
+
+const snoozeDose = `-- name: SnoozeDose :one
+UPDATE doses
+SET
+    snoozed_until = ?,
+    snoozes = snoozes + 1
 WHERE
     id = ?
+    AND taken IS NULL
+    AND missed_at IS NULL RETURNING id, regimen_id, refill, time, amount, unit, taken, time_taken, phase, amount_taken, missed_at, snoozed_until, snoozes
 `
 
-func (q *Queries) GetRx(ctx context.Context, id string) (Prescription, error) {
-	row := q.db.QueryRowContext(ctx, getRx, id)
+type SnoozeDoseParams struct {
+	SnoozedUntil sql.NullInt64
+	ID           string
+}
+
+func (q *Queries) SnoozeDose(ctx context.Context, arg SnoozeDoseParams) (Dose, error) {
+	row := q.db.QueryRowContext(ctx, snoozeDose, arg.SnoozedUntil, arg.ID)
+	var i Dose
+	err := row.Scan(
+		&i.ID,
+		&i.RegimenID,
+		&i.Refill,
+		&i.Time,
+		&i.Amount,
+		&i.Unit,
+		&i.Taken,
+		&i.TimeTaken,
+		&i.Phase,
+		&i.AmountTaken,
+		&i.MissedAt,
+		&i.SnoozedUntil,
+		&i.Snoozes,
+	)
+	return i, err
+}
+
+const updateDoseLog = `-- name: UpdateDoseLog :one
+UPDATE doses
+SET
+    taken = ?,
+    time_taken = ?,
+    amount_taken = ?
+WHERE
+    id = ? RETURNING id, regimen_id, refill, time, amount, unit, taken, time_taken, phase, amount_taken, missed_at, snoozed_until, snoozes
+`
+
+type UpdateDoseLogParams struct {
+	Taken       sql.NullBool
+	TimeTaken   sql.NullInt64
+	AmountTaken sql.NullFloat64
+	ID          string
+}
+
+func (q *Queries) UpdateDoseLog(ctx context.Context, arg UpdateDoseLogParams) (Dose, error) {
+	row := q.db.QueryRowContext(ctx, updateDoseLog,
+		arg.Taken,
+		arg.TimeTaken,
+		arg.AmountTaken,
+		arg.ID,
+	)
+	var i Dose
+	err := row.Scan(
+		&i.ID,
+		&i.RegimenID,
+		&i.Refill,
+		&i.Time,
+		&i.Amount,
+		&i.Unit,
+		&i.Taken,
+		&i.TimeTaken,
+		&i.Phase,
+		&i.AmountTaken,
+		&i.MissedAt,
+		&i.SnoozedUntil,
+		&i.Snoozes,
+	)
+	return i, err
+}
+
+const updateDoseTime = `-- name: UpdateDoseTime :exec
+UPDATE doses
+SET
+    time = ?1,
+    snoozed_until = snoozed_until + ?1 - time
+WHERE
+    id = ?2
+`
+
+type UpdateDoseTimeParams struct {
+	Time int64
+	ID   string
+}
+
+func (q *Queries) UpdateDoseTime(ctx context.Context, arg UpdateDoseTimeParams) error {
+	_, err := q.db.ExecContext(ctx, updateDoseTime, arg.Time, arg.ID)
+	return err
+}
+
+const updateRx = `-- name: UpdateRx :one
+UPDATE prescriptions
+SET
+    schedule = ?,
+    scheduled_start = ?,
+    refills = ?,
+    doses = ?,
+    on_time_tolerance = ?,
+    missed_grace = ?,
+    critical = ?,
+    low_supply = ?
+WHERE
+    id = ? RETURNING id, medication_id, schedule, scheduled_start, refills, doses, patient, discontinued_at, discontinued_reason, on_time_tolerance, missed_grace, critical, low_supply, low_supply_alerted_at, refills_used
+`
+
+type UpdateRxParams struct {
+	Schedule        []byte
+	ScheduledStart  sql.NullInt64
+	Refills         int64
+	Doses           int64
+	OnTimeTolerance sql.NullInt64
+	MissedGrace     sql.NullInt64
+	Critical        bool
+	LowSupply       sql.NullFloat64
+	ID              string
+}
+
+func (q *Queries) UpdateRx(ctx context.Context, arg UpdateRxParams) (Prescription, error) {
+	row := q.db.QueryRowContext(ctx, updateRx,
+		arg.Schedule,
+		arg.ScheduledStart,
+		arg.Refills,
+		arg.Doses,
+		arg.OnTimeTolerance,
+		arg.MissedGrace,
+		arg.Critical,
+		arg.LowSupply,
+		arg.ID,
+	)
 	var i Prescription
 	err := row.Scan(
 		&i.ID,
@@ -419,42 +3230,72 @@ func (q *Queries) GetRx(ctx context.Context, id string) (Prescription, error) {
 		&i.Refills,
 		&i.Doses,
 		&i.Patient,
+		&i.DiscontinuedAt,
+		&i.DiscontinuedReason,
+		&i.OnTimeTolerance,
+		&i.MissedGrace,
+		&i.Critical,
+		&i.LowSupply,
+		&i.LowSupplyAlertedAt,
+		&i.RefillsUsed,
 	)
 	return i, err
 }
 
-const getUser = `-- name: GetUser :one
-SELECT
-    id, approved
-FROM
-    users
+const useAPIKey = `-- name: UseAPIKey :exec
+UPDATE api_keys
+SET
+    last_used_at = ?1
 WHERE
-    id = ?
+    id = ?2
 `
 
-func (q *Queries) GetUser(ctx context.Context, id string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUser, id)
-	var i User
-	err := row.Scan(&i.ID, &i.Approved)
-	return i, err
+type UseAPIKeyParams struct {
+	Now sql.NullInt64
+	ID  string
 }
 
-const markDoseTaken = `-- name: MarkDoseTaken :exec
-UPDATE doses
+func (q *Queries) UseAPIKey(ctx context.Context, arg UseAPIKeyParams) error {
+	_, err := q.db.ExecContext(ctx, useAPIKey, arg.Now, arg.ID)
+	return err
+}
+
+const useInvite = `-- name: UseInvite :execrows
+UPDATE invites
 SET
-    taken = ?,
-    time_taken = ?
+    uses = uses + 1
 WHERE
-    id = ?
+    id = ?1
+    AND uses < max_uses
+    AND expires_at > ?2
 `
 
-type MarkDoseTakenParams struct {
-	Taken     sql.NullBool
-	TimeTaken sql.NullInt64
-	ID        string
+type UseInviteParams struct {
+	ID  string
+	Now int64
 }
 
-func (q *Queries) MarkDoseTaken(ctx context.Context, arg MarkDoseTakenParams) error {
-	_, err := q.db.ExecContext(ctx, markDoseTaken, arg.Taken, arg.TimeTaken, arg.ID)
-	return err
+func (q *Queries) UseInvite(ctx context.Context, arg UseInviteParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useInvite, arg.ID, arg.Now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const useRefill = `-- name: UseRefill :execrows
+UPDATE prescriptions
+SET
+    refills_used = refills_used + 1
+WHERE
+    id = ?
+    AND refills_used < refills
+`
+
+func (q *Queries) UseRefill(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useRefill, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
@@ -3,21 +3,93 @@ package models
 import "time"
 
 type Prescription struct {
-	ID            string
-	Medication    Medication
-	Schedule      Schedule
-	Doses         int
-	Refills       int
-	ScheduleStart *time.Time
+	ID         string
+	Medication Medication
+	Schedule   Schedule
+	// Doses per fill
+	Doses int
+	// Tapered schedules can't have refills, the taper is the whole course
+	Refills int
+	// Refills that haven't been filled yet
+	RefillsRemaining int
+	ScheduleStart    *time.Time
+	// If nil, the prescription is still active
+	DiscontinuedAt     *time.Time
+	DiscontinuedReason string
+	// For tapered schedules, the phase of the next pending dose
+	CurrentPhase *int `json:",omitempty"`
+	// How far either side of its time a dose can be taken and still count
+	// as on time. If nil, the default of an hour is used.
+	OnTimeTolerance *Duration `json:",omitempty"`
+	// How long after its time a dose can go unlogged before it is marked
+	// missed. If nil, the server's default is used.
+	MissedGrace *Duration `json:",omitempty"`
+	// Reminders for critical medications are sent during quiet hours
+	Critical bool `json:",omitempty"`
+	// Alert once the inventory on hand falls to this. If nil, never.
+	LowSupply *float64 `json:",omitempty"`
+}
+
+// PrescriptionPatch holds the fields of a Prescription that can be changed
+// after creation. Nil fields are left as they are.
+type PrescriptionPatch struct {
+	Schedule        *Schedule
+	Doses           *int
+	Refills         *int
+	ScheduleStart   *time.Time
+	OnTimeTolerance *Duration
+	MissedGrace     *Duration
+	Critical        *bool
+	LowSupply       *float64
 }
 
 type Medication struct {
-	ID      string
-	Name    string
-	Generic bool
-	Brand   string
+	ID       string
+	Name     string
+	Generic  bool
+	Brand    string
+	Strength *Strength `json:",omitempty"`
+	// If empty, dose units aren't checked against the form
+	Form  DosageForm `json:",omitempty"`
+	Route Route      `json:",omitempty"`
 }
 
+// Strength is how much drug there is in one of the form, e.g. 500 mg per
+// tablet, or in a volume of a liquid, e.g. 100 mg/5 mL.
+type Strength struct {
+	Value float64
+	Unit  string
+}
+
+type DosageForm string
+
+const (
+	FormTablet    DosageForm = "tablet"
+	FormCapsule   DosageForm = "capsule"
+	FormLiquid    DosageForm = "liquid"
+	FormInjection DosageForm = "injection"
+	FormPatch     DosageForm = "patch"
+	FormInhaler   DosageForm = "inhaler"
+)
+
+type Route string
+
+const (
+	RouteOral          Route = "oral"
+	RouteSublingual    Route = "sublingual"
+	RouteTopical       Route = "topical"
+	RouteTransdermal   Route = "transdermal"
+	RouteInhaled       Route = "inhaled"
+	RouteNasal         Route = "nasal"
+	RouteOphthalmic    Route = "ophthalmic"
+	RouteOtic          Route = "otic"
+	RouteRectal        Route = "rectal"
+	RouteVaginal       Route = "vaginal"
+	RouteSubcutaneous  Route = "subcutaneous"
+	RouteIntramuscular Route = "intramuscular"
+	RouteIntravenous   Route = "intravenous"
+)
+
 type Regimen struct {
 	ID         string
 	Medication Medication
@@ -33,6 +105,46 @@ type Dose struct {
 	Taken     *bool
 	Refill    int
 	TimeTaken *time.Time
+	Phase     int
+	// If nil, the scheduled Amount was taken
+	AmountTaken *float64
+	// Set when the dose went unlogged past its grace window. A missed dose
+	// can still be logged late.
+	MissedAt *time.Time
+	// If set, the dose is due then instead of at Time
+	SnoozedUntil *time.Time
+	Snoozes      int
+}
+
+// DoseEdit corrects a logged dose. Nil fields are left as they are.
+type DoseEdit struct {
+	TimeTaken   *time.Time
+	AmountTaken *float64
+}
+
+type DoseEventKind string
+
+const (
+	DoseTaken   DoseEventKind = "taken"
+	DoseSkipped DoseEventKind = "skipped"
+	// The dose was reset to pending, or removed if it was an as needed dose
+	DoseUndone DoseEventKind = "undone"
+	DoseEdited DoseEventKind = "edited"
+	// The dose was put off but is still pending
+	DoseSnoozed DoseEventKind = "snoozed"
+)
+
+// DoseEvent is an entry in a dose's audit trail. Taken, TimeTaken and
+// AmountTaken are the state of the dose after the event.
+type DoseEvent struct {
+	ID          string
+	DoseID      string
+	Event       DoseEventKind
+	Actor       string
+	Time        time.Time
+	Taken       *bool
+	TimeTaken   *time.Time
+	AmountTaken *float64
 }
 
 type ScheduledDose struct {
@@ -41,14 +153,366 @@ type ScheduledDose struct {
 	Unit               string
 }
 
+type ScheduleKind string
+
+const (
+	// Doses restart every Period. Schedules saved before kinds existed have
+	// no Kind and are periodic.
+	SchedulePeriodic ScheduleKind = "periodic"
+	// Doses are taken on each of the Weekdays
+	ScheduleWeekly ScheduleKind = "weekly"
+	// Doses are taken on each of the DaysOfMonth
+	ScheduleMonthly ScheduleKind = "monthly"
+	// Doses are taken each time the Cron expression fires
+	ScheduleCron ScheduleKind = "cron"
+	// Doses are only taken when needed (PRN), within the AsNeeded limits.
+	// No doses are scheduled ahead of time.
+	ScheduleAsNeeded ScheduleKind = "as_needed"
+	// Each of the Phases is followed for its Duration, in order, e.g. a
+	// steroid taper of 40mg for 3 days then 30mg for 3 days
+	ScheduleTapered ScheduleKind = "tapered"
+)
+
 type Schedule struct {
+	Kind ScheduleKind `json:",omitempty"`
 	// Per period, the doses restart. No Dose Duration Into Period
 	// can exceed the Period
 	Period Duration
-	Doses  []ScheduledDose
+	// For weekly and monthly schedules a dose's DurationIntoPeriod is the
+	// time of day it is due. For cron schedules it is the offset from each
+	// time the expression fires.
+	Doses []ScheduledDose
+
+	Weekdays []Weekday `json:",omitempty"`
+	// 1 is the first of the month and -1 the last. Days a month doesn't
+	// have, like the 31st of April, are skipped.
+	DaysOfMonth []int `json:",omitempty"`
+	// Five field cron expression: minute hour day-of-month month day-of-week
+	Cron string `json:",omitempty"`
+	// IANA zone the schedule's days and times of day are in. If empty, the
+	// patient's home zone is used.
+	TimeZone string `json:",omitempty"`
+
+	AsNeeded *AsNeeded `json:",omitempty"`
+	Phases   []Phase   `json:",omitempty"`
+}
+
+type Phase struct {
+	Schedule Schedule
+	Duration Duration
+}
+
+// AsNeeded describes a PRN medication, e.g. "1 tablet every 4-6 hours as
+// needed, at most 4 per day" is a MinInterval of 4h and 4 MaxDoses in a 24h
+// Window.
+type AsNeeded struct {
+	Amount      float64
+	Unit        string
+	MinInterval Duration
+	MaxDoses    int // If 0, no limit
+	Window      Duration
+	// Reject doses that break the limits instead of logging them with a
+	// warning
+	Enforce bool
+}
+
+// AsNeededDose is an ad-hoc dose of a PRN medication. If Amount is 0 the
+// prescription's amount is used.
+type AsNeededDose struct {
+	Time   time.Time
+	Amount float64
+}
+
+// Refill is a pharmacy refill being picked up. If Time is nil it is now,
+// and if Quantity is 0 it is what the fill's doses add up to.
+type Refill struct {
+	Time     *time.Time
+	Quantity float64
+	Pharmacy string
+}
+
+// Fill is a refill that was picked up.
+type Fill struct {
+	ID string
+	// 1 for the first refill
+	Refill   int
+	Time     time.Time
+	Quantity float64
+	Pharmacy string
+	// Doses added to the schedule by the fill
+	Doses int
+}
+
+// RefillForecast says when a prescription's supply runs out and when to ask
+// the pharmacy for the next fill.
+type RefillForecast struct {
+	PrescriptionID string
+	// Doses still pending from the fills picked up so far
+	DosesRemaining   int
+	RefillsRemaining int
+	// When the first dose the supply doesn't cover is due. If nil, the
+	// supply lasts the rest of the schedule.
+	RunsOut *time.Time
+	// RunsOut less the lead days
+	RequestBy *time.Time
+	LeadDays  int
+	// No refills are left, so the next fill needs a new prescription
+	NeedsPrescription bool
+}
+
+type AsNeededStatus struct {
+	LastTaken     *time.Time
+	TakenInWindow int
+	// Earliest time the next dose is within limits
+	NextAllowed time.Time
+	// Limits broken by the dose being logged, if any
+	Warnings []string `json:",omitempty"`
+}
+
+// AdherenceCounts sorts the doses due in a period by what became of them.
+type AdherenceCounts struct {
+	// Doses that were taken, skipped or missed. Pending doses aren't due yet.
+	Due     int
+	OnTime  int
+	Early   int // Taken, but before their time by more than the tolerance
+	Late    int // Taken, but after their time by more than the tolerance
+	Skipped int
+	Missed  int // Never logged before the grace window passed
+	Pending int
+	// Times the doses were snoozed, whatever became of them
+	Snoozes int
+	// Percent of the due doses that were taken, or 0 if none were due
+	Adherence float64
+}
+
+type MedicationAdherence struct {
+	PrescriptionID string
+	Medication     Medication
+	AdherenceCounts
+	// Most due doses in a row that were taken
+	LongestStreak int
+}
+
+type DailyAdherence struct {
+	Date string // YYYY-MM-DD in the patient's home zone
+	AdherenceCounts
+}
+
+type Adherence struct {
+	From time.Time
+	To   time.Time
+	AdherenceCounts
+	// Most days in a row on which every due dose was taken. Days with
+	// nothing due don't break a streak.
+	LongestStreak int
+	Medications   []MedicationAdherence
+	Days          []DailyAdherence
+}
+
+type Channel string
+
+const (
+	ChannelWebhook Channel = "webhook"
+	ChannelEmail   Channel = "email"
+	ChannelWebPush Channel = "web_push"
+)
+
+// NotificationTarget is somewhere a user's reminders are delivered.
+type NotificationTarget struct {
+	ID      string
+	Channel Channel
+	// A URL for webhooks, an email address, or a PushSubscription's JSON
+	// for web push
+	Address   string
+	CreatedAt time.Time
+}
+
+// Preferences are how a user wants to be reminded. Unset fields use the
+// server's defaults.
+type Preferences struct {
+	// If empty, reminders go out over every channel the user has a target for
+	Channels []Channel
+	// How long before each dose its reminder goes out
+	LeadTime *Duration `json:",omitempty"`
+	// How long a snoozed dose waits before it is due again
+	Snooze     *Duration   `json:",omitempty"`
+	QuietHours *QuietHours `json:",omitempty"`
+	// How many days before a fill runs out to ask the pharmacy for the
+	// next one
+	RefillLeadDays *int `json:",omitempty"`
+}
+
+// QuietHours are a daily period, in the user's home zone, during which
+// reminders for medications that aren't critical are held until it ends.
+// Start and End are times of day; an End before Start spans midnight.
+type QuietHours struct {
+	Start Duration
+	End   Duration
+}
+
+type InventoryKind string
+
+const (
+	InventoryFill InventoryKind = "fill"
+	// Taken doses are entered as they're logged, and corrected by further
+	// entries if they're undone or edited
+	InventoryDose       InventoryKind = "dose"
+	InventoryAdjustment InventoryKind = "adjustment"
+)
+
+// InventoryEntry is a change to the medication on hand, in the units the
+// prescription's doses are in.
+type InventoryEntry struct {
+	ID       string
+	Kind     InventoryKind
+	Quantity float64 // Added if positive, removed if negative
+	DoseID   string  `json:",omitempty"`
+	Note     string
+	Actor    string
+	Time     time.Time
+}
+
+// InventoryChange is a fill or a manual adjustment, e.g. for lost pills.
+type InventoryChange struct {
+	Kind     InventoryKind
+	Quantity float64
+	// For adjustments, the amount counted on hand instead of Quantity. The
+	// adjustment is whatever makes the inventory agree.
+	Count *float64 `json:",omitempty"`
+	Note  string
+	// If nil, now
+	Time *time.Time
+}
+
+type Inventory struct {
+	PrescriptionID string
+	OnHand         float64
+	// When the medication on hand won't cover the next dose. If nil, it
+	// lasts past the last scheduled dose, or isn't taken on a schedule.
+	RunsOut   *time.Time
+	LowSupply *float64 `json:",omitempty"`
+	Low       bool
+	Entries   []InventoryEntry
 }
 
 type User struct {
+	ID       string
+	Name     string
+	TimeZone string
+	Status   UserStatus `json:",omitempty"`
+	// If nil, the user signed up before sign ups were recorded
+	CreatedAt *time.Time `json:",omitempty"`
+}
+
+// UserStatus is where a user is in being let in by an admin. Only approved
+// users can use the API.
+type UserStatus string
+
+const (
+	UserPending  UserStatus = "pending"
+	UserApproved UserStatus = "approved"
+	UserDenied   UserStatus = "denied"
+	// Approved once, but no longer
+	UserRevoked UserStatus = "revoked"
+)
+
+// UserDecision is an admin approving, denying or revoking a user.
+type UserDecision struct {
+	ID       string
+	User     string
+	Decision UserStatus
+	Reason   string
+	// The admin who decided
+	Actor string
+	Time  time.Time
+}
+
+// Invite is a code new users redeem to approve themselves.
+type Invite struct {
+	ID string
+	// Only known when the invite is created
+	Code      string `json:",omitempty"`
+	CreatedBy string
+	MaxUses   int
+	Uses      int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// InviteRequest is what an invite being created allows.
+type InviteRequest struct {
+	// If 0, the invite can be used once
+	MaxUses int
+	// If nil, the default expiry is used
+	ExpiresIn *Duration `json:",omitempty"`
+}
+
+// Patient is someone whose medications are tracked. Every user is a patient
+// with their own ID, and users can add dependents, like children, that
+// don't log in.
+type Patient struct {
+	ID   string
+	Name string
+	// The user that is this patient. If empty, a dependent.
+	User string `json:",omitempty"`
+	// Who grants caregivers access to the patient
+	Owner    string
+	TimeZone string
+	// What the requesting user can do for the patient
+	Grant Grant
+}
+
+// Grant is what a caregiver can do for a patient. Each grant allows
+// everything the ones before it do.
+type Grant string
+
+const (
+	GrantView Grant = "view"
+	// Log, undo, edit and snooze doses
+	GrantLog Grant = "log"
+	// Write, change and stop prescriptions, and keep track of refills and
+	// the inventory
+	GrantManage Grant = "manage"
+)
+
+// Caregiver is a user a patient's owner gave access to the patient.
+type Caregiver struct {
+	User      string
+	Grant     Grant
+	GrantedBy string
+	GrantedAt time.Time
+}
+
+// APIKey lets scripts and integrations act as the user who made it, within
+// its scopes.
+type APIKey struct {
 	ID   string
+	User string
 	Name string
+	// Only known when the key is created
+	Key        string `json:",omitempty"`
+	Scopes     []KeyScope
+	LastUsedAt *time.Time `json:",omitempty"`
+	RevokedAt  *time.Time `json:",omitempty"`
+	CreatedAt  time.Time
 }
+
+// APIKeyRequest is the name and scopes of a key being created.
+type APIKeyRequest struct {
+	Name   string
+	Scopes []KeyScope
+}
+
+// KeyScope is what an API key can do. Like grants, each allows everything
+// the ones before it do, and keys are also limited by the grants their user
+// has for other patients.
+type KeyScope string
+
+const (
+	KeyScopeRead KeyScope = "read"
+	// Log, undo, edit and snooze doses
+	KeyScopeLogDoses KeyScope = "log_doses"
+)
+
+// APIKeyPrefix starts every API key, telling them apart from tokens.
+const APIKeyPrefix = "pm_"
@@ -3,6 +3,8 @@ package models
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -34,3 +36,37 @@ func (d *Duration) UnmarshalJSON(b []byte) error {
 		return errors.New("invalid duration")
 	}
 }
+
+type Weekday struct {
+	time.Weekday
+}
+
+func (d Weekday) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Weekday) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		if value < 0 || value > 6 || value != float64(int(value)) {
+			return fmt.Errorf("invalid weekday %v", value)
+		}
+		d.Weekday = time.Weekday(value)
+		return nil
+	case string:
+		for wd := time.Sunday; wd <= time.Saturday; wd++ {
+			name := wd.String()
+			if strings.EqualFold(value, name) || strings.EqualFold(value, name[:3]) {
+				d.Weekday = wd
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid weekday %q", value)
+	default:
+		return errors.New("invalid weekday")
+	}
+}
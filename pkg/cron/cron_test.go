@@ -0,0 +1,271 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loc
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"1,,2 * * * *",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := Parse(expr)
+			if err == nil {
+				t.Error("got nil, want an error")
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	utc := time.UTC
+
+	// 2024-05-01 is a Wednesday
+	from := time.Date(2024, 5, 1, 10, 30, 0, 0, utc)
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2024, 5, 1, 10, 31, 0, 0, utc)},
+		// Strictly after, and seconds are dropped
+		{"30 10 * * *", from, time.Date(2024, 5, 2, 10, 30, 0, 0, utc)},
+		{"30 10 * * *", from.Add(-time.Second), from},
+		{"0 8 * * *", from, time.Date(2024, 5, 2, 8, 0, 0, 0, utc)},
+		{"*/15 * * * *", from, time.Date(2024, 5, 1, 10, 45, 0, 0, utc)},
+		{"0-30/10 9-17 * * *", from, time.Date(2024, 5, 1, 11, 0, 0, 0, utc)},
+		{"5/20 * * * *", from, time.Date(2024, 5, 1, 10, 45, 0, 0, utc)},
+		{"0 8,20 * * *", from, time.Date(2024, 5, 1, 20, 0, 0, 0, utc)},
+		{"0 8 * * MON", from, time.Date(2024, 5, 6, 8, 0, 0, 0, utc)},
+		{"0 8 * * mon-fri", time.Date(2024, 5, 3, 9, 0, 0, 0, utc), time.Date(2024, 5, 6, 8, 0, 0, 0, utc)},
+		// 7 is Sunday, as is 0
+		{"0 8 * * 7", from, time.Date(2024, 5, 5, 8, 0, 0, 0, utc)},
+		{"0 8 * * 0", from, time.Date(2024, 5, 5, 8, 0, 0, 0, utc)},
+		{"0 8 1 * *", from, time.Date(2024, 6, 1, 8, 0, 0, 0, utc)},
+		{"0 8 * JUL *", from, time.Date(2024, 7, 1, 8, 0, 0, 0, utc)},
+		{"0 8 31 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, utc), time.Date(2024, 5, 31, 8, 0, 0, 0, utc)},
+		{"0 0 29 2 *", from, time.Date(2028, 2, 29, 0, 0, 0, 0, utc)},
+		// With both days restricted either matches, the 15th or a Friday
+		{"0 8 15 * FRI", from, time.Date(2024, 5, 3, 8, 0, 0, 0, utc)},
+		{"0 8 15 * FRI", time.Date(2024, 5, 11, 0, 0, 0, 0, utc), time.Date(2024, 5, 15, 8, 0, 0, 0, utc)},
+		// With one of them *, only the other counts
+		{"0 8 15 * *", from, time.Date(2024, 5, 15, 8, 0, 0, 0, utc)},
+		{"0 8 * * FRI", from, time.Date(2024, 5, 3, 8, 0, 0, 0, utc)},
+		{"0 8 ? * FRI", from, time.Date(2024, 5, 3, 8, 0, 0, 0, utc)},
+		{"0 0 1 1 *", time.Date(2024, 12, 31, 23, 59, 0, 0, utc), time.Date(2025, 1, 1, 0, 0, 0, 0, utc)},
+		// Never matches
+		{"0 0 30 2 *", from, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := s.Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("from %s got %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	tokyo := mustLoad(t, "Asia/Tokyo")
+
+	s, err := Parse("0 8 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := s.Next(time.Date(2024, 5, 1, 9, 0, 0, 0, tokyo))
+	want := time.Date(2024, 5, 2, 8, 0, 0, 0, tokyo)
+	if !got.Equal(want) || got.Location() != tokyo {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+
+	// Clocks go from 02:00 EST to 03:00 EDT on 2024-03-10 and back from
+	// 02:00 EDT to 01:00 EST on 2024-11-03
+	spring := time.Date(2024, 3, 10, 0, 0, 0, 0, ny)
+	fall := time.Date(2024, 11, 3, 0, 0, 0, 0, ny)
+	est := time.FixedZone("EST", -5*60*60)
+	edt := time.FixedZone("EDT", -4*60*60)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		{
+			name: "skipped time is as far past the jump",
+			expr: "30 2 * * *",
+			from: spring,
+			want: []time.Time{
+				time.Date(2024, 3, 10, 3, 30, 0, 0, edt),
+				time.Date(2024, 3, 11, 2, 30, 0, 0, edt),
+			},
+		},
+		{
+			name: "times after the jump are unchanged",
+			expr: "0 8 * * *",
+			from: spring,
+			want: []time.Time{
+				time.Date(2024, 3, 10, 8, 0, 0, 0, edt),
+				time.Date(2024, 3, 11, 8, 0, 0, 0, edt),
+			},
+		},
+		{
+			name: "every hour follows elapsed time over the jump",
+			expr: "*/30 * * * *",
+			from: time.Date(2024, 3, 10, 1, 10, 0, 0, ny),
+			want: []time.Time{
+				time.Date(2024, 3, 10, 1, 30, 0, 0, est),
+				time.Date(2024, 3, 10, 3, 0, 0, 0, edt),
+				time.Date(2024, 3, 10, 3, 30, 0, 0, edt),
+			},
+		},
+		{
+			name: "repeated time runs once",
+			expr: "30 1 * * *",
+			from: fall,
+			want: []time.Time{
+				time.Date(2024, 11, 3, 1, 30, 0, 0, edt),
+				time.Date(2024, 11, 4, 1, 30, 0, 0, est),
+			},
+		},
+		{
+			name: "repeated time runs once from the second pass",
+			expr: "30 1 * * *",
+			from: time.Date(2024, 11, 3, 1, 10, 0, 0, est).In(ny),
+			want: []time.Time{
+				time.Date(2024, 11, 4, 1, 30, 0, 0, est),
+			},
+		},
+		{
+			name: "every hour runs in both passes",
+			expr: "*/30 * * * *",
+			from: time.Date(2024, 11, 3, 0, 50, 0, 0, ny),
+			want: []time.Time{
+				time.Date(2024, 11, 3, 1, 0, 0, 0, edt),
+				time.Date(2024, 11, 3, 1, 30, 0, 0, edt),
+				time.Date(2024, 11, 3, 1, 0, 0, 0, est),
+				time.Date(2024, 11, 3, 1, 30, 0, 0, est),
+				time.Date(2024, 11, 3, 2, 0, 0, 0, est),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			next := tt.from
+			for _, want := range tt.want {
+				next = s.Next(next)
+				if !next.Equal(want) {
+					t.Fatalf("got %s, want %s", next, want.In(ny))
+				}
+			}
+		})
+	}
+}
+
+func TestWallClock(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	lordHowe := mustLoad(t, "Australia/Lord_Howe")
+
+	tests := []struct {
+		name string
+		wall time.Time
+		loc  *time.Location
+		want time.Time
+	}{
+		{
+			name: "ordinary",
+			wall: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+			loc:  ny,
+			want: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "wall's location is ignored",
+			wall: time.Date(2024, 5, 1, 8, 0, 0, 0, lordHowe),
+			loc:  ny,
+			want: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "skipped",
+			wall: time.Date(2024, 3, 10, 2, 30, 0, 0, time.UTC),
+			loc:  ny,
+			want: time.Date(2024, 3, 10, 7, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "repeated",
+			wall: time.Date(2024, 11, 3, 1, 30, 0, 0, time.UTC),
+			loc:  ny,
+			want: time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC),
+		},
+		// Lord Howe moves by half an hour, and time.Date resolves its
+		// changes the other way from New York's
+		{
+			name: "skipped half hour",
+			wall: time.Date(2024, 10, 6, 2, 15, 0, 0, time.UTC),
+			loc:  lordHowe,
+			want: time.Date(2024, 10, 5, 15, 45, 0, 0, time.UTC),
+		},
+		{
+			name: "repeated half hour",
+			wall: time.Date(2024, 4, 7, 1, 45, 0, 0, time.UTC),
+			loc:  lordHowe,
+			want: time.Date(2024, 4, 6, 14, 45, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WallClock(tt.wall, tt.loc)
+			if !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want.In(tt.loc))
+			}
+			if got.Location() != tt.loc {
+				t.Errorf("got location %s, want %s", got.Location(), tt.loc)
+			}
+		})
+	}
+}
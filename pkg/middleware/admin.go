@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+)
+
+type AdminConfig struct {
+	// Users with this role in their token are admins
+	Role string `env:"ADMIN_ROLE" envDefault:"admin"`
+	// Subjects that are admins whatever their token says
+	Users []string `env:"ADMIN_USERS"`
+}
+
+// RequireAdmin only lets admins through. Admins don't need to be approved
+// themselves, so the first one can approve everyone else.
+func RequireAdmin(next http.Handler, cfg AdminConfig) http.Handler {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`Unauthorized`))
+			return
+		}
+
+		uid := claims.RegisteredClaims.Subject
+
+		admin := slices.Contains(cfg.Users, uid)
+		if custom, ok := claims.CustomClaims.(*CustomClaims); ok && cfg.Role != "" {
+			admin = admin || slices.Contains(custom.Roles, cfg.Role)
+		}
+
+		if !admin {
+			slog.Warn("non admin tried to use the admin api", "uid", uid, "path", r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`Forbidden`))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(f)
+}
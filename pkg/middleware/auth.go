@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/auth0/go-jwt-middleware/v2/jwks"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+)
+
+type AuthMode string
+
+const (
+	// Tokens signed by an OpenID Connect issuer, like Auth0, whose keys
+	// are discovered from the issuer
+	AuthOIDC AuthMode = "oidc"
+	// Tokens signed with a key from the config, HS256 with a secret or
+	// RS256 with a public key
+	AuthLocal AuthMode = "local"
+	// Fixed tokens for development. Never use this in production.
+	AuthDev AuthMode = "dev"
+)
+
+type AuthConfig struct {
+	Mode     AuthMode `env:"AUTH_MODE" envDefault:"oidc"`
+	Audience string   `env:"AUTH0_AUDIENCE" envDefault:"https://kenzo.us.auth0.com/api/v2/"`
+	Domain   string   `env:"AUTH0_DOMAIN" envDefault:"kenzo.us.auth0.com"`
+	// If empty, https://<Domain>/
+	Issuer string `env:"AUTH_ISSUER"`
+
+	// For local tokens, exactly one of these. Secret signs HS256 tokens, and
+	// must be at least MinSecretLength bytes, and PublicKeyFile is a PEM
+	// file that checks RS256 ones.
+	Secret        string `env:"AUTH_SECRET"`
+	PublicKeyFile string `env:"AUTH_PUBLIC_KEY_FILE"`
+
+	// For dev tokens, token:subject pairs, e.g. alice-token:alice
+	DevTokens map[string]string `env:"AUTH_DEV_TOKENS"`
+}
+
+// MinSecretLength is the shortest secret local auth takes, as HS256 keys
+// shorter than the hash can be guessed offline from any token.
+const MinSecretLength = 32
+
+// Authenticator checks a bearer token, returning its
+// *validator.ValidatedClaims. *validator.Validator is one.
+type Authenticator interface {
+	ValidateToken(ctx context.Context, token string) (any, error)
+}
+
+// NewAuthenticator sets up the authenticator cfg.Mode picks.
+func NewAuthenticator(cfg AuthConfig) (Authenticator, error) {
+	issuer := cfg.Issuer
+	if issuer == "" {
+		issuer = "https://" + cfg.Domain + "/"
+	}
+
+	var keyFunc func(context.Context) (any, error)
+	algorithm := validator.RS256
+
+	switch cfg.Mode {
+	case AuthOIDC:
+		issuerURL, err := url.Parse(issuer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the issuer url: %w", err)
+		}
+
+		issuer = issuerURL.String()
+		keyFunc = jwks.NewCachingProvider(issuerURL, 5*time.Minute).KeyFunc
+	case AuthLocal:
+		if (cfg.Secret == "") == (cfg.PublicKeyFile == "") {
+			return nil, errors.New("local auth needs either a secret or a public key file")
+		}
+
+		if cfg.Secret != "" && len(cfg.Secret) < MinSecretLength {
+			return nil, fmt.Errorf("local auth secret must be at least %d bytes", MinSecretLength)
+		}
+
+		var key any = []byte(cfg.Secret)
+		algorithm = validator.HS256
+
+		if cfg.PublicKeyFile != "" {
+			publicKey, err := readPublicKey(cfg.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+
+			key = publicKey
+			algorithm = validator.RS256
+		}
+
+		keyFunc = func(context.Context) (any, error) {
+			return key, nil
+		}
+	case AuthDev:
+		if len(cfg.DevTokens) == 0 {
+			return nil, errors.New("dev auth needs at least one token")
+		}
+
+		slog.Warn("using static dev tokens, anyone with one is let in", "tokens", len(cfg.DevTokens))
+
+		return DevTokens(cfg.DevTokens), nil
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", cfg.Mode)
+	}
+
+	jwtValidator, err := validator.New(
+		keyFunc,
+		algorithm,
+		issuer,
+		[]string{cfg.Audience},
+		validator.WithCustomClaims(
+			func() validator.CustomClaims {
+				return &CustomClaims{}
+			},
+		),
+		validator.WithAllowedClockSkew(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up the jwt validator: %w", err)
+	}
+
+	return jwtValidator, nil
+}
+
+// DevTokens authenticates fixed tokens, each as its subject.
+type DevTokens map[string]string
+
+func (d DevTokens) ValidateToken(ctx context.Context, token string) (any, error) {
+	subject, ok := d[token]
+	if !ok {
+		return nil, errors.New("unknown dev token")
+	}
+
+	return &validator.ValidatedClaims{
+		RegisteredClaims: validator.RegisteredClaims{
+			Issuer:  string(AuthDev),
+			Subject: subject,
+		},
+		CustomClaims: &CustomClaims{},
+	}, nil
+}
+
+func readPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: not an RSA key", path)
+		}
+
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("%s: unexpected %s PEM block", path, block.Type)
+	}
+}
@@ -0,0 +1,289 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+)
+
+const (
+	testIssuer   = "https://issuer.test/"
+	testAudience = "pill-manager"
+	testSecret   = "0123456789abcdef0123456789abcdef"
+)
+
+// testClaims returns claims local auth accepts for subject.
+func testClaims(subject string) map[string]any {
+	now := time.Now()
+
+	return map[string]any{
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"sub":   subject,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"roles": []string{"admin"},
+	}
+}
+
+// signHS256 and signRS256 make compact JWTs of claims.
+func signHS256(t *testing.T, secret string, claims map[string]any) string {
+	t.Helper()
+
+	unsigned := unsignedToken(t, "HS256", claims)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+
+	unsigned := unsignedToken(t, "RS256", claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func unsignedToken(t *testing.T, algorithm string, claims map[string]any) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": algorithm, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// writePublicKey writes key's public half to a PEM file and returns its
+// path.
+func writePublicKey(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// authenticate sends a request with token through EnsureValidToken and
+// returns the status and the claims the next handler saw.
+func authenticate(t *testing.T, auth Authenticator, token string) (int, *validator.ValidatedClaims) {
+	t.Helper()
+
+	var claims *validator.ValidatedClaims
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		claims, ok = r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+		if !ok {
+			t.Errorf("got %T in the context, want *validator.ValidatedClaims", r.Context().Value(jwtmiddleware.ContextKey{}))
+		}
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	EnsureValidToken(next, auth).ServeHTTP(w, r)
+
+	return w.Code, claims
+}
+
+func TestLocalHS256(t *testing.T) {
+	auth, err := NewAuthenticator(AuthConfig{
+		Mode:     AuthLocal,
+		Issuer:   testIssuer,
+		Audience: testAudience,
+		Secret:   testSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, claims := authenticate(t, auth, signHS256(t, testSecret, testClaims("alice")))
+	if code != http.StatusOK {
+		t.Fatalf("got %d, want 200", code)
+	}
+	if claims.RegisteredClaims.Subject != "alice" {
+		t.Errorf("got subject %q, want alice", claims.RegisteredClaims.Subject)
+	}
+
+	custom, ok := claims.CustomClaims.(*CustomClaims)
+	if !ok || !slices.Equal(custom.Roles, []string{"admin"}) {
+		t.Errorf("got custom claims %+v, want the admin role", claims.CustomClaims)
+	}
+
+	wrongIssuer := testClaims("alice")
+	wrongIssuer["iss"] = "https://elsewhere.test/"
+
+	wrongAudience := testClaims("alice")
+	wrongAudience["aud"] = "another-api"
+
+	expired := testClaims("alice")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := signHS256(t, testSecret, testClaims("alice"))
+	tampered := testClaims("mallory")
+
+	tests := map[string]string{
+		"bad signature":   signHS256(t, strings.Repeat("x", 32), testClaims("alice")),
+		"wrong issuer":    signHS256(t, testSecret, wrongIssuer),
+		"wrong audience":  signHS256(t, testSecret, wrongAudience),
+		"expired":         signHS256(t, testSecret, expired),
+		"wrong algorithm": signRS256(t, key, testClaims("alice")),
+		"changed claims":  unsignedToken(t, "HS256", tampered) + valid[strings.LastIndex(valid, "."):],
+		"not a jwt":       "alice",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			code, _ := authenticate(t, auth, token)
+			if code != http.StatusUnauthorized {
+				t.Errorf("got %d, want 401", code)
+			}
+		})
+	}
+}
+
+func TestLocalRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := NewAuthenticator(AuthConfig{
+		Mode:          AuthLocal,
+		Issuer:        testIssuer,
+		Audience:      testAudience,
+		PublicKeyFile: writePublicKey(t, key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, claims := authenticate(t, auth, signRS256(t, key, testClaims("alice")))
+	if code != http.StatusOK {
+		t.Fatalf("got %d, want 200", code)
+	}
+	if claims.RegisteredClaims.Subject != "alice" {
+		t.Errorf("got subject %q, want alice", claims.RegisteredClaims.Subject)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrongIssuer := testClaims("alice")
+	wrongIssuer["iss"] = "https://elsewhere.test/"
+
+	wrongAudience := testClaims("alice")
+	wrongAudience["aud"] = "another-api"
+
+	tests := map[string]string{
+		"bad signature":  signRS256(t, other, testClaims("alice")),
+		"wrong issuer":   signRS256(t, key, wrongIssuer),
+		"wrong audience": signRS256(t, key, wrongAudience),
+		// Signed with the public key as an HS256 secret
+		"wrong algorithm": signHS256(t, string(x509.MarshalPKCS1PublicKey(&key.PublicKey)), testClaims("alice")),
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			code, _ := authenticate(t, auth, token)
+			if code != http.StatusUnauthorized {
+				t.Errorf("got %d, want 401", code)
+			}
+		})
+	}
+}
+
+func TestDevTokens(t *testing.T) {
+	auth, err := NewAuthenticator(AuthConfig{
+		Mode:      AuthDev,
+		DevTokens: map[string]string{"alice-token": "alice"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, claims := authenticate(t, auth, "alice-token")
+	if code != http.StatusOK {
+		t.Fatalf("got %d, want 200", code)
+	}
+	if claims.RegisteredClaims.Subject != "alice" {
+		t.Errorf("got subject %q, want alice", claims.RegisteredClaims.Subject)
+	}
+
+	for _, token := range []string{"bob-token", signHS256(t, testSecret, testClaims("alice"))} {
+		code, _ := authenticate(t, auth, token)
+		if code != http.StatusUnauthorized {
+			t.Errorf("got %d for %q, want 401", code, token)
+		}
+	}
+}
+
+func TestNewAuthenticatorConfig(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]AuthConfig{
+		"short secret":   {Mode: AuthLocal, Secret: strings.Repeat("x", MinSecretLength-1)},
+		"no key":         {Mode: AuthLocal},
+		"secret and key": {Mode: AuthLocal, Secret: testSecret, PublicKeyFile: writePublicKey(t, key)},
+		"missing key":    {Mode: AuthLocal, PublicKeyFile: filepath.Join(t.TempDir(), "missing.pem")},
+		"no dev tokens":  {Mode: AuthDev},
+		"unknown mode":   {Mode: "basic"},
+	}
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewAuthenticator(cfg)
+			if err == nil {
+				t.Error("got nil, want an error")
+			}
+		})
+	}
+}
@@ -2,51 +2,60 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"net/http"
-	"net/url"
-	"time"
+	"strings"
 
 	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
-	"github.com/auth0/go-jwt-middleware/v2/jwks"
-	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/kzs0/pill_manager/models"
 )
 
-type Auth0Config struct {
-	Audience string `env:"AUTH0_AUDIENCE" envDefault:"https://kenzo.us.auth0.com/api/v2/"`
-	Domain   string `env:"AUTH0_DOMAIN" envDefault:"kenzo.us.auth0.com"`
-}
-
-type CustomClaims struct{}
+// CustomClaims are the claims read besides the registered ones.
+type CustomClaims struct {
+	// From the roles and permissions claims, including namespaced roles
+	// claims like https://example.com/roles that Auth0 requires
+	Roles []string
 
-func (c CustomClaims) Validate(ctx context.Context) error {
-	return nil
+	// Set when the request used an API key instead of a token, which can
+	// only do what its scopes allow
+	APIKey string
+	Scopes []models.KeyScope
 }
 
-func EnsureValidToken(next http.Handler, cfg Auth0Config) http.Handler {
-	issuerURL, err := url.Parse("https://" + cfg.Domain + "/")
+func (c *CustomClaims) UnmarshalJSON(data []byte) error {
+	var claims map[string]json.RawMessage
+	err := json.Unmarshal(data, &claims)
 	if err != nil {
-		log.Fatalf("Failed to parse the issuer url: %v", err)
+		return err
 	}
 
-	provider := jwks.NewCachingProvider(issuerURL, 5*time.Minute)
+	for name, value := range claims {
+		if name != "roles" && name != "permissions" && !strings.HasSuffix(name, "/roles") {
+			continue
+		}
 
-	jwtValidator, err := validator.New(
-		provider.KeyFunc,
-		validator.RS256,
-		issuerURL.String(),
-		[]string{cfg.Audience},
-		validator.WithCustomClaims(
-			func() validator.CustomClaims {
-				return &CustomClaims{}
-			},
-		),
-		validator.WithAllowedClockSkew(time.Minute),
-	)
-	if err != nil {
-		log.Fatalf("Failed to set up the jwt validator")
+		var roles []string
+		if json.Unmarshal(value, &roles) != nil {
+			var role string
+			if json.Unmarshal(value, &role) != nil {
+				continue
+			}
+			roles = strings.Fields(role)
+		}
+		c.Roles = append(c.Roles, roles...)
 	}
 
+	return nil
+}
+
+func (c CustomClaims) Validate(ctx context.Context) error {
+	return nil
+}
+
+// EnsureValidToken only lets requests with a bearer token auth accepts
+// through, putting its claims in the context under jwtmiddleware.ContextKey.
+func EnsureValidToken(next http.Handler, auth Authenticator) http.Handler {
 	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
 		log.Printf("Encountered error while validating JWT: %v", err)
 
@@ -56,7 +65,7 @@ func EnsureValidToken(next http.Handler, cfg Auth0Config) http.Handler {
 	}
 
 	middleware := jwtmiddleware.New(
-		jwtValidator.ValidateToken,
+		auth.ValidateToken,
 		jwtmiddleware.WithErrorHandler(errorHandler),
 	)
 
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/kzs0/pill_manager/models"
+)
+
+// APIKeyAuthenticator looks up API keys that haven't been revoked.
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*models.APIKey, error)
+}
+
+// WithAPIKeys accepts API keys as bearer tokens as well as whatever auth
+// does. Keys are told apart by models.APIKeyPrefix and act as the user who
+// made them, with their ID and scopes in the CustomClaims.
+func WithAPIKeys(auth Authenticator, keys APIKeyAuthenticator) Authenticator {
+	return &apiKeys{auth: auth, keys: keys}
+}
+
+type apiKeys struct {
+	auth Authenticator
+	keys APIKeyAuthenticator
+}
+
+func (a *apiKeys) ValidateToken(ctx context.Context, token string) (any, error) {
+	if !strings.HasPrefix(token, models.APIKeyPrefix) {
+		return a.auth.ValidateToken(ctx, token)
+	}
+
+	key, err := a.keys.AuthenticateAPIKey(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &validator.ValidatedClaims{
+		RegisteredClaims: validator.RegisteredClaims{
+			Issuer:  "api_key",
+			Subject: key.User,
+		},
+		CustomClaims: &CustomClaims{
+			APIKey: key.ID,
+			Scopes: key.Scopes,
+		},
+	}, nil
+}
+
+// LimitAPIKeys only lets requests made with API keys through to paths
+// under one of paths. Everything else, like managing keys themselves,
+// needs a token.
+func LimitAPIKeys(next http.Handler, paths ...string) http.Handler {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		custom, ok := claims.CustomClaims.(*CustomClaims)
+		if !ok || custom.APIKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		for _, path := range paths {
+			if r.URL.Path == path || strings.HasPrefix(r.URL.Path, path+"/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		slog.Warn("api key used outside what keys can do", "key", custom.APIKey, "path", r.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`Forbidden`))
+	}
+
+	return http.HandlerFunc(f)
+}
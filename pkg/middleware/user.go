@@ -1,16 +1,20 @@
 package middleware
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"net/http"
+	"time"
 
 	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
 	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/kzs0/pill_manager/models/db/sqlc"
 )
 
-func ObserveNewUsers(next http.Handler, queries *sqlc.Queries) http.Handler {
+func ObserveNewUsers(next http.Handler, db *sql.DB) http.Handler {
+	queries := sqlc.New(db)
+
 	f := func(w http.ResponseWriter, r *http.Request) {
 		claims, ok := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
 		if !ok {
@@ -22,7 +26,7 @@ func ObserveNewUsers(next http.Handler, queries *sqlc.Queries) http.Handler {
 
 		_, err := queries.GetUser(r.Context(), uid)
 		if errors.Is(err, sql.ErrNoRows) {
-			_, err = queries.CreateUser(r.Context(), uid)
+			err = createUser(r.Context(), db, uid)
 			if err != nil {
 				http.Error(w, "failed to manage new user", http.StatusInternalServerError)
 				return
@@ -34,3 +38,32 @@ func ObserveNewUsers(next http.Handler, queries *sqlc.Queries) http.Handler {
 
 	return http.HandlerFunc(f)
 }
+
+// createUser adds the user and the patient they are, with the same id, or
+// neither. If a dependent already has the id, the user isn't created, since
+// they would be taken for that patient.
+func createUser(ctx context.Context, db *sql.DB, uid string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := sqlc.New(tx)
+
+	_, err = q.CreateUser(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	params := sqlc.CreateUserPatientParams{
+		ID:        uid,
+		CreatedAt: time.Now().Unix(),
+	}
+	err = q.CreateUserPatient(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
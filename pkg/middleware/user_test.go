@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/kzs0/pill_manager/models/db"
+	"github.com/kzs0/pill_manager/models/db/sqlc"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	sqldb, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqldb.Close() })
+
+	_, err = db.Up(context.Background(), sqldb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sqldb
+}
+
+// observe sends a request as uid through ObserveNewUsers and returns the
+// status.
+func observe(t *testing.T, sqldb *sql.DB, uid string) int {
+	t.Helper()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	claims := &validator.ValidatedClaims{
+		RegisteredClaims: validator.RegisteredClaims{Subject: uid},
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), jwtmiddleware.ContextKey{}, claims))
+
+	w := httptest.NewRecorder()
+	ObserveNewUsers(next, sqldb).ServeHTTP(w, r)
+
+	return w.Code
+}
+
+func TestObserveNewUsers(t *testing.T) {
+	ctx := context.Background()
+	sqldb := newTestDB(t)
+	queries := sqlc.New(sqldb)
+
+	if code := observe(t, sqldb, "alice"); code != http.StatusOK {
+		t.Fatalf("got %d, want 200", code)
+	}
+	if code := observe(t, sqldb, "alice"); code != http.StatusOK {
+		t.Fatalf("got %d for a known user, want 200", code)
+	}
+
+	patient, err := queries.GetPatient(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !patient.UserID.Valid || patient.UserID.String != "alice" || patient.Owner != "alice" {
+		t.Errorf("got patient %+v", patient)
+	}
+}
+
+func TestObserveNewUsersIDTaken(t *testing.T) {
+	ctx := context.Background()
+	sqldb := newTestDB(t)
+	queries := sqlc.New(sqldb)
+
+	if code := observe(t, sqldb, "alice"); code != http.StatusOK {
+		t.Fatalf("got %d, want 200", code)
+	}
+
+	params := sqlc.CreatePatientParams{
+		ID:    "kid",
+		Name:  "Kid",
+		Owner: "alice",
+	}
+	_, err := queries.CreatePatient(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A subject with the dependent's id would be taken for them
+	if code := observe(t, sqldb, "kid"); code != http.StatusInternalServerError {
+		t.Errorf("got %d, want 500", code)
+	}
+
+	_, err = queries.GetUser(ctx, "kid")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("got %v, want the user to not be created", err)
+	}
+}
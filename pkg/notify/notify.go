@@ -0,0 +1,40 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrGone is returned when the address no longer accepts messages, e.g. a
+// push subscription that was revoked, and shouldn't be tried again.
+var ErrGone = errors.New("address is gone")
+
+type Kind string
+
+const (
+	KindDose      Kind = "dose"
+	KindLowSupply Kind = "low_supply"
+)
+
+// Message is a reminder that a dose is due, or an alert that a prescription
+// is running low. Dose fields are empty on low supply alerts.
+type Message struct {
+	Kind           Kind
+	Subject        string
+	Body           string
+	PrescriptionID string
+	DoseID         string
+	Medication     string
+	Time           time.Time
+	Amount         float64
+	Unit           string
+	// 1 for the first reminder about the dose, 2 for the next and so on
+	Attempt int
+}
+
+// Notifier delivers messages over one channel. The format of to depends on
+// the channel: a URL, an email address, a push subscription, etc.
+type Notifier interface {
+	Notify(ctx context.Context, to string, msg Message) error
+}
@@ -0,0 +1,108 @@
+package notify_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kzs0/pill_manager/pkg/notify"
+	"github.com/kzs0/pill_manager/pkg/notify/notifytest"
+)
+
+var testMessage = notify.Message{
+	Kind:       notify.KindDose,
+	Subject:    "Time to take Ibuprofen",
+	Body:       "1 tablet of Ibuprofen is due at 08:00.",
+	DoseID:     "dose-1",
+	Medication: "Ibuprofen",
+	Time:       time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+	Amount:     1,
+	Unit:       "tablet",
+	Attempt:    1,
+}
+
+func TestWebhook(t *testing.T) {
+	var body []byte
+	var signature string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Signature-256")
+	}))
+	defer srv.Close()
+
+	n := &notify.Webhook{Client: srv.Client(), Secret: "s3cret"}
+	err := n.Notify(context.Background(), srv.URL, testMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got notify.Message
+	err = json.Unmarshal(body, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != testMessage {
+		t.Errorf("got %+v, want %+v", got, testMessage)
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if signature != want {
+		t.Errorf("got signature %q, want %q", signature, want)
+	}
+}
+
+func TestWebhookGone(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer srv.Close()
+
+	n := &notify.Webhook{Client: srv.Client()}
+	err := n.Notify(context.Background(), srv.URL, testMessage)
+	if !errors.Is(err, notify.ErrGone) {
+		t.Errorf("got %v, want ErrGone", err)
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	srv := notifytest.NewSMTPServer(t)
+
+	n := &notify.SMTP{Addr: srv.Addr, From: "reminders@localhost"}
+	err := n.Notify(context.Background(), "Alice <alice@example.com>", testMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail := srv.Mail()
+	if len(mail) != 1 {
+		t.Fatalf("got %d messages, want 1", len(mail))
+	}
+
+	if mail[0].From != "reminders@localhost" {
+		t.Errorf("got from %q", mail[0].From)
+	}
+	if len(mail[0].To) != 1 || mail[0].To[0] != "alice@example.com" {
+		t.Errorf("got to %q", mail[0].To)
+	}
+
+	for _, want := range []string{
+		"To: \"Alice\" <alice@example.com>\r\n",
+		"Subject: Time to take Ibuprofen\r\n",
+		"\r\n\r\n1 tablet of Ibuprofen is due at 08:00.\r\n",
+	} {
+		if !strings.Contains(mail[0].Data, want) {
+			t.Errorf("message is missing %q:\n%s", want, mail[0].Data)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package notifytest has fakes of the services notifiers deliver to, for
+// tests.
+package notifytest
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Mail is a message the SMTP server accepted.
+type Mail struct {
+	From string
+	To   []string
+	// Headers and body, as sent
+	Data string
+}
+
+// SMTPServer is a fake SMTP server on loopback that accepts every message
+// without authentication or TLS.
+type SMTPServer struct {
+	Addr string // host:port
+
+	listener net.Listener
+	mu       sync.Mutex
+	mail     []Mail
+}
+
+// NewSMTPServer starts an SMTPServer that is closed when the test ends.
+func NewSMTPServer(t *testing.T) *SMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &SMTPServer{
+		Addr:     listener.Addr().String(),
+		listener: listener,
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go s.serve()
+
+	return s
+}
+
+// Mail returns the messages accepted so far.
+func (s *SMTPServer) Mail() []Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Mail(nil), s.mail...)
+}
+
+func (s *SMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *SMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost fake SMTP")
+
+	var mail Mail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 localhost")
+		case "MAIL":
+			mail = Mail{From: address(arg)}
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			mail.To = append(mail.To, address(arg))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+
+			data, err := readData(tp.Reader.R)
+			if err != nil {
+				return
+			}
+			mail.Data = data
+
+			s.mu.Lock()
+			s.mail = append(s.mail, mail)
+			s.mu.Unlock()
+
+			tp.PrintfLine("250 OK")
+		case "RSET", "NOOP":
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// readData reads a DATA section up to the line with only a dot, undoing
+// dot stuffing.
+func readData(r *bufio.Reader) (string, error) {
+	var data strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+
+		if line == ".\r\n" {
+			return data.String(), nil
+		}
+
+		data.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+// address takes the address out of a MAIL FROM:<a> or RCPT TO:<a> argument.
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, "<")
+	addr, _, _ = strings.Cut(addr, ">")
+	return addr
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckPublicURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://127.0.0.1/hook", ErrPrivateAddress},
+		{"https://[::1]/hook", ErrPrivateAddress},
+		{"https://10.1.2.3/hook", ErrPrivateAddress},
+		{"https://172.16.0.1/hook", ErrPrivateAddress},
+		{"https://192.168.1.1/hook", ErrPrivateAddress},
+		{"https://169.254.169.254/latest/meta-data", ErrPrivateAddress},
+		{"https://0.0.0.0/hook", ErrPrivateAddress},
+		{"https://[::ffff:127.0.0.1]/hook", ErrPrivateAddress},
+		{"https://[fe80::1]/hook", ErrPrivateAddress},
+		{"https://93.184.215.14/hook", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := CheckPublicURL(context.Background(), tt.url)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	for _, url := range []string{"http://93.184.215.14/hook", "ftp://93.184.215.14", "https://", "not a url"} {
+		t.Run(url, func(t *testing.T) {
+			err := CheckPublicURL(context.Background(), url)
+			if err == nil {
+				t.Error("got nil, want an error")
+			}
+		})
+	}
+}
+
+func TestPublicClientRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback server")
+	}))
+	defer srv.Close()
+
+	resp, err := PublicClient(time.Second).Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("got %v, want ErrPrivateAddress", err)
+	}
+}
+
+func TestPublicClientDoesntFollowRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			t.Errorf("redirect to %s was followed", r.URL.Path)
+		}
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	// The server is on loopback, so only the redirect policy is kept
+	client := PublicClient(time.Second)
+	client.Transport = srv.Client().Transport
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("got %s, want the redirect", resp.Status)
+	}
+}
@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTP emails each message to the address it is sent to. Point Addr at a
+// local server, like MailHog, to see what would be sent.
+type SMTP struct {
+	Addr string // host:port
+	From string
+	// If empty, no authentication is attempted. Go's PLAIN auth refuses to
+	// send credentials without TLS unless the server is on localhost.
+	Username string
+	Password string
+}
+
+func (n *SMTP) Notify(ctx context.Context, to string, msg Message) error {
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("smtp: invalid address %q: %w", to, err)
+	}
+
+	from, err := mail.ParseAddress(n.From)
+	if err != nil {
+		return fmt.Errorf("smtp: invalid from address %q: %w", n.From, err)
+	}
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		host, _, err := net.SplitHostPort(n.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", from.String())
+	fmt.Fprintf(&body, "To: %s\r\n", rcpt.String())
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&body, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&body, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&body, "\r\n%s\r\n", msg.Body)
+
+	// net/smtp has no context support, so give up on a send that outlives
+	// ctx instead of waiting on it
+	errc := make(chan error, 1)
+	go func() {
+		errc <- smtp.SendMail(n.Addr, auth, from.Address, []string{rcpt.Address}, body.Bytes())
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Webhook POSTs each message as JSON to the URL it is sent to. Any 2xx
+// response is a success.
+type Webhook struct {
+	// If nil, a PublicClient is used. Whatever client is used should refuse
+	// addresses that aren't public, since users pick where messages go.
+	Client *http.Client
+	// If set, the body's hex HMAC-SHA256 under Secret is sent in the
+	// X-Signature-256 header so receivers can check where it came from
+	Secret string
+}
+
+func (n *Webhook) Notify(ctx context.Context, to string, msg Message) error {
+	body, err := json.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if n.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := n.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode == http.StatusGone {
+		return ErrGone
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s: unexpected status %s", to, resp.Status)
+	}
+
+	return nil
+}
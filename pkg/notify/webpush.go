@@ -0,0 +1,312 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Subscription is a browser's PushSubscription as serialized by toJSON().
+type Subscription struct {
+	Endpoint string
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	}
+}
+
+// ParseSubscription parses and checks a PushSubscription's JSON.
+func ParseSubscription(s string) (*Subscription, error) {
+	sub := &Subscription{}
+	err := json.Unmarshal([]byte(s), sub)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", sub.Endpoint)
+	}
+
+	if _, err := decodeKey(sub.Keys.P256dh, 65); err != nil {
+		return nil, fmt.Errorf("p256dh: %w", err)
+	}
+
+	if _, err := decodeKey(sub.Keys.Auth, 16); err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+
+	return sub, nil
+}
+
+// WebPush sends each message to the push subscription, in JSON, it is sent
+// to. Payloads are encrypted as in RFC 8291 and the server identifies itself
+// with VAPID (RFC 8292).
+type WebPush struct {
+	// If nil, a PublicClient is used. Whatever client is used should refuse
+	// addresses that aren't public, since users pick where messages go.
+	Client *http.Client
+	// Base64url encoded, unpadded. The public key is the uncompressed P-256
+	// point given to browsers as applicationServerKey, the private key its
+	// 32 byte scalar.
+	VAPIDPublicKey  string
+	VAPIDPrivateKey string
+	// Contact for the push service, a mailto: or https: URL
+	Subject string
+	// How long the push service holds on to a message for an offline
+	// browser. If 0, a day.
+	TTL time.Duration
+}
+
+// GenerateVAPIDKeys returns a new base64url encoded VAPID key pair.
+func GenerateVAPIDKeys() (public, private string, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(key.PublicKey().Bytes()), enc.EncodeToString(key.Bytes()), nil
+}
+
+func (n *WebPush) Notify(ctx context.Context, to string, msg Message) error {
+	sub, err := ParseSubscription(to)
+	if err != nil {
+		return fmt.Errorf("web push: invalid subscription: %w", err)
+	}
+
+	payload, err := json.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+
+	body, err := encryptPayload(sub, payload)
+	if err != nil {
+		return err
+	}
+
+	auth, err := n.vapidAuthorization(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	ttl := n.TTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl/time.Second)))
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", auth)
+
+	client := n.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return ErrGone
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("web push: unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// encryptPayload encrypts payload for the subscription as a single
+// aes128gcm record (RFC 8188) keyed as in RFC 8291.
+func encryptPayload(sub *Subscription, payload []byte) ([]byte, error) {
+	uaPublicBytes, err := decodeKey(sub.Keys.P256dh, 65)
+	if err != nil {
+		return nil, err
+	}
+
+	authSecret, err := decodeKey(sub.Keys.Auth, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublicBytes := asPrivate.PublicKey().Bytes()
+
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublicBytes...)
+	keyInfo = append(keyInfo, asPublicBytes...)
+	ikm := hkdf(authSecret, ecdhSecret, keyInfo, 32)
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// 0x02 pads and marks the last record
+	plaintext := append(payload, 0x02)
+
+	const recordSize = 4096
+	if len(plaintext)+gcm.Overhead() > recordSize {
+		return nil, errors.New("web push: payload too large")
+	}
+
+	header := make([]byte, 0, 16+4+1+len(asPublicBytes))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublicBytes)))
+	header = append(header, asPublicBytes...)
+
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// vapidAuthorization builds the Authorization header for a push to
+// endpoint, a JWT signed with the VAPID key for the endpoint's origin.
+func (n *WebPush) vapidAuthorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := n.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+
+	header := enc.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": n.Subject,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := header + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return fmt.Sprintf("vapid t=%s.%s, k=%s", unsigned, enc.EncodeToString(sig), n.VAPIDPublicKey), nil
+}
+
+func (n *WebPush) signingKey() (*ecdsa.PrivateKey, error) {
+	d, err := decodeKey(n.VAPIDPrivateKey, 32)
+	if err != nil {
+		return nil, fmt.Errorf("web push: vapid private key: %w", err)
+	}
+
+	private, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("web push: vapid private key: %w", err)
+	}
+
+	public := private.PublicKey().Bytes()
+	if n.VAPIDPublicKey != base64.RawURLEncoding.EncodeToString(public) {
+		return nil, errors.New("web push: vapid public key doesn't match the private key")
+	}
+
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}, nil
+}
+
+// hkdf is HKDF-SHA256 (RFC 5869) for outputs of at most one hash length.
+func hkdf(salt, ikm, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{0x01})
+
+	return expand.Sum(nil)[:length]
+}
+
+// decodeKey decodes base64url, padded or not, and checks the length.
+func decodeKey(s string, length int) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		b, err = base64.URLEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) != length {
+		return nil, fmt.Errorf("expected %d bytes, got %d", length, len(b))
+	}
+
+	return b, nil
+}